@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+	api "github.com/majori/wrc-laptimer/internal/http"
+)
+
+// admin runs the organiser commands either directly on the database file or
+// through the HTTP API of a running laptimer, which holds the database open.
+type admin interface {
+	CreateSeries(req api.CreateSeriesRequest) (int, error)
+	ListSeries() ([]database.SeriesSummary, error)
+	StartSeries(id int) error
+	EndSeries(id int) error
+
+	CreateEvent(req api.CreateEventRequest) (int, error)
+	ListEvents(seriesID sql.NullInt32) ([]database.EventSummary, error)
+	StartEvent(id int) error
+	EndEvent(id int) error
+	GetEventResults(eventID int, hcMode bool) ([]database.EventResult, error)
+
+	ListUsers() ([]database.UserSummary, error)
+	RenameUser(id string, name string) error
+	MergeUsers(fromID string, intoID string) error
+	GetUserCards(userID string) ([]database.UserCard, error)
+	SetCardRevoked(cardID string, revoked bool) error
+
+	CorrectSession(sessionID int, action string, req api.SessionCorrectionRequest) error
+	GetSessionCorrections(sessionID int) ([]database.SessionCorrection, error)
+
+	LoadDataPack(pack *database.DataPack, force bool) (*database.DataPackLoad, error)
+	ListDataPacks() ([]database.DataPackLoad, error)
+	GetMissingLookups() ([]database.MissingLookup, error)
+
+	Close()
+}
+
+// adminFlags returns a flag set with the --server flag common to the
+// organiser commands.
+func adminFlags(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	server := flags.String("server", "", "URL of a running laptimer, e.g. http://127.0.0.1:8080. The database is opened directly if not set")
+	return flags, server
+}
+
+func openAdmin(ctx context.Context, server string) (admin, error) {
+	if server != "" {
+		return &apiAdmin{baseURL: strings.TrimSuffix(server, "/"), client: &http.Client{Timeout: time.Minute}}, nil
+	}
+
+	db, err := database.NewDatabase(ctx, getConfig().DatabaseDSN())
+	if err != nil {
+		return nil, fmt.Errorf("could not open database, use --server if the laptimer is running: %w", err)
+	}
+	db.SetBackup(getConfig().BackupConfig())
+	return &databaseAdmin{db: db}, nil
+}
+
+type databaseAdmin struct {
+	db *database.Database
+}
+
+func nullInt16(v *uint16) sql.NullInt16 {
+	if v == nil {
+		return sql.NullInt16{}
+	}
+	return sql.NullInt16{Int16: int16(*v), Valid: true}
+}
+
+func (a *databaseAdmin) CreateSeries(req api.CreateSeriesRequest) (int, error) {
+	return a.db.CreateSeries(req.Name, nullInt16(req.VehicleClassID))
+}
+
+func (a *databaseAdmin) ListSeries() ([]database.SeriesSummary, error) {
+	return a.db.ListSeries()
+}
+
+func (a *databaseAdmin) StartSeries(id int) error {
+	return a.db.StartSeries(id)
+}
+
+func (a *databaseAdmin) EndSeries(id int) error {
+	return a.db.EndSeries(id)
+}
+
+func (a *databaseAdmin) CreateEvent(req api.CreateEventRequest) (int, error) {
+	var seriesID sql.NullInt32
+	if req.RaceSeriesID != nil {
+		seriesID = sql.NullInt32{Int32: int32(*req.RaceSeriesID), Valid: true}
+	}
+	return a.db.CreateEvent(req.Name, seriesID, nullInt16(req.LocationID), nullInt16(req.RouteID), nullInt16(req.VehicleClassID))
+}
+
+func (a *databaseAdmin) ListEvents(seriesID sql.NullInt32) ([]database.EventSummary, error) {
+	return a.db.ListEvents(seriesID)
+}
+
+func (a *databaseAdmin) StartEvent(id int) error {
+	return a.db.StartEvent(id)
+}
+
+func (a *databaseAdmin) EndEvent(id int) error {
+	return a.db.EndEvent(id)
+}
+
+func (a *databaseAdmin) GetEventResults(eventID int, hcMode bool) ([]database.EventResult, error) {
+	event, err := a.db.GetEvent(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if event == nil {
+		return nil, fmt.Errorf("event %d not found", eventID)
+	}
+	return a.db.GetEventResults(eventID, hcMode)
+}
+
+func (a *databaseAdmin) ListUsers() ([]database.UserSummary, error) {
+	return a.db.ListUsers()
+}
+
+func (a *databaseAdmin) RenameUser(id string, name string) error {
+	return a.db.RenameUser(id, name)
+}
+
+func (a *databaseAdmin) MergeUsers(fromID string, intoID string) error {
+	return a.db.MergeUsers(fromID, intoID)
+}
+
+func (a *databaseAdmin) GetUserCards(userID string) ([]database.UserCard, error) {
+	user, err := a.db.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %s not found", userID)
+	}
+	return a.db.GetUserCards(userID)
+}
+
+func (a *databaseAdmin) SetCardRevoked(cardID string, revoked bool) error {
+	return a.db.SetCardRevoked(cardID, revoked)
+}
+
+func (a *databaseAdmin) CorrectSession(sessionID int, action string, req api.SessionCorrectionRequest) error {
+	return api.CorrectSession(a.db, sessionID, action, req)
+}
+
+func (a *databaseAdmin) GetSessionCorrections(sessionID int) ([]database.SessionCorrection, error) {
+	return a.db.GetSessionCorrections(sessionID)
+}
+
+func (a *databaseAdmin) LoadDataPack(pack *database.DataPack, force bool) (*database.DataPackLoad, error) {
+	return a.db.LoadDataPack(pack, force)
+}
+
+func (a *databaseAdmin) ListDataPacks() ([]database.DataPackLoad, error) {
+	return a.db.GetDataPacks()
+}
+
+func (a *databaseAdmin) GetMissingLookups() ([]database.MissingLookup, error) {
+	return a.db.GetMissingLookups()
+}
+
+func (a *databaseAdmin) Close() {
+	a.db.Close()
+}
+
+type apiAdmin struct {
+	baseURL string
+	client  *http.Client
+}
+
+// do sends the request and decodes the JSON response to out, if given. Error
+// responses of the API are plain text.
+func (a *apiAdmin) do(method string, path string, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, a.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func (a *apiAdmin) CreateSeries(req api.CreateSeriesRequest) (int, error) {
+	var resp api.CreateSeriesResponse
+	err := a.do(http.MethodPost, "/api/admin/series/create", req, &resp)
+	return resp.SeriesID, err
+}
+
+func (a *apiAdmin) ListSeries() ([]database.SeriesSummary, error) {
+	var series []database.SeriesSummary
+	err := a.do(http.MethodGet, "/api/series", nil, &series)
+	return series, err
+}
+
+func (a *apiAdmin) StartSeries(id int) error {
+	return a.do(http.MethodPost, fmt.Sprintf("/api/admin/series/%d/start", id), nil, nil)
+}
+
+func (a *apiAdmin) EndSeries(id int) error {
+	return a.do(http.MethodPost, fmt.Sprintf("/api/admin/series/%d/end", id), nil, nil)
+}
+
+func (a *apiAdmin) CreateEvent(req api.CreateEventRequest) (int, error) {
+	var resp api.CreateEventResponse
+	err := a.do(http.MethodPost, "/api/admin/events/create", req, &resp)
+	return resp.EventID, err
+}
+
+func (a *apiAdmin) ListEvents(seriesID sql.NullInt32) ([]database.EventSummary, error) {
+	path := "/api/events"
+	if seriesID.Valid {
+		path += fmt.Sprintf("?series=%d", seriesID.Int32)
+	}
+	var events []database.EventSummary
+	err := a.do(http.MethodGet, path, nil, &events)
+	return events, err
+}
+
+func (a *apiAdmin) StartEvent(id int) error {
+	return a.do(http.MethodPost, fmt.Sprintf("/api/admin/events/%d/start", id), nil, nil)
+}
+
+func (a *apiAdmin) EndEvent(id int) error {
+	return a.do(http.MethodPost, fmt.Sprintf("/api/admin/events/%d/end", id), nil, nil)
+}
+
+func (a *apiAdmin) GetEventResults(eventID int, hcMode bool) ([]database.EventResult, error) {
+	var results []database.EventResult
+	err := a.do(http.MethodGet, fmt.Sprintf("/api/events/%d/results?hc=%t", eventID, hcMode), nil, &results)
+	return results, err
+}
+
+func (a *apiAdmin) ListUsers() ([]database.UserSummary, error) {
+	var users []database.UserSummary
+	err := a.do(http.MethodGet, "/api/users", nil, &users)
+	return users, err
+}
+
+func (a *apiAdmin) RenameUser(id string, name string) error {
+	return a.do(http.MethodPost, fmt.Sprintf("/api/admin/users/%s/rename", url.PathEscape(id)), api.RenameUserRequest{Name: name}, nil)
+}
+
+func (a *apiAdmin) MergeUsers(fromID string, intoID string) error {
+	return a.do(http.MethodPost, fmt.Sprintf("/api/admin/users/%s/merge", url.PathEscape(fromID)), api.MergeUserRequest{Into: intoID}, nil)
+}
+
+func (a *apiAdmin) GetUserCards(userID string) ([]database.UserCard, error) {
+	var cards []database.UserCard
+	err := a.do(http.MethodGet, fmt.Sprintf("/api/admin/users/%s/cards", url.PathEscape(userID)), nil, &cards)
+	return cards, err
+}
+
+func (a *apiAdmin) SetCardRevoked(cardID string, revoked bool) error {
+	action := "restore"
+	if revoked {
+		action = "revoke"
+	}
+	return a.do(http.MethodPost, fmt.Sprintf("/api/admin/cards/%s/%s", url.PathEscape(cardID), action), nil, nil)
+}
+
+func (a *apiAdmin) CorrectSession(sessionID int, action string, req api.SessionCorrectionRequest) error {
+	return a.do(http.MethodPost, fmt.Sprintf("/api/admin/sessions/%d/%s", sessionID, action), req, nil)
+}
+
+func (a *apiAdmin) GetSessionCorrections(sessionID int) ([]database.SessionCorrection, error) {
+	var corrections []database.SessionCorrection
+	err := a.do(http.MethodGet, fmt.Sprintf("/api/admin/sessions/%d/corrections", sessionID), nil, &corrections)
+	return corrections, err
+}
+
+func (a *apiAdmin) LoadDataPack(pack *database.DataPack, force bool) (*database.DataPackLoad, error) {
+	var load database.DataPackLoad
+	err := a.do(http.MethodPost, fmt.Sprintf("/api/admin/data-packs?force=%t", force), pack, &load)
+	return &load, err
+}
+
+func (a *apiAdmin) ListDataPacks() ([]database.DataPackLoad, error) {
+	var packs []database.DataPackLoad
+	err := a.do(http.MethodGet, "/api/admin/data-packs", nil, &packs)
+	return packs, err
+}
+
+func (a *apiAdmin) GetMissingLookups() ([]database.MissingLookup, error) {
+	var missing []database.MissingLookup
+	err := a.do(http.MethodGet, "/api/admin/data-packs/missing", nil, &missing)
+	return missing, err
+}
+
+func (a *apiAdmin) Close() {}
+
+// newTable returns a writer which aligns tab separated columns. Flush it
+// after writing the rows.
+func newTable(header ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t")) //nolint:errcheck
+	return w
+}
+
+func formatOptional[T any](v *T) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprint(*v)
+}
+
+// formatTimestamp formats a timestamp read from the database. They are stored
+// in local wall clock time but read as UTC, so they are not converted.
+func formatTimestamp(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// formatResultTime formats seconds as a stage time, e.g. 3:25.120.
+func formatResultTime(seconds float32) string {
+	ms := int(seconds*1000 + 0.5)
+	return fmt.Sprintf("%d:%02d.%03d", ms/60000, ms/1000%60, ms%1000)
+}
+
+func parseID(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected one ID")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID: %s", args[0])
+	}
+	return id, nil
+}
+
+// optionalID converts a zero flag value to nil.
+func optionalID(v uint) *uint16 {
+	if v == 0 {
+		return nil
+	}
+	id := uint16(v)
+	return &id
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+)
+
+// runBackup backs up the database to the backup directory:
+//
+//	wrc-laptimer backup
+func runBackup(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := database.NewDatabase(ctx, getConfig().DatabaseDSN())
+	if err != nil {
+		return fmt.Errorf("could not open database: %w", err)
+	}
+	defer db.Close()
+
+	db.SetBackup(getConfig().BackupConfig())
+	backupPath, err := db.Backup("manual")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Database backed up to %s\n", backupPath)
+	return nil
+}
+
+// runRestore replaces the database with a backup. The laptimer must not be
+// running:
+//
+//	wrc-laptimer restore backups/wrc-scheduled-20250301-120000.db
+func runRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one backup file to restore")
+	}
+
+	replacedPath, err := database.RestoreBackup(flags.Arg(0), getConfig().DatabasePath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Database restored from %s\n", flags.Arg(0))
+	if replacedPath != "" {
+		fmt.Printf("Previous database was moved to %s\n", replacedPath)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runConfig shows the effective configuration:
+//
+//	wrc-laptimer config print
+func runConfig(args []string) error {
+	flags := flag.NewFlagSet("config", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 || flags.Arg(0) != "print" {
+		return fmt.Errorf("expected command: print")
+	}
+
+	cfg := getConfig()
+	if cfg.ConfigFile != "" {
+		fmt.Printf("# Read from %s and environment variables\n", cfg.ConfigFile)
+	} else {
+		fmt.Println("# Read from environment variables")
+	}
+	return cfg.Print(os.Stdout)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+)
+
+// runDataPacks keeps the lookup tables of game content up to date:
+//
+//	wrc-laptimer data-packs list
+//	wrc-laptimer data-packs load [--force] <file.json|file.csv>
+//	wrc-laptimer data-packs missing
+func runDataPacks(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected command: list, load or missing")
+	}
+
+	flags, server := adminFlags("data-packs " + args[0])
+	force := flags.Bool("force", false, "Load the pack even if its version has already been loaded")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var pack *database.DataPack
+	switch args[0] {
+	case "list", "missing":
+	case "load":
+		if flags.NArg() != 1 {
+			return fmt.Errorf("expected data pack file")
+		}
+		format := database.DataPackFormatJSON
+		if strings.EqualFold(filepath.Ext(flags.Arg(0)), ".csv") {
+			format = database.DataPackFormatCSV
+		}
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return fmt.Errorf("could not open data pack: %w", err)
+		}
+		defer f.Close() //nolint:errcheck
+		if pack, err = database.ParseDataPack(f, format); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown data-packs command: %s", args[0])
+	}
+
+	a, err := openAdmin(ctx, *server)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	switch args[0] {
+	case "load":
+		load, err := a.LoadDataPack(pack, *force)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Loaded data pack %s, %d rows\n", load.Version, load.RowCount)
+		return nil
+	case "missing":
+		missing, err := a.GetMissingLookups()
+		if err != nil {
+			return err
+		}
+		w := newTable("TABLE", "ID", "SESSIONS", "LAST SEEN")
+		for _, m := range missing {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", m.Table, m.ID, m.Sessions, formatTimestamp(&m.LastSeen)) //nolint:errcheck
+		}
+		return w.Flush()
+	}
+
+	packs, err := a.ListDataPacks()
+	if err != nil {
+		return err
+	}
+	w := newTable("VERSION", "LOADED", "ROWS")
+	for _, p := range packs {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", p.Version, formatTimestamp(&p.LoadedAt), p.RowCount) //nolint:errcheck
+	}
+	return w.Flush()
+}
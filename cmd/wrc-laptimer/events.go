@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	api "github.com/majori/wrc-laptimer/internal/http"
+)
+
+// runEvents manages events:
+//
+//	wrc-laptimer events create --name "Round 1" --series 1 --route 12
+//	wrc-laptimer events list --series 1
+//	wrc-laptimer events start 3
+//	wrc-laptimer events end 3
+//	wrc-laptimer events results 3
+func runEvents(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected command: create, list, start, end or results")
+	}
+
+	flags, server := adminFlags("events " + args[0])
+	var name *string
+	var series, location, route, class *uint
+	var hcMode *bool
+	switch args[0] {
+	case "create":
+		name = flags.String("name", "", "name of the event")
+		series = flags.Uint("series", 0, "series ID the event belongs to")
+		location = flags.Uint("location", 0, "location ID of the event")
+		route = flags.Uint("route", 0, "route ID of the event")
+		class = flags.Uint("class", 0, "vehicle class ID the event is restricted to")
+	case "list":
+		series = flags.Uint("series", 0, "list only the events of the series")
+	case "results":
+		hcMode = flags.Bool("hc", false, "show HC mode results, where only the first run counts")
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var id int
+	switch args[0] {
+	case "create":
+		if *name == "" {
+			return fmt.Errorf("--name is required")
+		}
+	case "list":
+	case "start", "end", "results":
+		var err error
+		if id, err = parseID(flags.Args()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown events command: %s", args[0])
+	}
+
+	a, err := openAdmin(ctx, *server)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	switch args[0] {
+	case "create":
+		id, err := a.CreateEvent(api.CreateEventRequest{
+			Name:           *name,
+			RaceSeriesID:   optionalID(*series),
+			LocationID:     optionalID(*location),
+			RouteID:        optionalID(*route),
+			VehicleClassID: optionalID(*class),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Event %d created\n", id)
+	case "list":
+		var seriesID sql.NullInt32
+		if *series != 0 {
+			seriesID = sql.NullInt32{Int32: int32(*series), Valid: true}
+		}
+		events, err := a.ListEvents(seriesID)
+		if err != nil {
+			return err
+		}
+		w := newTable("ID", "NAME", "SERIES", "ROUTE", "CLASS", "SESSIONS", "ACTIVE", "STARTED", "ENDED")
+		for _, e := range events {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%t\t%s\t%s\n", e.ID, e.Name, formatOptional(e.SeriesName), formatOptional(e.RouteName), formatOptional(e.VehicleClassName), e.SessionCount, e.Active, formatTimestamp(e.StartedAt), formatTimestamp(e.EndedAt)) //nolint:errcheck
+		}
+		return w.Flush()
+	case "start":
+		if err := a.StartEvent(id); err != nil {
+			return err
+		}
+		fmt.Printf("Event %d started\n", id)
+	case "end":
+		if err := a.EndEvent(id); err != nil {
+			return err
+		}
+		fmt.Printf("Event %d ended\n", id)
+	case "results":
+		return printEventResults(a, id, *hcMode)
+	}
+	return nil
+}
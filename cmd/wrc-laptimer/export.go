@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+)
+
+// runExport writes a session with its telemetry to a file or stdout:
+//
+//	wrc-laptimer export --session 12 --format motec --output session-12.csv
+func runExport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	sessionID := flags.Int("session", 0, "session ID to export")
+	format := flags.String("format", database.ExportFormatCSV, fmt.Sprintf("export format (%s)", strings.Join(database.ExportFormats, ", ")))
+	output := flags.String("output", "", "output file, defaults to stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *sessionID == 0 {
+		return fmt.Errorf("--session is required")
+	}
+	if !slices.Contains(database.ExportFormats, *format) {
+		return fmt.Errorf("unknown export format: %s", *format)
+	}
+
+	db, err := database.NewDatabase(ctx, getConfig().DatabaseDSN())
+	if err != nil {
+		return fmt.Errorf("could not open database: %w", err)
+	}
+	defer db.Close()
+
+	session, err := db.GetSessionMetadata(*sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return fmt.Errorf("session %d not found", *sessionID)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer file.Close() //nolint:errcheck
+		w = file
+	}
+
+	return db.ExportSession(session, *format, w)
+}
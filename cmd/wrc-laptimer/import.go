@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+)
+
+// runImport merges another database or a session export into wrc.db:
+//
+//	wrc-laptimer import [--dry-run] other-laptop.db
+func runImport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would be imported without changing the database")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one file to import (DuckDB database, .json or .parquet session export)")
+	}
+
+	db, err := database.NewDatabase(ctx, getConfig().DatabaseDSN())
+	if err != nil {
+		return fmt.Errorf("could not open database: %w", err)
+	}
+	defer db.Close()
+
+	report, err := db.ImportFile(flags.Arg(0), *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		fmt.Println("Dry run, nothing was imported")
+	}
+	fmt.Printf("Users:          %d\n", report.Users)
+	fmt.Printf("User logins:    %d\n", report.UserLogins)
+	fmt.Printf("Series:         %d\n", report.Series)
+	fmt.Printf("Events:         %d\n", report.Events)
+	fmt.Printf("Results:        %d\n", report.Results)
+	fmt.Printf("Series results: %d\n", report.SeriesResults)
+	fmt.Printf("Sessions:       %d\n", report.Sessions)
+	fmt.Printf("Telemetry rows: %d\n", report.Telemetry)
+	fmt.Printf("Achievements:   %d\n", report.Achievements)
+	fmt.Printf("Splits:         %d\n", report.Splits)
+	fmt.Printf("Incidents:      %d\n", report.Incidents)
+	for _, conflict := range report.Conflicts {
+		fmt.Printf("Conflict: %s\n", conflict)
+	}
+	return nil
+}
@@ -2,46 +2,133 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	env "github.com/caarlos0/env/v6"
+	"github.com/majori/wrc-laptimer/internal/broker"
+	"github.com/majori/wrc-laptimer/internal/config"
 	"github.com/majori/wrc-laptimer/internal/database"
 	"github.com/majori/wrc-laptimer/internal/events"
 	"github.com/majori/wrc-laptimer/internal/http"
-	"github.com/majori/wrc-laptimer/internal/nfc"
+	"github.com/majori/wrc-laptimer/internal/identity"
 	"github.com/majori/wrc-laptimer/pkg/telemetry"
 )
 
-type Config struct {
-	ListenUDP  string `env:"LISTEN_UDP" envDefault:"127.0.0.1:20777"`
-	ListenHTTP string `env:"LISTEN_HTTP" envDefault:"127.0.0.1:8080"`
-}
-
 var (
-	config Config
+	// Current config, replaced when the config is reloaded
+	currentConfig atomic.Pointer[config.Config]
+	logLevel      = new(slog.LevelVar)
 )
 
 func init() {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level: logLevel,
 	}))
 	slog.SetDefault(logger)
 
-	config = Config{}
-	if err := env.Parse(&config); err != nil {
+	cfg, err := config.Load()
+	if err != nil {
 		slog.Error("failed to parse config", "error", err)
 		os.Exit(1)
 	}
+	currentConfig.Store(cfg)
+
+	level, _ := cfg.SlogLevel()
+	logLevel.Set(level)
+}
+
+func getConfig() *config.Config {
+	return currentConfig.Load()
+}
+
+// applyConfig applies the settings which can be changed while running.
+func applyConfig(db *database.Database, cfg *config.Config) {
+	currentConfig.Store(cfg)
+
+	level, _ := cfg.SlogLevel()
+	logLevel.Set(level)
+	db.SetLogoutPolicy(cfg.LogoutPolicy())
+	db.SetStalledSessionTimeout(cfg.StalledSessionTimeout)
+	db.SetBackup(cfg.BackupConfig())
+	if err := db.SetTelemetryStorage(cfg.TelemetryStorage()); err != nil {
+		slog.Error("invalid telemetry storage config", "error", err)
+	}
+}
+
+// identitySources returns the enabled identity sources. The web and QR
+// sources are also returned for the HTTP server, which receives their logins.
+func identitySources(cfg *config.Config) ([]identity.Source, http.Logins) {
+	var sources []identity.Source
+	var logins http.Logins
+	if cfg.IdentitySourceEnabled(identity.SourceACR122U) {
+		if source, err := nfcSource(); err != nil {
+			slog.Error("NFC reader not available", "error", err)
+		} else {
+			sources = append(sources, source)
+		}
+	} else {
+		slog.Info("NFC reader disabled")
+	}
+	if cfg.IdentitySourceEnabled(identity.SourceKeyboard) {
+		sources = append(sources, identity.Keyboard{Device: cfg.KeyboardDevice})
+	}
+	if cfg.IdentitySourceEnabled(identity.SourceWeb) {
+		logins.Web = identity.NewWeb()
+		sources = append(sources, logins.Web)
+	}
+	if cfg.IdentitySourceEnabled(identity.SourceQR) {
+		logins.QR = identity.NewQR(cfg.QRCodeTTL)
+		sources = append(sources, logins.QR)
+	}
+	return sources, logins
 }
 
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "export":
+			err = runExport(ctx, os.Args[2:])
+		case "import":
+			err = runImport(ctx, os.Args[2:])
+		case "migrate":
+			err = runMigrate(ctx, os.Args[2:])
+		case "backup":
+			err = runBackup(ctx, os.Args[2:])
+		case "restore":
+			err = runRestore(os.Args[2:])
+		case "config":
+			err = runConfig(os.Args[2:])
+		case "series":
+			err = runSeries(ctx, os.Args[2:])
+		case "events":
+			err = runEvents(ctx, os.Args[2:])
+		case "users":
+			err = runUsers(ctx, os.Args[2:])
+		case "results":
+			err = runResults(ctx, os.Args[2:])
+		case "sessions":
+			err = runSessions(ctx, os.Args[2:])
+		case "data-packs":
+			err = runDataPacks(ctx, os.Args[2:])
+		default:
+			err = fmt.Errorf("unknown command, expected one of: series, events, users, results, sessions, data-packs, export, import, migrate, backup, restore, config")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", os.Args[1], err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Setup signal handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -51,21 +138,30 @@ func main() {
 		cancel()
 	}()
 
-	db, err := database.NewDatabase(ctx, "wrc.db?access_mode=READ_WRITE")
+	cfg := getConfig()
+
+	db, err := database.NewDatabase(ctx, cfg.DatabaseDSN())
 	if err != nil {
 		slog.Error("could not open database", "error", err)
 		os.Exit(1)
 	}
 	defer db.Close()
 
-	packetCh := make(chan telemetry.TelemetryPacket, 64)
+	applyConfig(db, cfg)
+	go config.Watch(ctx, cfg, func(cfg *config.Config) {
+		applyConfig(db, cfg)
+	})
+
+	go db.ScheduleBackups(ctx)
+
+	packetCh := make(chan telemetry.TelemetryPacket, cfg.PacketBufferSize)
 	go func() {
 		for {
-			if err := telemetry.StartUDPReceiver(ctx, config.ListenUDP, packetCh); err != nil {
+			if err := telemetry.StartUDPReceiver(ctx, cfg.ListenUDP, packetCh); err != nil {
 				slog.Error("UDP receiver error", "error", err)
 
-				// Retry receiving UDP packets after 5 seconds
-				time.Sleep(5 * time.Second)
+				// Retry receiving UDP packets after a while
+				time.Sleep(getConfig().UDPRetryInterval)
 				continue
 			}
 			break
@@ -73,18 +169,23 @@ func main() {
 	}()
 
 	cardEvents := make(chan string, 1)
-	go func() {
-		err := nfc.ListenForCardEvents(ctx, cardEvents)
-		if err != nil {
-			slog.Error("could not start NFC reader", "error", err)
-		}
-	}()
+	sources, logins := identitySources(cfg)
+	for _, source := range sources {
+		go func() {
+			err := source.Listen(ctx, cardEvents)
+			if err != nil {
+				slog.Error("identity source failed", "source", source.Name(), "error", err)
+			}
+		}()
+	}
 
 	go db.ListenForUserLogins(cardEvents)
 
-	go http.StartHTTPServer(db, config.ListenHTTP)
+	b := broker.NewBroker()
+
+	go http.StartHTTPServer(db, b, logins, cfg.ListenHTTP)
 
-	go events.ProcessTelemetryEvents(ctx, db, packetCh)
+	go events.ProcessTelemetryEvents(ctx, db, b, packetCh)
 
 	<-ctx.Done()
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+)
+
+// runMigrate shows or applies the schema migrations:
+//
+//	wrc-laptimer migrate status
+//	wrc-laptimer migrate up
+func runMigrate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected command: status or up")
+	}
+
+	db, err := database.OpenDatabase(ctx, getConfig().DatabaseDSN(), false)
+	if err != nil {
+		return fmt.Errorf("could not open database: %w", err)
+	}
+	defer db.Close()
+
+	switch flags.Arg(0) {
+	case "status":
+		migrations, err := db.GetMigrations()
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			status := "pending"
+			if m.AppliedAt != nil {
+				status = "applied " + m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%03d %-30s %s\n", m.Version, m.Name, status)
+		}
+	case "up":
+		applied, err := db.Migrate()
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+		for _, m := range applied {
+			fmt.Printf("Applied %03d %s\n", m.Version, m.Name)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command: %s", flags.Arg(0))
+	}
+	return nil
+}
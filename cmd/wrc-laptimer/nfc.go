@@ -0,0 +1,12 @@
+//go:build !nopcsc
+
+package main
+
+import (
+	"github.com/majori/wrc-laptimer/internal/identity"
+	"github.com/majori/wrc-laptimer/internal/nfc"
+)
+
+func nfcSource() (identity.Source, error) {
+	return nfc.Source{}, nil
+}
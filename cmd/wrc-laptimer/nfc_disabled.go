@@ -0,0 +1,15 @@
+//go:build nopcsc
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/majori/wrc-laptimer/internal/identity"
+)
+
+// nfcSource fails in builds with the nopcsc tag, which don't need the PC/SC
+// library to build or run.
+func nfcSource() (identity.Source, error) {
+	return nil, fmt.Errorf("built without PC/SC support (nopcsc tag)")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// runResults shows the results of an ended event:
+//
+//	wrc-laptimer results show --event 3
+func runResults(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "show" {
+		return fmt.Errorf("expected command: show")
+	}
+
+	flags, server := adminFlags("results show")
+	eventID := flags.Int("event", 0, "event ID to show the results of")
+	hcMode := flags.Bool("hc", false, "show HC mode results, where only the first run counts")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *eventID == 0 {
+		return fmt.Errorf("--event is required")
+	}
+
+	a, err := openAdmin(ctx, *server)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	return printEventResults(a, *eventID, *hcMode)
+}
+
+func printEventResults(a admin, eventID int, hcMode bool) error {
+	results, err := a.GetEventResults(eventID, hcMode)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		fmt.Println("No results, results are calculated when the event ends")
+		return nil
+	}
+
+	w := newTable("POS", "DRIVER", "TIME", "GAP", "POINTS")
+	for _, r := range results {
+		gap := "-"
+		if r.Position > 1 {
+			gap = "+" + formatResultTime(r.ResultTime-results[0].ResultTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\n", r.Position, formatOptional(r.UserName), formatResultTime(r.ResultTime), gap, r.Points) //nolint:errcheck
+	}
+	return w.Flush()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/majori/wrc-laptimer/internal/http"
+)
+
+// runSeries manages race series:
+//
+//	wrc-laptimer series create --name "WRC 2025" --class 21
+//	wrc-laptimer series list
+//	wrc-laptimer series start 1
+//	wrc-laptimer series end 1
+func runSeries(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected command: create, list, start or end")
+	}
+
+	flags, server := adminFlags("series " + args[0])
+	var name *string
+	var class *uint
+	if args[0] == "create" {
+		name = flags.String("name", "", "name of the series")
+		class = flags.Uint("class", 0, "vehicle class ID the series is restricted to")
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var id int
+	switch args[0] {
+	case "create":
+		if *name == "" {
+			return fmt.Errorf("--name is required")
+		}
+	case "list":
+	case "start", "end":
+		var err error
+		if id, err = parseID(flags.Args()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown series command: %s", args[0])
+	}
+
+	a, err := openAdmin(ctx, *server)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	switch args[0] {
+	case "create":
+		id, err := a.CreateSeries(api.CreateSeriesRequest{Name: *name, VehicleClassID: optionalID(*class)})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Series %d created\n", id)
+	case "list":
+		series, err := a.ListSeries()
+		if err != nil {
+			return err
+		}
+		w := newTable("ID", "NAME", "CLASS", "EVENTS", "ACTIVE", "STARTED", "ENDED")
+		for _, s := range series {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%t\t%s\t%s\n", s.ID, s.Name, formatOptional(s.VehicleClassName), s.EventCount, s.Active, formatTimestamp(s.StartedAt), formatTimestamp(s.EndedAt)) //nolint:errcheck
+		}
+		return w.Flush()
+	case "start":
+		if err := a.StartSeries(id); err != nil {
+			return err
+		}
+		fmt.Printf("Series %d started\n", id)
+	case "end":
+		if err := a.EndSeries(id); err != nil {
+			return err
+		}
+		fmt.Printf("Series %d ended\n", id)
+	}
+	return nil
+}
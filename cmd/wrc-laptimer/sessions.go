@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+	api "github.com/majori/wrc-laptimer/internal/http"
+)
+
+// runSessions corrects finished sessions:
+//
+//	wrc-laptimer sessions corrections <id>
+//	wrc-laptimer sessions reassign [--reason text] <id> <user-id>
+//	wrc-laptimer sessions event [--reason text] <id> <event-id|none>
+//	wrc-laptimer sessions penalty [--reason text] <id> <seconds>
+//	wrc-laptimer sessions disqualify --reason text <id>
+//	wrc-laptimer sessions void --reason text <id>
+func runSessions(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected command: corrections, reassign, event, penalty, disqualify or void")
+	}
+
+	flags, server := adminFlags("sessions " + args[0])
+	reason := flags.String("reason", "", "Reason for the correction, required for disqualify and void")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var req api.SessionCorrectionRequest
+	switch args[0] {
+	case "corrections", database.CorrectionDisqualify, database.CorrectionVoid:
+		if flags.NArg() != 1 {
+			return fmt.Errorf("expected session ID")
+		}
+	case database.CorrectionReassign:
+		if flags.NArg() != 2 {
+			return fmt.Errorf("expected session ID and user ID")
+		}
+		req.UserID = flags.Arg(1)
+	case database.CorrectionEvent:
+		if flags.NArg() != 2 {
+			return fmt.Errorf("expected session ID and event ID, or none to detach")
+		}
+		if flags.Arg(1) != "none" {
+			eventID, err := parseID(flags.Args()[1:])
+			if err != nil {
+				return err
+			}
+			req.EventID = &eventID
+		}
+	case database.CorrectionPenalty:
+		if flags.NArg() != 2 {
+			return fmt.Errorf("expected session ID and penalty in seconds")
+		}
+		seconds, err := strconv.ParseFloat(flags.Arg(1), 64)
+		if err != nil {
+			return fmt.Errorf("invalid penalty: %s", flags.Arg(1))
+		}
+		req.Seconds = seconds
+	default:
+		return fmt.Errorf("unknown sessions command: %s", args[0])
+	}
+	req.Reason = *reason
+
+	sessionID, err := parseID(flags.Args()[:1])
+	if err != nil {
+		return err
+	}
+
+	a, err := openAdmin(ctx, *server)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	if args[0] != "corrections" {
+		if err := a.CorrectSession(sessionID, args[0], req); err != nil {
+			return err
+		}
+	}
+
+	corrections, err := a.GetSessionCorrections(sessionID)
+	if err != nil {
+		return err
+	}
+	w := newTable("TIME", "ACTION", "OLD", "NEW", "REASON")
+	for _, c := range corrections {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", formatTimestamp(c.CreatedAt), c.Action, formatOptional(c.OldValue), formatOptional(c.NewValue), formatOptional(c.Reason)) //nolint:errcheck
+	}
+	return w.Flush()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// runUsers manages users:
+//
+//	wrc-laptimer users list
+//	wrc-laptimer users rename <id> <name>
+//	wrc-laptimer users merge <from-id> <into-id>
+//	wrc-laptimer users cards <id>
+//	wrc-laptimer users revoke-card <card-id>
+//	wrc-laptimer users restore-card <card-id>
+func runUsers(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected command: list, rename, merge, cards, revoke-card or restore-card")
+	}
+
+	flags, server := adminFlags("users " + args[0])
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+	case "rename":
+		if flags.NArg() < 2 {
+			return fmt.Errorf("expected user ID and new name")
+		}
+	case "merge":
+		if flags.NArg() != 2 {
+			return fmt.Errorf("expected the user ID to merge and the user ID to merge into")
+		}
+	case "cards":
+		if flags.NArg() != 1 {
+			return fmt.Errorf("expected user ID")
+		}
+	case "revoke-card", "restore-card":
+		if flags.NArg() != 1 {
+			return fmt.Errorf("expected card ID")
+		}
+	default:
+		return fmt.Errorf("unknown users command: %s", args[0])
+	}
+
+	a, err := openAdmin(ctx, *server)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	switch args[0] {
+	case "list":
+		users, err := a.ListUsers()
+		if err != nil {
+			return err
+		}
+		w := newTable("ID", "NAME", "SESSIONS", "CARDS", "LAST LOGIN")
+		for _, u := range users {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", u.ID, u.Name, u.SessionCount, u.CardCount, formatTimestamp(u.LastLoginAt)) //nolint:errcheck
+		}
+		return w.Flush()
+	case "rename":
+		name := strings.Join(flags.Args()[1:], " ")
+		if err := a.RenameUser(flags.Arg(0), name); err != nil {
+			return err
+		}
+		fmt.Printf("User %s renamed to %s\n", flags.Arg(0), name)
+	case "merge":
+		if err := a.MergeUsers(flags.Arg(0), flags.Arg(1)); err != nil {
+			return err
+		}
+		fmt.Printf("User %s merged into %s\n", flags.Arg(0), flags.Arg(1))
+	case "cards":
+		cards, err := a.GetUserCards(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		w := newTable("CARD", "ADDED", "REVOKED")
+		for _, c := range cards {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.CardID, formatTimestamp(c.CreatedAt), formatTimestamp(c.RevokedAt)) //nolint:errcheck
+		}
+		return w.Flush()
+	case "revoke-card":
+		if err := a.SetCardRevoked(flags.Arg(0), true); err != nil {
+			return err
+		}
+		fmt.Printf("Card %s revoked\n", flags.Arg(0))
+	case "restore-card":
+		if err := a.SetCardRevoked(flags.Arg(0), false); err != nil {
+			return err
+		}
+		fmt.Printf("Card %s restored\n", flags.Arg(0))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package broker
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// Message is a single live event sent to the subscribers, e.g. the room screen.
+type Message struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan Message]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[chan Message]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving all published messages and a function
+// which must be called to unsubscribe when the receiver goes away.
+func (b *Broker) Subscribe() (<-chan Message, func()) {
+	ch := make(chan Message, 16)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish never blocks. Slow subscribers miss messages instead of stalling
+// the telemetry processing.
+func (b *Broker) Publish(msgType string, data any) {
+	msg := Message{Type: msgType, Data: data}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- msg:
+		default:
+			slog.Warn("dropping live message for slow subscriber", "type", msgType)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package config
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	env "github.com/caarlos0/env/v6"
+	"github.com/majori/wrc-laptimer/internal/database"
+	"github.com/majori/wrc-laptimer/internal/identity"
+)
+
+// Config file which is read if CONFIG_FILE is not set. It is optional.
+const defaultConfigFile = "wrc-laptimer.conf"
+
+// How often the config file is checked for changes
+const watchInterval = 5 * time.Second
+
+// Config holds every runtime setting. Settings are read from the config file
+// and environment variables with the same names, environment taking
+// precedence. Settings tagged with reload are applied without a restart when
+// the config file changes or the process receives SIGHUP.
+type Config struct {
+	ConfigFile string `env:"CONFIG_FILE"`
+
+	ListenUDP    string `env:"LISTEN_UDP" envDefault:"127.0.0.1:20777"`
+	ListenHTTP   string `env:"LISTEN_HTTP" envDefault:"127.0.0.1:8080"`
+	DatabasePath string `env:"DATABASE_PATH" envDefault:"wrc.db"`
+	DisableNFC   bool   `env:"DISABLE_NFC" envDefault:"false"`
+
+	// Sources through which drivers log in, see identity.Sources. DISABLE_NFC
+	// disables the acr122u source even if it's listed.
+	IdentitySources []string      `env:"IDENTITY_SOURCES" envSeparator:"," envDefault:"acr122u,web"`
+	KeyboardDevice  string        `env:"KEYBOARD_DEVICE"`
+	QRCodeTTL       time.Duration `env:"QR_CODE_TTL" envDefault:"2m"`
+
+	LogLevel         string        `env:"LOG_LEVEL" envDefault:"info" reload:"true"`
+	PacketBufferSize int           `env:"PACKET_BUFFER_SIZE" envDefault:"64"`
+	UDPRetryInterval time.Duration `env:"UDP_RETRY_INTERVAL" envDefault:"5s" reload:"true"`
+
+	// Logout policy, zero disables the rule. The user is never logged out
+	// automatically if every rule is disabled.
+	InactivityTimeout   time.Duration `env:"INACTIVITY_TIMEOUT" envDefault:"5m" reload:"true"`
+	LogoutAfterSessions int           `env:"LOGOUT_AFTER_SESSIONS" envDefault:"0" reload:"true"`
+	LogoutOnRetap       bool          `env:"LOGOUT_ON_RETAP" envDefault:"false" reload:"true"`
+
+	// A stage without telemetry for this long is abandoned, e.g. after the
+	// game has crashed, even if the user is never logged out. Zero keeps the
+	// stage open until it ends.
+	StalledSessionTimeout time.Duration `env:"STALLED_SESSION_TIMEOUT" envDefault:"5m" reload:"true"`
+
+	TelemetrySampleRate     float64  `env:"TELEMETRY_SAMPLE_RATE" envDefault:"0" reload:"true"`
+	TelemetrySampleDistance float64  `env:"TELEMETRY_SAMPLE_DISTANCE" envDefault:"0" reload:"true"`
+	TelemetryChannels       []string `env:"TELEMETRY_CHANNELS" envSeparator:"," reload:"true"`
+	TelemetryCompression    string   `env:"TELEMETRY_COMPRESSION" envDefault:"none" reload:"true"`
+
+	BackupDir      string        `env:"BACKUP_DIR" envDefault:"backups" reload:"true"`
+	BackupInterval time.Duration `env:"BACKUP_INTERVAL" envDefault:"1h" reload:"true"`
+	BackupKeep     int           `env:"BACKUP_KEEP" envDefault:"24" reload:"true"`
+}
+
+// readFile reads "KEY=value" lines. Empty lines and lines starting with # are
+// ignored, as are comments after unquoted values. Values may be quoted.
+func readFile(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNumber)
+		}
+		value = strings.TrimSpace(value)
+		if i := strings.Index(value, " #"); i >= 0 && value[0] != '"' && value[0] != '\'' {
+			value = strings.TrimSpace(value[:i])
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, scanner.Err()
+}
+
+func environment() map[string]string {
+	values := make(map[string]string)
+	for _, item := range os.Environ() {
+		if key, value, ok := strings.Cut(item, "="); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// Load reads the config file and environment variables and validates the
+// result. A missing config file is an error only if it is set explicitly.
+func Load() (*Config, error) {
+	values := environment()
+
+	path, explicit := values["CONFIG_FILE"]
+	if !explicit {
+		path = defaultConfigFile
+	}
+
+	file, err := os.Open(path)
+	switch {
+	case err == nil:
+		defer file.Close() //nolint:errcheck
+		fileValues, err := readFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+		for key, value := range values {
+			fileValues[key] = value
+		}
+		values = fileValues
+		values["CONFIG_FILE"] = path
+	case os.IsNotExist(err) && !explicit:
+	default:
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+
+	var config Config
+	if err := env.Parse(&config, env.Options{Environment: values}); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (c *Config) Validate() error {
+	if _, err := c.SlogLevel(); err != nil {
+		return err
+	}
+	if c.DatabasePath == "" {
+		return fmt.Errorf("DATABASE_PATH must not be empty")
+	}
+	if c.PacketBufferSize < 1 {
+		return fmt.Errorf("PACKET_BUFFER_SIZE must be positive: %d", c.PacketBufferSize)
+	}
+	if c.UDPRetryInterval <= 0 {
+		return fmt.Errorf("UDP_RETRY_INTERVAL must be positive: %s", c.UDPRetryInterval)
+	}
+	if c.InactivityTimeout < 0 {
+		return fmt.Errorf("INACTIVITY_TIMEOUT must not be negative: %s", c.InactivityTimeout)
+	}
+	if c.LogoutAfterSessions < 0 {
+		return fmt.Errorf("LOGOUT_AFTER_SESSIONS must not be negative: %d", c.LogoutAfterSessions)
+	}
+	if c.StalledSessionTimeout < 0 {
+		return fmt.Errorf("STALLED_SESSION_TIMEOUT must not be negative: %s", c.StalledSessionTimeout)
+	}
+	for _, source := range c.IdentitySources {
+		if !slices.Contains(identity.Sources, source) {
+			return fmt.Errorf("unknown identity source in IDENTITY_SOURCES: %s, expected one of: %s", source, strings.Join(identity.Sources, ", "))
+		}
+	}
+	if c.QRCodeTTL <= 0 {
+		return fmt.Errorf("QR_CODE_TTL must be positive: %s", c.QRCodeTTL)
+	}
+	if c.BackupInterval < 0 {
+		return fmt.Errorf("BACKUP_INTERVAL must not be negative: %s", c.BackupInterval)
+	}
+	if c.BackupKeep < 0 {
+		return fmt.Errorf("BACKUP_KEEP must not be negative: %d", c.BackupKeep)
+	}
+	return c.TelemetryStorage().Validate()
+}
+
+func (c *Config) TelemetryStorage() database.TelemetryStorage {
+	return database.TelemetryStorage{
+		SampleRate:     c.TelemetrySampleRate,
+		SampleDistance: c.TelemetrySampleDistance,
+		Channels:       c.TelemetryChannels,
+		Compression:    c.TelemetryCompression,
+	}
+}
+
+func (c *Config) BackupConfig() database.BackupConfig {
+	return database.BackupConfig{
+		Dir:      c.BackupDir,
+		Interval: c.BackupInterval,
+		Keep:     c.BackupKeep,
+	}
+}
+
+func (c *Config) LogoutPolicy() database.LogoutPolicy {
+	return database.LogoutPolicy{
+		AfterSessions: c.LogoutAfterSessions,
+		IdleTimeout:   c.InactivityTimeout,
+		OnRetap:       c.LogoutOnRetap,
+	}
+}
+
+// IdentitySourceEnabled reports whether drivers can log in through the source.
+func (c *Config) IdentitySourceEnabled(source string) bool {
+	if source == identity.SourceACR122U && c.DisableNFC {
+		return false
+	}
+	return slices.Contains(c.IdentitySources, source)
+}
+
+func (c *Config) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return level, fmt.Errorf("invalid LOG_LEVEL: %s", c.LogLevel)
+	}
+	return level, nil
+}
+
+// DatabaseDSN returns the database path with the connection options.
+func (c *Config) DatabaseDSN() string {
+	return c.DatabasePath + "?access_mode=READ_WRITE"
+}
+
+func formatValue(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case []string:
+		return strings.Join(value, ",")
+	case time.Duration:
+		return value.String()
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// Print writes the effective settings in the config file format.
+func (c *Config) Print(w io.Writer) error {
+	v := reflect.ValueOf(*c)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := field.Tag.Get("env")
+		if key == "CONFIG_FILE" {
+			continue
+		}
+		comment := ""
+		if field.Tag.Get("reload") != "true" {
+			comment = " # requires restart"
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s%s\n", key, formatValue(v.Field(i)), comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestartRequired returns the settings which differ between the configs but
+// can't be applied without a restart.
+func (c *Config) RestartRequired(other *Config) []string {
+	var keys []string
+	a, b := reflect.ValueOf(*c), reflect.ValueOf(*other)
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		if field.Tag.Get("reload") == "true" || field.Tag.Get("env") == "CONFIG_FILE" {
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			keys = append(keys, field.Tag.Get("env"))
+		}
+	}
+	return keys
+}
+
+// Watch reloads the config when the config file changes or the process
+// receives SIGHUP, and calls apply with the new config. Invalid configs are
+// logged and ignored.
+func Watch(ctx context.Context, current *Config, apply func(*Config)) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	modified := func() time.Time {
+		if current.ConfigFile == "" {
+			return time.Time{}
+		}
+		info, err := os.Stat(current.ConfigFile)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	lastModified := modified()
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if m := modified(); !m.Equal(lastModified) {
+				lastModified = m
+			} else {
+				continue
+			}
+		case <-hangup:
+		}
+
+		next, err := Load()
+		if err != nil {
+			slog.Error("failed to reload config", "error", err)
+			continue
+		}
+		if keys := current.RestartRequired(next); len(keys) > 0 {
+			slog.Warn("changed settings require a restart", "settings", keys)
+		}
+		apply(next)
+		current = next
+		slog.Info("config reloaded")
+	}
+}
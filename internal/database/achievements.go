@@ -0,0 +1,162 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/majori/wrc-laptimer/pkg/telemetry"
+)
+
+const (
+	AchievementPersonalBest = "personal_best"
+	AchievementRouteRecord  = "route_record"
+)
+
+type Achievement struct {
+	ID             int       `db:"id" json:"id"`
+	SessionID      int       `db:"session_id" json:"session_id"`
+	UserID         string    `db:"user_id" json:"user_id"`
+	RouteID        uint16    `db:"route_id" json:"route_id"`
+	VehicleClassID uint16    `db:"vehicle_class_id" json:"vehicle_class_id"`
+	Kind           string    `db:"kind" json:"kind"`
+	ResultTime     float32   `db:"result_time" json:"result_time"`
+	PreviousTime   *float32  `db:"previous_time" json:"previous_time"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+}
+
+func nullFloat32(v sql.NullFloat64) *float32 {
+	if !v.Valid {
+		return nil
+	}
+	f := float32(v.Float64)
+	return &f
+}
+
+// findAchievements compares the result of a session against the current
+// personal best and route record. It has to be called before the result is
+// stored, otherwise the session would be compared against itself.
+//
+// A first finish on a route is not counted as a personal best, but setting the
+// first time for a route and class combination counts as a record.
+func (d *Database) findAchievements(sessionID int, userID sql.NullString, pkt *telemetry.TelemetrySessionEnd) ([]Achievement, error) {
+	if !userID.Valid || pkt.StageResultStatus != stageResultStatusFinished {
+		return nil, nil
+	}
+
+	var routeID, vehicleClassID uint16
+	var shakedown bool
+	err := d.queryRow(`
+		SELECT route_id, vehicle_class_id, stage_shakedown
+		FROM sessions
+		WHERE id = ?
+	`, sessionID).Scan(&routeID, &vehicleClassID, &shakedown)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch session: %w", err)
+	}
+	if shakedown {
+		return nil, nil
+	}
+
+	var personalBest sql.NullFloat64
+	err = d.queryRow(`
+		SELECT best_time
+		FROM personal_bests
+		WHERE user_id = ? AND route_id = ? AND vehicle_class_id = ?
+	`, userID, routeID, vehicleClassID).Scan(&personalBest)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to fetch personal best: %w", err)
+	}
+
+	var record sql.NullFloat64
+	err = d.queryRow(`
+		SELECT record_time
+		FROM route_records
+		WHERE route_id = ? AND vehicle_class_id = ?
+	`, routeID, vehicleClassID).Scan(&record)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to fetch route record: %w", err)
+	}
+
+	resultTime := pkt.StageResultTime + pkt.StageResultTimePenalty
+	achievement := Achievement{
+		SessionID:      sessionID,
+		UserID:         userID.String,
+		RouteID:        routeID,
+		VehicleClassID: vehicleClassID,
+		ResultTime:     resultTime,
+	}
+
+	var achievements []Achievement
+	if personalBest.Valid && float64(resultTime) < personalBest.Float64 {
+		pb := achievement
+		pb.Kind = AchievementPersonalBest
+		pb.PreviousTime = nullFloat32(personalBest)
+		achievements = append(achievements, pb)
+	}
+	if !record.Valid || float64(resultTime) < record.Float64 {
+		rec := achievement
+		rec.Kind = AchievementRouteRecord
+		rec.PreviousTime = nullFloat32(record)
+		achievements = append(achievements, rec)
+	}
+	return achievements, nil
+}
+
+func (d *Database) storeAchievements(achievements []Achievement) error {
+	for i, a := range achievements {
+		err := d.queryRow(`
+			INSERT INTO achievements (session_id, user_id, route_id, vehicle_class_id, kind, result_time, previous_time)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			RETURNING id, created_at
+		`, a.SessionID, a.UserID, a.RouteID, a.VehicleClassID, a.Kind, a.ResultTime, a.PreviousTime).Scan(
+			&achievements[i].ID,
+			&achievements[i].CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store %s achievement: %w", a.Kind, err)
+		}
+	}
+	return nil
+}
+
+func (d *Database) GetRecentAchievements(limit int) ([]Achievement, error) {
+	rows, err := d.query(`
+		SELECT id, session_id, user_id, route_id, vehicle_class_id, kind, result_time, previous_time, created_at
+		FROM achievements
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query achievements: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	achievements := []Achievement{}
+	for rows.Next() {
+		var a Achievement
+		if err := rows.Scan(
+			&a.ID,
+			&a.SessionID,
+			&a.UserID,
+			&a.RouteID,
+			&a.VehicleClassID,
+			&a.Kind,
+			&a.ResultTime,
+			&a.PreviousTime,
+			&a.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		achievements = append(achievements, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return achievements, nil
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/majori/wrc-laptimer/pkg/telemetry"
+)
+
+func TestFindAchievements(t *testing.T) {
+	// On route 7 in class 1 a has a best of 100 s and b the record of 95 s.
+	// Route 8 has never been driven.
+	seed := []string{
+		"INSERT INTO users (id, name) VALUES ('a', 'Alice'), ('b', 'Bob'), ('c', 'Carol')",
+		`INSERT INTO sessions (user_id, route_id, vehicle_class_id, stage_shakedown, stage_result_status, stage_result_time, stage_result_time_penalty) VALUES
+			('a', 7, 1, false, 1, 104, 0),
+			('a', 7, 1, false, 1, 95, 5),
+			('b', 7, 1, false, 1, 95, 0),
+			('b', 7, 1, true, 1, 80, 0),
+			('c', 7, 1, false, 2, 70, 0)`,
+	}
+
+	finished := func(time float32) *telemetry.TelemetrySessionEnd {
+		return &telemetry.TelemetrySessionEnd{StageResultStatus: stageResultStatusFinished, StageResultTime: time}
+	}
+	tests := []struct {
+		name      string
+		userID    string
+		routeID   int
+		shakedown bool
+		pkt       *telemetry.TelemetrySessionEnd
+		// The achievements as kind and previous time, 0 if there was none
+		want map[string]float32
+	}{
+		{"first finish", "c", 7, false, finished(99), map[string]float32{}},
+		{"first finish on a new route", "c", 8, false, finished(120), map[string]float32{AchievementRouteRecord: 0}},
+		{"personal best", "a", 7, false, finished(98), map[string]float32{AchievementPersonalBest: 100}},
+		{"route record", "a", 7, false, finished(90), map[string]float32{AchievementPersonalBest: 100, AchievementRouteRecord: 95}},
+		{"record with a penalty", "a", 7, false, &telemetry.TelemetrySessionEnd{StageResultStatus: stageResultStatusFinished, StageResultTime: 90, StageResultTimePenalty: 10}, map[string]float32{}},
+		{"equal to the best", "a", 7, false, finished(100), map[string]float32{}},
+		{"slower", "a", 7, false, finished(105), map[string]float32{}},
+		{"shakedown", "a", 7, true, finished(90), map[string]float32{}},
+		{"not finished", "a", 7, false, &telemetry.TelemetrySessionEnd{StageResultStatus: 2, StageResultTime: 90}, map[string]float32{}},
+		{"no driver", "", 7, false, finished(90), map[string]float32{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDatabase(t)
+			mustExec(t, d, seed...)
+
+			// The session has no result yet, as achievements are found before
+			// it is stored
+			var sessionID int
+			err := d.queryRow(`
+				INSERT INTO sessions (route_id, vehicle_class_id, stage_shakedown)
+				VALUES (?, 1, ?)
+				RETURNING id
+			`, tt.routeID, tt.shakedown).Scan(&sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			userID := sql.NullString{String: tt.userID, Valid: tt.userID != ""}
+			achievements, err := d.findAchievements(sessionID, userID, tt.pkt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]float32{}
+			for _, a := range achievements {
+				if a.SessionID != sessionID || a.UserID != tt.userID || a.ResultTime != tt.pkt.StageResultTime+tt.pkt.StageResultTimePenalty {
+					t.Errorf("got %+v for session %d", a, sessionID)
+				}
+				got[a.Kind] = 0
+				if a.PreviousTime != nil {
+					got[a.Kind] = *a.PreviousTime
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got achievements %v, want %v", got, tt.want)
+			}
+			for kind, previous := range tt.want {
+				if p, ok := got[kind]; !ok || p != previous {
+					t.Errorf("got achievements %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// TestEndSessionAchievements checks that the achievements are found before the
+// result is stored, so the run is not compared against itself.
+func TestEndSessionAchievements(t *testing.T) {
+	d := newTestDatabase(t)
+	t.Cleanup(d.AbandonSession)
+	mustExec(t, d, "INSERT INTO users (id, name) VALUES ('a', 'Alice')")
+	if err := d.LoginUser("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := []struct {
+		time         float32
+		achievements int
+	}{
+		{100, 1}, // The first record
+		{90, 2},  // A personal best and a record
+		{110, 0},
+	}
+	for i, run := range runs {
+		if err := d.StartSession(&telemetry.TelemetrySessionStart{RouteID: 7, VehicleClassID: 1}); err != nil {
+			t.Fatal(err)
+		}
+		achievements, err := d.EndSession(&telemetry.TelemetrySessionEnd{
+			StageResultStatus: stageResultStatusFinished,
+			StageResultTime:   run.time,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(achievements) != run.achievements {
+			t.Errorf("run %d got achievements %+v, want %d", i+1, achievements, run.achievements)
+		}
+	}
+
+	stored, err := d.GetRecentAchievements(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 3 {
+		t.Errorf("stored %d achievements, want 3", len(stored))
+	}
+}
@@ -0,0 +1,279 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	fullThrottleThreshold = 0.98
+	brakeThreshold        = 0.05
+	handbrakeThreshold    = 0.5
+	clutchThreshold       = 0.1
+	steeringReversal      = 0.05
+	shiftRPMBucket        = 500
+
+	// Gaps between samples longer than this (e.g. lost packets) are not
+	// counted. Stored samples are never further apart than sampleHeartbeat
+	// while telemetry is received.
+	maxSampleInterval = 0.5 // [second]
+)
+
+type telemetrySample struct {
+	StageCurrentTime     float32
+	StageCurrentDistance float64
+	Speed                float32
+	Throttle             float32
+	Brake                float32
+	Handbrake            float32
+	Clutch               float32
+	Steering             float32
+	Gear                 uint8
+	GearNeutral          uint8
+	GearReverse          uint8
+	EngineRPM            float32
+	BrakeTemperatureFl   float32
+	BrakeTemperatureFr   float32
+	BrakeTemperatureBl   float32
+	BrakeTemperatureBr   float32
+	PositionX            float32
+	PositionY            float32
+	PositionZ            float32
+}
+
+type ShiftRPMBucket struct {
+	RPMFrom int `json:"rpm_from"`
+	RPMTo   int `json:"rpm_to"`
+	Count   int `json:"count"`
+}
+
+type BrakeTemperatures struct {
+	FrontLeft  float32 `json:"fl"`
+	FrontRight float32 `json:"fr"`
+	BackLeft   float32 `json:"bl"`
+	BackRight  float32 `json:"br"`
+}
+
+// SessionAnalysis summarises the driver inputs of a session. Times are in
+// seconds, speeds in metres per second and temperatures in degrees Celsius.
+type SessionAnalysis struct {
+	SessionID            int               `json:"session_id"`
+	SampleCount          int               `json:"sample_count"`
+	Duration             float64           `json:"duration"`
+	FullThrottleTime     float64           `json:"full_throttle_time"`
+	FullThrottleRatio    float64           `json:"full_throttle_ratio"`
+	BrakingTime          float64           `json:"braking_time"`
+	BrakingRatio         float64           `json:"braking_ratio"`
+	HandbrakeCount       int               `json:"handbrake_count"`
+	ClutchTime           float64           `json:"clutch_time"`
+	ClutchCount          int               `json:"clutch_count"`
+	AverageSpeed         float64           `json:"average_speed"`
+	PeakSpeed            float32           `json:"peak_speed"`
+	UpshiftCount         int               `json:"upshift_count"`
+	DownshiftCount       int               `json:"downshift_count"`
+	UpshiftRPM           []ShiftRPMBucket  `json:"upshift_rpm"`
+	SteeringRateAverage  float64           `json:"steering_rate_average"`
+	SteeringReversals    int               `json:"steering_reversals"`
+	BrakeTemperaturePeak BrakeTemperatures `json:"brake_temperature_peak"`
+}
+
+// getTelemetrySamples returns the telemetry of the session in the order it
+// was received. Channels which are not stored are returned as zeros.
+func (d *Database) getTelemetrySamples(sessionID int) ([]telemetrySample, error) {
+	rows, err := d.query(`
+		SELECT
+			stage_current_time,
+			stage_current_distance,
+			COALESCE(vehicle_speed, 0),
+			COALESCE(vehicle_throttle, 0),
+			COALESCE(vehicle_brake, 0),
+			COALESCE(vehicle_handbrake, 0),
+			COALESCE(vehicle_clutch, 0),
+			COALESCE(vehicle_steering, 0),
+			COALESCE(vehicle_gear_index, 0),
+			COALESCE(vehicle_gear_index_neutral, 0),
+			COALESCE(vehicle_gear_index_reverse, 0),
+			COALESCE(vehicle_engine_rpm_current, 0),
+			COALESCE(vehicle_brake_temperature_fl, 0),
+			COALESCE(vehicle_brake_temperature_fr, 0),
+			COALESCE(vehicle_brake_temperature_bl, 0),
+			COALESCE(vehicle_brake_temperature_br, 0),
+			COALESCE(vehicle_position_x, 0),
+			COALESCE(vehicle_position_y, 0),
+			COALESCE(vehicle_position_z, 0)
+		FROM telemetry
+		WHERE session_id = ?
+		ORDER BY rowid ASC
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query telemetry: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	var samples []telemetrySample
+	for rows.Next() {
+		var s telemetrySample
+		if err := rows.Scan(
+			&s.StageCurrentTime,
+			&s.StageCurrentDistance,
+			&s.Speed,
+			&s.Throttle,
+			&s.Brake,
+			&s.Handbrake,
+			&s.Clutch,
+			&s.Steering,
+			&s.Gear,
+			&s.GearNeutral,
+			&s.GearReverse,
+			&s.EngineRPM,
+			&s.BrakeTemperatureFl,
+			&s.BrakeTemperatureFr,
+			&s.BrakeTemperatureBl,
+			&s.BrakeTemperatureBr,
+			&s.PositionX,
+			&s.PositionY,
+			&s.PositionZ,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		samples = append(samples, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return samples, nil
+}
+
+// sampleInterval returns the time between two consecutive samples, or zero
+// if there is a gap in the telemetry.
+func sampleInterval(previous, current telemetrySample) float64 {
+	dt := float64(current.StageCurrentTime - previous.StageCurrentTime)
+	if dt <= 0 || dt > maxSampleInterval {
+		return 0
+	}
+	return dt
+}
+
+func isForwardGear(s telemetrySample) bool {
+	return s.Gear != s.GearNeutral && s.Gear != s.GearReverse
+}
+
+func analyzeSamples(samples []telemetrySample) SessionAnalysis {
+	analysis := SessionAnalysis{
+		SampleCount: len(samples),
+		UpshiftRPM:  []ShiftRPMBucket{},
+	}
+	if len(samples) == 0 {
+		return analysis
+	}
+
+	upshiftRPM := make(map[int]int)
+	var speedDistance, steeringTravel float64
+
+	// A steering reversal is counted when the wheel turns back more than
+	// steeringReversal from the latest extreme to the other direction
+	var steeringDirection float64
+	steeringExtreme := samples[0].Steering
+
+	analysis.PeakSpeed = samples[0].Speed
+	analysis.BrakeTemperaturePeak = BrakeTemperatures{
+		FrontLeft:  samples[0].BrakeTemperatureFl,
+		FrontRight: samples[0].BrakeTemperatureFr,
+		BackLeft:   samples[0].BrakeTemperatureBl,
+		BackRight:  samples[0].BrakeTemperatureBr,
+	}
+	for i := 1; i < len(samples); i++ {
+		previous, current := samples[i-1], samples[i]
+		dt := sampleInterval(previous, current)
+
+		analysis.Duration += dt
+		speedDistance += float64(current.Speed) * dt
+		analysis.PeakSpeed = max(analysis.PeakSpeed, current.Speed)
+
+		if current.Throttle >= fullThrottleThreshold {
+			analysis.FullThrottleTime += dt
+		}
+		if current.Brake > brakeThreshold {
+			analysis.BrakingTime += dt
+		}
+		if current.Clutch > clutchThreshold {
+			analysis.ClutchTime += dt
+			if previous.Clutch <= clutchThreshold {
+				analysis.ClutchCount++
+			}
+		}
+		if current.Handbrake > handbrakeThreshold && previous.Handbrake <= handbrakeThreshold {
+			analysis.HandbrakeCount++
+		}
+
+		if isForwardGear(previous) && isForwardGear(current) && current.Gear != previous.Gear {
+			if current.Gear > previous.Gear {
+				analysis.UpshiftCount++
+				upshiftRPM[int(previous.EngineRPM)/shiftRPMBucket]++
+			} else {
+				analysis.DownshiftCount++
+			}
+		}
+
+		if dt > 0 {
+			steeringTravel += math.Abs(float64(current.Steering - previous.Steering))
+		}
+		switch delta := float64(current.Steering - steeringExtreme); {
+		case delta*steeringDirection > 0:
+			steeringExtreme = current.Steering
+		case math.Abs(delta) > steeringReversal:
+			if steeringDirection != 0 {
+				analysis.SteeringReversals++
+			}
+			steeringDirection = math.Copysign(1, delta)
+			steeringExtreme = current.Steering
+		}
+
+		analysis.BrakeTemperaturePeak.FrontLeft = max(analysis.BrakeTemperaturePeak.FrontLeft, current.BrakeTemperatureFl)
+		analysis.BrakeTemperaturePeak.FrontRight = max(analysis.BrakeTemperaturePeak.FrontRight, current.BrakeTemperatureFr)
+		analysis.BrakeTemperaturePeak.BackLeft = max(analysis.BrakeTemperaturePeak.BackLeft, current.BrakeTemperatureBl)
+		analysis.BrakeTemperaturePeak.BackRight = max(analysis.BrakeTemperaturePeak.BackRight, current.BrakeTemperatureBr)
+	}
+
+	if analysis.Duration > 0 {
+		analysis.FullThrottleRatio = analysis.FullThrottleTime / analysis.Duration
+		analysis.BrakingRatio = analysis.BrakingTime / analysis.Duration
+		analysis.AverageSpeed = speedDistance / analysis.Duration
+		analysis.SteeringRateAverage = steeringTravel / analysis.Duration
+	}
+
+	for bucket := range upshiftRPM {
+		analysis.UpshiftRPM = append(analysis.UpshiftRPM, ShiftRPMBucket{
+			RPMFrom: bucket * shiftRPMBucket,
+			RPMTo:   (bucket + 1) * shiftRPMBucket,
+			Count:   upshiftRPM[bucket],
+		})
+	}
+	sort.Slice(analysis.UpshiftRPM, func(i, j int) bool {
+		return analysis.UpshiftRPM[i].RPMFrom < analysis.UpshiftRPM[j].RPMFrom
+	})
+
+	return analysis
+}
+
+// AnalyzeSession computes the driver input analysis from the retained
+// telemetry of the session. Returns nil if there is no telemetry.
+func (d *Database) AnalyzeSession(sessionID int) (*SessionAnalysis, error) {
+	samples, err := d.getTelemetrySamples(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, nil
+	}
+
+	analysis := analyzeSamples(samples)
+	analysis.SessionID = sessionID
+	return &analysis, nil
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAnalyzeSamplesDuration(t *testing.T) {
+	samples := func(times ...float32) []telemetrySample {
+		s := make([]telemetrySample, len(times))
+		for i, time := range times {
+			s[i] = telemetrySample{StageCurrentTime: time, Speed: 10, Throttle: 1}
+		}
+		return s
+	}
+	tests := []struct {
+		name     string
+		samples  []telemetrySample
+		duration float64
+	}{
+		{"no samples", nil, 0},
+		{"every packet", samples(0, 1.0/60, 2.0/60, 3.0/60), 3.0 / 60},
+		{"heartbeat", samples(0, 0.25, 0.5, 0.75, 1), 1},
+		{"lost packets", samples(0, 0.25, 3, 3.25), 0.5},
+		{"restarted time", samples(0, 0.25, 0, 0.25), 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis := analyzeSamples(tt.samples)
+			if math.Abs(analysis.Duration-tt.duration) > 1e-6 {
+				t.Errorf("duration = %f, want %f", analysis.Duration, tt.duration)
+			}
+			if tt.duration > 0 && math.Abs(analysis.FullThrottleRatio-1) > 1e-6 {
+				t.Errorf("full throttle ratio = %f, want 1", analysis.FullThrottleRatio)
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Scheduled backups are rotated, other backups (e.g. before ending an event)
+// are kept until removed by hand
+const scheduledBackupReason = "scheduled"
+
+// BackupConfig controls where and how often the database is backed up.
+type BackupConfig struct {
+	// Directory for the backups. Empty disables backups.
+	Dir string
+	// Interval of scheduled backups. Zero disables scheduled backups.
+	Interval time.Duration
+	// Number of scheduled backups to keep. Zero keeps every backup.
+	Keep int
+}
+
+// SetBackup changes the backup settings. Waits for a running backup to finish.
+func (d *Database) SetBackup(config BackupConfig) {
+	d.backupMu.Lock()
+	defer d.backupMu.Unlock()
+	d.backupConfig = config
+}
+
+func (d *Database) getBackupConfig() BackupConfig {
+	d.backupMu.Lock()
+	defer d.backupMu.Unlock()
+	return d.backupConfig
+}
+
+func (d *Database) backupName() string {
+	name := strings.TrimSuffix(filepath.Base(d.path), filepath.Ext(d.path))
+	if name == "" || name == "." || name == ":memory:" {
+		return "memory"
+	}
+	return name
+}
+
+// Backup copies the whole database to a new file in the backup directory.
+// The copy is a consistent snapshot, so it can be taken while telemetry is
+// being stored. Returns the path of the backup.
+func (d *Database) Backup(reason string) (string, error) {
+	d.backupMu.Lock()
+	defer d.backupMu.Unlock()
+
+	if d.backupConfig.Dir == "" {
+		return "", fmt.Errorf("backup directory is not configured")
+	}
+
+	if err := os.MkdirAll(d.backupConfig.Dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	backupPath := filepath.Join(d.backupConfig.Dir, fmt.Sprintf("%s-%s-%s.db", d.backupName(), reason, time.Now().Format("20060102-150405")))
+	if _, err := os.Stat(backupPath); err == nil {
+		return "", fmt.Errorf("backup %s already exists", backupPath)
+	}
+
+	// The attached database is bound to the connection
+	conn, err := d.db.Conn(d.ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	var database string
+	if err := conn.QueryRowContext(d.ctx, "SELECT current_database()").Scan(&database); err != nil {
+		return "", fmt.Errorf("failed to get database name: %w", err)
+	}
+
+	if _, err := conn.ExecContext(d.ctx, fmt.Sprintf("ATTACH %s AS backup_target", quoteString(backupPath))); err != nil {
+		return "", fmt.Errorf("failed to create backup: %w", err)
+	}
+	err = copyDatabase(d.ctx, conn, database, "backup_target")
+	if _, detachErr := conn.ExecContext(d.ctx, "DETACH backup_target"); detachErr != nil && err == nil {
+		err = detachErr
+	}
+	if err != nil {
+		os.Remove(backupPath) //nolint:errcheck
+		return "", fmt.Errorf("failed to copy database to backup: %w", err)
+	}
+
+	if reason == scheduledBackupReason {
+		if err := d.rotateBackups(); err != nil {
+			return backupPath, err
+		}
+	}
+	return backupPath, nil
+}
+
+func quoteIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+type foreignKey struct {
+	table            string
+	referencedTable  string
+	column           string
+	referencedColumn string
+}
+
+// copyDatabase copies the schema and data of the source database to the
+// attached target database in one transaction. COPY FROM DATABASE doesn't
+// order the tables by their foreign keys, so the data is copied table by
+// table with the referenced tables first.
+func copyDatabase(ctx context.Context, conn *sql.Conn, source, target string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	// Sequences are copied with their current values
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("COPY FROM DATABASE %s TO %s (SCHEMA)", quoteIdentifier(source), quoteIdentifier(target)))
+	if err != nil {
+		return fmt.Errorf("failed to copy schema: %w", err)
+	}
+
+	var tables []string
+	rows, err := tx.QueryContext(ctx, `
+		SELECT table_name
+		FROM duckdb_tables()
+		WHERE database_name = ? AND NOT temporary
+		ORDER BY table_name
+	`, source)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close() //nolint:errcheck
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	var foreignKeys []foreignKey
+	rows, err = tx.QueryContext(ctx, `
+		SELECT table_name, referenced_table, constraint_column_names[1], referenced_column_names[1]
+		FROM duckdb_constraints()
+		WHERE database_name = ? AND constraint_type = 'FOREIGN KEY'
+	`, source)
+	if err != nil {
+		return fmt.Errorf("failed to list foreign keys: %w", err)
+	}
+	for rows.Next() {
+		var fk foreignKey
+		if err := rows.Scan(&fk.table, &fk.referencedTable, &fk.column, &fk.referencedColumn); err != nil {
+			rows.Close() //nolint:errcheck
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		foreignKeys = append(foreignKeys, fk)
+	}
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	copied := make(map[string]bool)
+	for len(copied) < len(tables) {
+		progress := false
+		for _, table := range tables {
+			if copied[table] {
+				continue
+			}
+
+			ready := true
+			var selfReference *foreignKey
+			for i, fk := range foreignKeys {
+				if fk.table != table {
+					continue
+				}
+				if fk.referencedTable == table {
+					selfReference = &foreignKeys[i]
+				} else if !copied[fk.referencedTable] {
+					ready = false
+				}
+			}
+			if !ready {
+				continue
+			}
+
+			if err := copyTable(ctx, tx, source, target, table, selfReference); err != nil {
+				return err
+			}
+			copied[table] = true
+			progress = true
+		}
+		if !progress {
+			return fmt.Errorf("foreign keys between tables form a cycle")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit copy: %w", err)
+	}
+	return nil
+}
+
+// copyTable copies the rows in the order they were inserted. Rows of a table
+// referencing itself are copied parents first, as the foreign key is checked
+// against the rows inserted by earlier statements only.
+func copyTable(ctx context.Context, tx *sql.Tx, source, target, table string, selfReference *foreignKey) error {
+	from := quoteIdentifier(source) + "." + quoteIdentifier(table)
+	to := quoteIdentifier(target) + "." + quoteIdentifier(table)
+
+	if selfReference == nil {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s SELECT * FROM %s ORDER BY rowid", to, from))
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", table, err)
+		}
+		return nil
+	}
+
+	column := quoteIdentifier(selfReference.column)
+	key := quoteIdentifier(selfReference.referencedColumn)
+	for {
+		n, err := execCount(ctx, tx, fmt.Sprintf(`
+			INSERT INTO %[1]s
+			SELECT *
+			FROM %[2]s
+			WHERE %[4]s NOT IN (SELECT %[4]s FROM %[1]s)
+				AND (%[3]s IS NULL OR %[3]s IN (SELECT %[4]s FROM %[1]s))
+			ORDER BY rowid
+		`, to, from, column, key))
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", table, err)
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// rotateBackups removes the oldest scheduled backups so that only the
+// configured number of them is kept.
+func (d *Database) rotateBackups() error {
+	if d.backupConfig.Keep <= 0 {
+		return nil
+	}
+
+	backups, err := filepath.Glob(filepath.Join(d.backupConfig.Dir, fmt.Sprintf("%s-%s-*.db", d.backupName(), scheduledBackupReason)))
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+	// Timestamps in the names sort chronologically
+	sort.Strings(backups)
+	for len(backups) > d.backupConfig.Keep {
+		if err := os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// backupBefore takes a backup before an important change, e.g. ending an
+// event. A failed backup is logged but doesn't prevent the change.
+func (d *Database) backupBefore(reason string) {
+	if d.getBackupConfig().Dir == "" {
+		return
+	}
+	backupPath, err := d.Backup(reason)
+	if err != nil {
+		slog.Error("failed to back up database", "reason", reason, "error", err)
+		return
+	}
+	slog.Info("database backed up", "path", backupPath)
+}
+
+// ScheduleBackups backs up the database at the configured interval until the
+// context is cancelled. Changes to the interval apply after the next backup.
+func (d *Database) ScheduleBackups(ctx context.Context) {
+	// While scheduled backups are disabled, the settings are checked this often
+	const disabledInterval = time.Minute
+
+	next := func() time.Duration {
+		config := d.getBackupConfig()
+		if config.Dir == "" || config.Interval <= 0 {
+			return disabledInterval
+		}
+		return config.Interval
+	}
+
+	timer := time.NewTimer(next())
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			config := d.getBackupConfig()
+			if config.Dir != "" && config.Interval > 0 {
+				backupPath, err := d.Backup(scheduledBackupReason)
+				if err != nil {
+					slog.Error("scheduled backup failed", "error", err)
+				} else {
+					slog.Info("database backed up", "path", backupPath)
+				}
+			}
+			timer.Reset(next())
+		}
+	}
+}
+
+// RestoreBackup replaces the database file with the backup. The database must
+// not be open. The replaced database is kept next to it and its path is
+// returned.
+func RestoreBackup(backupPath, databasePath string) (string, error) {
+	databasePath = strings.SplitN(databasePath, "?", 2)[0]
+
+	// Make sure the backup is a readable database before touching anything
+	backup, err := sql.Open("duckdb", backupPath+"?access_mode=READ_ONLY")
+	if err != nil {
+		return "", fmt.Errorf("failed to open backup: %w", err)
+	}
+	var version sql.NullInt32
+	err = backup.QueryRow("SELECT max(version) FROM schema_version").Scan(&version)
+	if closeErr := backup.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	var replacedPath string
+	if _, err := os.Stat(databasePath); err == nil {
+		replacedPath = fmt.Sprintf("%s.pre-restore-%s", databasePath, time.Now().Format("20060102-150405"))
+		if err := os.Rename(databasePath, replacedPath); err != nil {
+			return "", fmt.Errorf("failed to move current database: %w", err)
+		}
+		// The write-ahead log belongs to the replaced database
+		if _, err := os.Stat(databasePath + ".wal"); err == nil {
+			if err := os.Rename(databasePath+".wal", replacedPath+".wal"); err != nil {
+				return "", fmt.Errorf("failed to move current database log: %w", err)
+			}
+		}
+	}
+
+	source, err := os.Open(backupPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer source.Close() //nolint:errcheck
+
+	target, err := os.OpenFile(databasePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create database file: %w", err)
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close() //nolint:errcheck
+		return "", fmt.Errorf("failed to copy backup: %w", err)
+	}
+	if err := target.Close(); err != nil {
+		return "", fmt.Errorf("failed to close database file: %w", err)
+	}
+	return replacedPath, nil
+}
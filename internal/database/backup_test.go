@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.db")
+	d, err := NewDatabase(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Child series reference their parent, so they must be copied after it
+	mustExec(t, d,
+		"INSERT INTO users (id, name) VALUES ('a', 'Alice')",
+		"INSERT INTO race_series (name) VALUES ('Parent')",
+		"INSERT INTO race_series (name, parent_series) VALUES ('Child', 1)",
+		"INSERT INTO race_series (name, parent_series) VALUES ('Grandchild', 2)",
+	)
+
+	if _, err := d.Backup("manual"); err == nil {
+		t.Error("backup without a directory succeeded")
+	}
+	d.SetBackup(BackupConfig{Dir: filepath.Join(dir, "backups")})
+	backupPath, err := d.Backup("manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustExec(t, d, "DELETE FROM users", "INSERT INTO users (id, name) VALUES ('b', 'Bob')")
+	d.Close()
+
+	replacedPath, err := RestoreBackup(backupPath, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(replacedPath); err != nil {
+		t.Errorf("replaced database is not kept: %v", err)
+	}
+
+	d, err = NewDatabase(context.Background(), path)
+	if err != nil {
+		t.Fatalf("failed to open restored database: %v", err)
+	}
+	defer d.Close()
+
+	var users string
+	if err := d.queryRow("SELECT string_agg(id, ',' ORDER BY id) FROM users").Scan(&users); err != nil {
+		t.Fatal(err)
+	}
+	if users != "a" {
+		t.Errorf("got users %s, want a", users)
+	}
+	var series string
+	if err := d.queryRow("SELECT string_agg(name || ':' || COALESCE(parent_series::TEXT, ''), ',' ORDER BY id) FROM race_series").Scan(&series); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Parent:,Child:1,Grandchild:2"; series != want {
+		t.Errorf("got series %s, want %s", series, want)
+	}
+
+	// The sequences continue from where they were
+	mustExec(t, d, "INSERT INTO race_series (name) VALUES ('New')")
+	var id int
+	if err := d.queryRow("SELECT id FROM race_series WHERE name = 'New'").Scan(&id); err != nil || id != 4 {
+		t.Errorf("got new series ID %d (%v), want 4", id, err)
+	}
+}
+
+func TestRestoreInvalidBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.db")
+	backupPath := filepath.Join(dir, "backup.db")
+	if err := os.WriteFile(backupPath, []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("current"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RestoreBackup(backupPath, path); err == nil {
+		t.Fatal("restored an invalid backup")
+	}
+	if content, err := os.ReadFile(path); err != nil || string(content) != "current" {
+		t.Errorf("database changed after a failed restore: %q (%v)", content, err)
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	tests := []struct {
+		keep int
+		want []string
+	}{
+		{0, []string{
+			"test-manual-20250101-000000.db",
+			"test-scheduled-20250101-000000.db",
+			"test-scheduled-20250102-000000.db",
+			"test-scheduled-20250103-000000.db",
+		}},
+		{2, []string{
+			"test-manual-20250101-000000.db",
+			"test-scheduled-20250102-000000.db",
+			"test-scheduled-20250103-000000.db",
+		}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for _, name := range []string{
+			"test-scheduled-20250103-000000.db",
+			"test-scheduled-20250101-000000.db",
+			"test-manual-20250101-000000.db",
+			"test-scheduled-20250102-000000.db",
+		} {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		d := &Database{path: filepath.Join(dir, "test.db"), backupConfig: BackupConfig{Dir: dir, Keep: tt.keep}}
+		if err := d.rotateBackups(); err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Name())
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("keep %d: got %v, want %v", tt.keep, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("keep %d: got %v, want %v", tt.keep, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UserCard links a card to a user. Users can have several cards, e.g. a
+// replacement for a lost card or the NFC of their phone.
+type UserCard struct {
+	CardID    string     `json:"card_id"`
+	UserID    string     `json:"user_id"`
+	CreatedAt *time.Time `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// GetCard returns the card, or nil if the card has never been used.
+func (d *Database) GetCard(cardID string) (*UserCard, error) {
+	var card UserCard
+	err := d.queryRow(`
+		SELECT card_id, user_id, created_at, revoked_at
+		FROM user_cards
+		WHERE card_id = ?
+	`, cardID).Scan(&card.CardID, &card.UserID, &card.CreatedAt, &card.RevokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No card found
+		}
+		return nil, fmt.Errorf("could not get card: %w", err)
+	}
+	return &card, nil
+}
+
+// GetActiveCard returns the oldest card of the user which is not revoked, or
+// nil if the user has none.
+func (d *Database) GetActiveCard(userID string) (*UserCard, error) {
+	var card UserCard
+	err := d.queryRow(`
+		SELECT card_id, user_id, created_at, revoked_at
+		FROM user_cards
+		WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY created_at
+		LIMIT 1
+	`, userID).Scan(&card.CardID, &card.UserID, &card.CreatedAt, &card.RevokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No active card
+		}
+		return nil, fmt.Errorf("could not get active card: %w", err)
+	}
+	return &card, nil
+}
+
+func (d *Database) GetUserCards(userID string) ([]UserCard, error) {
+	rows, err := d.query(`
+		SELECT card_id, user_id, created_at, revoked_at
+		FROM user_cards
+		WHERE user_id = ?
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get cards: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	cards := []UserCard{}
+	for rows.Next() {
+		var card UserCard
+		if err := rows.Scan(&card.CardID, &card.UserID, &card.CreatedAt, &card.RevokedAt); err != nil {
+			return nil, fmt.Errorf("could not scan card: %w", err)
+		}
+		cards = append(cards, card)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return cards, nil
+}
+
+// SetCardRevoked revokes the card so that it can't be used to log in, or
+// restores a revoked card.
+func (d *Database) SetCardRevoked(cardID string, revoked bool) error {
+	query := "UPDATE user_cards SET revoked_at = CURRENT_TIMESTAMP WHERE card_id = ? AND revoked_at IS NULL"
+	if !revoked {
+		query = "UPDATE user_cards SET revoked_at = NULL WHERE card_id = ? AND revoked_at IS NOT NULL"
+	}
+	result, err := d.exec(query, cardID)
+	if err != nil {
+		return fmt.Errorf("could not update card: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		card, err := d.GetCard(cardID)
+		if err != nil {
+			return err
+		}
+		if card == nil {
+			return fmt.Errorf("card %s does not exist", cardID)
+		}
+	}
+	return nil
+}
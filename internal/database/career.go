@@ -0,0 +1,345 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// careerFavouriteCount is the number of favourite vehicles and routes listed
+// in career statistics.
+const careerFavouriteCount = 5
+
+type CareerStateCount struct {
+	StateID int    `json:"state_id"`
+	State   string `json:"state"`
+	Count   int    `json:"count"`
+}
+
+type CareerFavourite struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Sessions int    `json:"sessions"`
+}
+
+// CareerResults counts the event results of a driver in one scoring mode.
+// Titles are series won.
+type CareerResults struct {
+	Events  int `json:"events"`
+	Wins    int `json:"wins"`
+	Podiums int `json:"podiums"`
+	Titles  int `json:"titles"`
+}
+
+type CareerBest struct {
+	RouteID        int     `json:"route_id"`
+	Route          string  `json:"route"`
+	Location       string  `json:"location"`
+	VehicleClassID int     `json:"vehicle_class_id"`
+	VehicleClass   string  `json:"vehicle_class"`
+	BestTime       float64 `json:"best_time"` // [second]
+	SessionID      int     `json:"session_id"`
+	FinishCount    int     `json:"finish_count"`
+	Record         bool    `json:"record"`
+}
+
+type CareerProgress struct {
+	SessionID int       `json:"session_id"`
+	StartedAt time.Time `json:"started_at"`
+	Time      float64   `json:"time"`      // [second]
+	BestTime  float64   `json:"best_time"` // Best time so far [second]
+}
+
+// CareerImprovement follows the finishes of a driver on the route and class
+// they have finished most often. Improvement is how much faster the best time
+// is than the first one.
+type CareerImprovement struct {
+	RouteID        int              `json:"route_id"`
+	Route          string           `json:"route"`
+	VehicleClassID int              `json:"vehicle_class_id"`
+	VehicleClass   string           `json:"vehicle_class"`
+	Improvement    float64          `json:"improvement"` // [second]
+	Sessions       []CareerProgress `json:"sessions"`
+}
+
+// CareerStats summarises everything a driver has done. Voided sessions and
+// sessions which never ended are not counted.
+type CareerStats struct {
+	UserID            string             `json:"user_id"`
+	Sessions          int                `json:"sessions"`
+	Finishes          int                `json:"finishes"`
+	DNFs              int                `json:"dnfs"`
+	States            []CareerStateCount `json:"states"`
+	Distance          float64            `json:"distance"` // [kilometre]
+	FavouriteVehicles []CareerFavourite  `json:"favourite_vehicles"`
+	FavouriteRoutes   []CareerFavourite  `json:"favourite_routes"`
+	Results           CareerResults      `json:"results"`
+	HCResults         CareerResults      `json:"hc_results"`
+	PersonalBests     []CareerBest       `json:"personal_bests"`
+	Improvement       *CareerImprovement `json:"improvement"`
+}
+
+// careerRunsSQL selects the counted sessions of the driver as the "runs"
+// table used by runDistancesSQL.
+const careerRunsSQL = `
+	WITH runs AS (
+		SELECT *
+		FROM sessions
+		WHERE user_id = ?
+			AND stage_result_status IS NOT NULL
+			AND stage_result_status != ?
+	)
+`
+
+func (d *Database) GetCareerStats(userID string) (*CareerStats, error) {
+	stats := &CareerStats{UserID: userID}
+
+	var err error
+	if stats.States, err = d.getCareerStates(userID); err != nil {
+		return nil, err
+	}
+	for _, state := range stats.States {
+		stats.Sessions += state.Count
+		if state.StateID == stageResultStatusFinished {
+			stats.Finishes += state.Count
+		}
+	}
+	stats.DNFs = stats.Sessions - stats.Finishes
+
+	err = d.queryRow(careerRunsSQL+`
+		SELECT COALESCE(sum(distance), 0) / 1000 FROM (`+runDistancesSQL+`)
+	`, userID, stageResultVoided, stageResultStatusFinished).Scan(&stats.Distance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query distance: %w", err)
+	}
+
+	stats.FavouriteVehicles, err = d.getCareerFavourites(userID, `
+		SELECT r.vehicle_id, COALESCE(v.name, 'Unknown'), count(*) AS sessions
+		FROM runs r
+		LEFT JOIN vehicles v ON v.id = r.vehicle_id
+		WHERE r.vehicle_id IS NOT NULL
+		GROUP BY r.vehicle_id, v.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query favourite vehicles: %w", err)
+	}
+	stats.FavouriteRoutes, err = d.getCareerFavourites(userID, `
+		SELECT r.route_id, COALESCE(rt.name || ', ' || l.name, rt.name, 'Unknown'), count(*) AS sessions
+		FROM runs r
+		LEFT JOIN routes rt ON rt.id = r.route_id
+		LEFT JOIN locations l ON l.id = rt.location_id
+		WHERE r.route_id IS NOT NULL
+		GROUP BY r.route_id, rt.name, l.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query favourite routes: %w", err)
+	}
+
+	if stats.Results, err = d.getCareerResults(userID, false); err != nil {
+		return nil, err
+	}
+	if stats.HCResults, err = d.getCareerResults(userID, true); err != nil {
+		return nil, err
+	}
+	if stats.PersonalBests, err = d.getCareerBests(userID); err != nil {
+		return nil, err
+	}
+	if stats.Improvement, err = d.getCareerImprovement(userID); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (d *Database) getCareerStates(userID string) ([]CareerStateCount, error) {
+	rows, err := d.query(`
+		SELECT st.id, st.name, count(*)
+		FROM sessions s
+		JOIN stage_result_states st ON st.id = s.stage_result_status
+		WHERE s.user_id = ? AND s.stage_result_status != ?
+		GROUP BY st.id, st.name
+		ORDER BY st.id
+	`, userID, stageResultVoided)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query result states: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	states := []CareerStateCount{}
+	for rows.Next() {
+		var state CareerStateCount
+		if err := rows.Scan(&state.StateID, &state.State, &state.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
+
+// getCareerFavourites runs a query over the runs of the driver which selects
+// the ID, name and session count of something, and returns the most common.
+func (d *Database) getCareerFavourites(userID string, query string) ([]CareerFavourite, error) {
+	rows, err := d.query(careerRunsSQL+`
+		SELECT * FROM (`+query+`)
+		ORDER BY sessions DESC, 1
+		LIMIT ?
+	`, userID, stageResultVoided, careerFavouriteCount)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	favourites := []CareerFavourite{}
+	for rows.Next() {
+		var favourite CareerFavourite
+		if err := rows.Scan(&favourite.ID, &favourite.Name, &favourite.Sessions); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		favourites = append(favourites, favourite)
+	}
+	return favourites, rows.Err()
+}
+
+func (d *Database) getCareerResults(userID string, hcMode bool) (CareerResults, error) {
+	var results CareerResults
+	err := d.queryRow(`
+		SELECT
+			count(*),
+			count(*) FILTER (WHERE position = 1),
+			count(*) FILTER (WHERE position <= 3)
+		FROM results
+		WHERE user_id = ? AND hc_mode = ?
+	`, userID, hcMode).Scan(&results.Events, &results.Wins, &results.Podiums)
+	if err != nil {
+		return results, fmt.Errorf("failed to query results: %w", err)
+	}
+
+	err = d.queryRow(`
+		SELECT count(*)
+		FROM series_results
+		WHERE user_id = ? AND hc_mode = ? AND position = 1
+	`, userID, hcMode).Scan(&results.Titles)
+	if err != nil {
+		return results, fmt.Errorf("failed to query series results: %w", err)
+	}
+	return results, nil
+}
+
+func (d *Database) getCareerBests(userID string) ([]CareerBest, error) {
+	rows, err := d.query(`
+		SELECT
+			pb.route_id,
+			COALESCE(r.name, 'Unknown'),
+			COALESCE(l.name, 'Unknown'),
+			pb.vehicle_class_id,
+			COALESCE(vc.name, 'Unknown'),
+			pb.best_time,
+			pb.session_id,
+			pb.finish_count,
+			rr.session_id = pb.session_id
+		FROM personal_bests pb
+		LEFT JOIN routes r ON r.id = pb.route_id
+		LEFT JOIN locations l ON l.id = r.location_id
+		LEFT JOIN vehicle_classes vc ON vc.id = pb.vehicle_class_id
+		JOIN route_records rr ON rr.route_id = pb.route_id AND rr.vehicle_class_id = pb.vehicle_class_id
+		WHERE pb.user_id = ? AND pb.route_id IS NOT NULL AND pb.vehicle_class_id IS NOT NULL
+		ORDER BY l.name, r.name, vc.name
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query personal bests: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	bests := []CareerBest{}
+	for rows.Next() {
+		var best CareerBest
+		if err := rows.Scan(
+			&best.RouteID,
+			&best.Route,
+			&best.Location,
+			&best.VehicleClassID,
+			&best.VehicleClass,
+			&best.BestTime,
+			&best.SessionID,
+			&best.FinishCount,
+			&best.Record,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		bests = append(bests, best)
+	}
+	return bests, rows.Err()
+}
+
+// getCareerImprovement returns the progress on the route and class the driver
+// has finished most often, or nil if they have never finished.
+func (d *Database) getCareerImprovement(userID string) (*CareerImprovement, error) {
+	var improvement CareerImprovement
+	err := d.queryRow(`
+		SELECT pb.route_id, COALESCE(r.name, 'Unknown'), pb.vehicle_class_id, COALESCE(vc.name, 'Unknown')
+		FROM personal_bests pb
+		LEFT JOIN routes r ON r.id = pb.route_id
+		LEFT JOIN vehicle_classes vc ON vc.id = pb.vehicle_class_id
+		WHERE pb.user_id = ? AND pb.route_id IS NOT NULL AND pb.vehicle_class_id IS NOT NULL
+		ORDER BY pb.finish_count DESC, pb.route_id, pb.vehicle_class_id
+		LIMIT 1
+	`, userID).Scan(&improvement.RouteID, &improvement.Route, &improvement.VehicleClassID, &improvement.VehicleClass)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query most driven route: %w", err)
+	}
+
+	// The same conditions as in the personal_bests view
+	rows, err := d.query(`
+		SELECT
+			id,
+			started_at,
+			stage_result_time + stage_result_time_penalty AS time,
+			min(stage_result_time + stage_result_time_penalty) OVER (ORDER BY started_at, id)
+		FROM sessions
+		WHERE user_id = ?
+			AND route_id = ?
+			AND vehicle_class_id = ?
+			AND stage_result_status = ?
+			AND stage_shakedown IS FALSE
+		ORDER BY started_at, id
+	`, userID, improvement.RouteID, improvement.VehicleClassID, stageResultStatusFinished)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query progress: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	improvement.Sessions = []CareerProgress{}
+	for rows.Next() {
+		var progress CareerProgress
+		if err := rows.Scan(&progress.SessionID, &progress.StartedAt, &progress.Time, &progress.BestTime); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		improvement.Sessions = append(improvement.Sessions, progress)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	if n := len(improvement.Sessions); n > 0 {
+		improvement.Improvement = improvement.Sessions[0].Time - improvement.Sessions[n-1].BestTime
+	}
+	return &improvement, nil
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"fmt"
+)
+
+// RouteComparison compares the personal bests of two drivers on a route and
+// class. Gap is the time of the first driver minus the second, so a negative
+// gap means the first driver is faster.
+type RouteComparison struct {
+	RouteID        int        `json:"route_id"`
+	Route          string     `json:"route"`
+	Location       string     `json:"location"`
+	VehicleClassID int        `json:"vehicle_class_id"`
+	VehicleClass   string     `json:"vehicle_class"`
+	BestTimes      [2]float64 `json:"best_times"` // [second]
+	Gap            float64    `json:"gap"`        // [second]
+	GapPercent     float64    `json:"gap_percent"`
+	FasterUserID   string     `json:"faster_user_id"`
+}
+
+// EventComparison is an event where both drivers have a result.
+type EventComparison struct {
+	RaceEventID  int    `json:"race_event_id"`
+	Name         string `json:"name"`
+	Positions    [2]int `json:"positions"`
+	WinnerUserID string `json:"winner_user_id"`
+}
+
+// Comparison is a head to head between two drivers over the routes and classes
+// both have finished and the events both have a result in. The counts and
+// gaps are in the order of UserIDs, and the average gap is negative when the
+// first driver is faster.
+type Comparison struct {
+	UserIDs           [2]string         `json:"user_ids"`
+	Names             [2]string         `json:"names"`
+	FasterRoutes      [2]int            `json:"faster_routes"`
+	AverageGap        float64           `json:"average_gap"` // [second]
+	AverageGapPercent float64           `json:"average_gap_percent"`
+	FasterUserID      string            `json:"faster_user_id"`
+	EventWins         [2]int            `json:"event_wins"`
+	Routes            []RouteComparison `json:"routes"`
+	Events            []EventComparison `json:"events"`
+}
+
+// CompareUsers builds the head to head between two existing users. Event
+// results are compared in the scoring mode chosen with hcMode.
+func (d *Database) CompareUsers(first *User, second *User, hcMode bool) (*Comparison, error) {
+	comparison := &Comparison{
+		UserIDs: [2]string{first.ID, second.ID},
+		Names:   [2]string{first.Name, second.Name},
+	}
+
+	var err error
+	if comparison.Routes, err = d.compareRoutes(first.ID, second.ID); err != nil {
+		return nil, err
+	}
+	for _, route := range comparison.Routes {
+		switch route.FasterUserID {
+		case first.ID:
+			comparison.FasterRoutes[0]++
+		case second.ID:
+			comparison.FasterRoutes[1]++
+		}
+		comparison.AverageGap += route.Gap
+		comparison.AverageGapPercent += route.GapPercent
+	}
+	if n := len(comparison.Routes); n > 0 {
+		comparison.AverageGap /= float64(n)
+		comparison.AverageGapPercent /= float64(n)
+	}
+	comparison.FasterUserID = fasterUserID(first.ID, second.ID, comparison.AverageGap)
+
+	if comparison.Events, err = d.compareEvents(first.ID, second.ID, hcMode); err != nil {
+		return nil, err
+	}
+	for _, event := range comparison.Events {
+		switch event.WinnerUserID {
+		case first.ID:
+			comparison.EventWins[0]++
+		case second.ID:
+			comparison.EventWins[1]++
+		}
+	}
+	return comparison, nil
+}
+
+func fasterUserID(first string, second string, gap float64) string {
+	switch {
+	case gap < 0:
+		return first
+	case gap > 0:
+		return second
+	}
+	return ""
+}
+
+func (d *Database) compareRoutes(first string, second string) ([]RouteComparison, error) {
+	rows, err := d.query(`
+		SELECT
+			a.route_id,
+			COALESCE(r.name, 'Unknown'),
+			COALESCE(l.name, 'Unknown'),
+			a.vehicle_class_id,
+			COALESCE(vc.name, 'Unknown'),
+			a.best_time,
+			b.best_time
+		FROM personal_bests a
+		JOIN personal_bests b ON b.route_id = a.route_id AND b.vehicle_class_id = a.vehicle_class_id
+		LEFT JOIN routes r ON r.id = a.route_id
+		LEFT JOIN locations l ON l.id = r.location_id
+		LEFT JOIN vehicle_classes vc ON vc.id = a.vehicle_class_id
+		WHERE a.user_id = ? AND b.user_id = ?
+			AND a.route_id IS NOT NULL AND a.vehicle_class_id IS NOT NULL
+		ORDER BY l.name, r.name, vc.name
+	`, first, second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query personal bests: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	routes := []RouteComparison{}
+	for rows.Next() {
+		var route RouteComparison
+		if err := rows.Scan(
+			&route.RouteID,
+			&route.Route,
+			&route.Location,
+			&route.VehicleClassID,
+			&route.VehicleClass,
+			&route.BestTimes[0],
+			&route.BestTimes[1],
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		route.Gap = route.BestTimes[0] - route.BestTimes[1]
+		if route.BestTimes[1] > 0 {
+			route.GapPercent = route.Gap / route.BestTimes[1] * 100
+		}
+		route.FasterUserID = fasterUserID(first, second, route.Gap)
+		routes = append(routes, route)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return routes, nil
+}
+
+func (d *Database) compareEvents(first string, second string, hcMode bool) ([]EventComparison, error) {
+	rows, err := d.query(`
+		SELECT e.id, e.name, a.position, b.position
+		FROM results a
+		JOIN results b ON b.race_event_id = a.race_event_id AND b.hc_mode = a.hc_mode
+		JOIN race_events e ON e.id = a.race_event_id
+		WHERE a.user_id = ? AND b.user_id = ? AND a.hc_mode = ?
+		ORDER BY e.started_at, e.id
+	`, first, second, hcMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query results: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	events := []EventComparison{}
+	for rows.Next() {
+		var event EventComparison
+		if err := rows.Scan(&event.RaceEventID, &event.Name, &event.Positions[0], &event.Positions[1]); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		event.WinnerUserID = fasterUserID(first, second, float64(event.Positions[0]-event.Positions[1]))
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,220 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+const (
+	cornerBrakeThreshold    = 0.2   // Brake pedal position which starts a braking zone
+	cornerThrottleThreshold = 0.5   // Throttle pedal position which ends a corner
+	cornerEntryMargin       = 20.0  // Corner window starts this much before the braking point [metre]
+	cornerExitLength        = 50.0  // Corner window ends this much after the throttle pickup [metre]
+	cornerBrakeSearch       = 100.0 // Braking point of a run is searched this much before the corner window [metre]
+)
+
+// cornerMarks are the points of a single corner detected from one run.
+type cornerMarks struct {
+	BrakeDistance    float64
+	ApexDistance     float64
+	ApexSpeed        float32
+	ThrottleDistance float64
+}
+
+type SessionCorner struct {
+	Number                 int      `json:"number"`
+	EntryDistance          float64  `json:"entry_distance"`
+	ExitDistance           float64  `json:"exit_distance"`
+	BrakeDistance          *float64 `json:"brake_distance"`
+	ApexDistance           float64  `json:"apex_distance"`
+	ThrottleDistance       *float64 `json:"throttle_distance"`
+	EntrySpeed             float32  `json:"entry_speed"`
+	MinSpeed               float32  `json:"min_speed"`
+	ExitSpeed              float32  `json:"exit_speed"`
+	Time                   float32  `json:"time"`
+	ReferenceBrakeDistance float64  `json:"reference_brake_distance"`
+	ReferenceApexDistance  float64  `json:"reference_apex_distance"`
+	ReferenceMinSpeed      float32  `json:"reference_min_speed"`
+	ReferenceTime          float32  `json:"reference_time"`
+	TimeLost               float32  `json:"time_lost"`
+}
+
+type SessionCorners struct {
+	SessionID          int             `json:"session_id"`
+	ReferenceSessionID int             `json:"reference_session_id"`
+	Corners            []SessionCorner `json:"corners"`
+}
+
+// detectCorners finds corners from braking zones: a corner starts when the
+// brake is pressed, has its apex at the lowest speed and ends when the driver
+// picks up the throttle again.
+func detectCorners(samples []telemetrySample) []cornerMarks {
+	var corners []cornerMarks
+	var current *cornerMarks
+
+	for i := 1; i < len(samples); i++ {
+		previous, s := samples[i-1], samples[i]
+
+		if current == nil {
+			if s.Brake > cornerBrakeThreshold && previous.Brake <= cornerBrakeThreshold {
+				current = &cornerMarks{
+					BrakeDistance: s.StageCurrentDistance,
+					ApexDistance:  s.StageCurrentDistance,
+					ApexSpeed:     s.Speed,
+				}
+			}
+			continue
+		}
+
+		if s.Speed < current.ApexSpeed {
+			current.ApexDistance = s.StageCurrentDistance
+			current.ApexSpeed = s.Speed
+		}
+
+		if s.Throttle > cornerThrottleThreshold && s.Brake <= cornerBrakeThreshold {
+			current.ThrottleDistance = s.StageCurrentDistance
+			corners = append(corners, *current)
+			current = nil
+		}
+	}
+	return corners
+}
+
+// interpolateAt returns the time and speed when the run first reached the
+// distance. Samples must be ordered by time.
+func interpolateAt(samples []telemetrySample, distance float64) (float32, float32, bool) {
+	for i := 1; i < len(samples); i++ {
+		a, b := samples[i-1], samples[i]
+		if a.StageCurrentDistance <= distance && b.StageCurrentDistance >= distance {
+			ratio := float32(0)
+			if span := b.StageCurrentDistance - a.StageCurrentDistance; span > 0 {
+				ratio = float32((distance - a.StageCurrentDistance) / span)
+			}
+			time := a.StageCurrentTime + (b.StageCurrentTime-a.StageCurrentTime)*ratio
+			speed := a.Speed + (b.Speed-a.Speed)*ratio
+			return time, speed, true
+		}
+	}
+	return 0, 0, false
+}
+
+// measureCorner measures how the run drove through the distance window of a
+// reference corner.
+func measureCorner(samples []telemetrySample, entry, exit float64) (SessionCorner, bool) {
+	corner := SessionCorner{EntryDistance: entry, ExitDistance: exit}
+
+	entryTime, entrySpeed, ok := interpolateAt(samples, entry)
+	if !ok {
+		return corner, false
+	}
+	exitTime, exitSpeed, ok := interpolateAt(samples, exit)
+	if !ok {
+		return corner, false
+	}
+	corner.EntrySpeed = entrySpeed
+	corner.ExitSpeed = exitSpeed
+	corner.Time = exitTime - entryTime
+
+	corner.MinSpeed = entrySpeed
+	corner.ApexDistance = entry
+	for i, s := range samples {
+		d := s.StageCurrentDistance
+		if corner.BrakeDistance == nil && i > 0 && d >= entry-cornerBrakeSearch && d <= exit &&
+			s.Brake > cornerBrakeThreshold && samples[i-1].Brake <= cornerBrakeThreshold {
+			brakeDistance := d
+			corner.BrakeDistance = &brakeDistance
+		}
+		if d >= entry && d <= exit && s.Speed < corner.MinSpeed {
+			corner.MinSpeed = s.Speed
+			corner.ApexDistance = d
+		}
+	}
+
+	for _, s := range samples {
+		d := s.StageCurrentDistance
+		if d > corner.ApexDistance && d <= exit && s.Throttle > cornerThrottleThreshold {
+			throttleDistance := d
+			corner.ThrottleDistance = &throttleDistance
+			break
+		}
+	}
+
+	return corner, true
+}
+
+func compareCorners(samples, reference []telemetrySample) []SessionCorner {
+	corners := []SessionCorner{}
+	for _, marks := range detectCorners(reference) {
+		entry := marks.BrakeDistance - cornerEntryMargin
+		exit := marks.ThrottleDistance + cornerExitLength
+
+		referenceCorner, ok := measureCorner(reference, entry, exit)
+		if !ok {
+			continue
+		}
+		corner, ok := measureCorner(samples, entry, exit)
+		if !ok {
+			continue
+		}
+
+		corner.ReferenceBrakeDistance = marks.BrakeDistance
+		corner.ReferenceApexDistance = referenceCorner.ApexDistance
+		corner.ReferenceMinSpeed = referenceCorner.MinSpeed
+		corner.ReferenceTime = referenceCorner.Time
+		corner.TimeLost = corner.Time - referenceCorner.Time
+		corners = append(corners, corner)
+	}
+
+	sort.Slice(corners, func(i, j int) bool {
+		return corners[i].EntryDistance < corners[j].EntryDistance
+	})
+	for i := range corners {
+		corners[i].Number = i + 1
+	}
+	return corners
+}
+
+// GetSessionCorners compares every corner of the session against the fastest
+// run on the same route and vehicle class. If there is no finished run yet,
+// the session is compared against itself. Returns nil if there is no
+// telemetry for the session.
+func (d *Database) GetSessionCorners(sessionID int) (*SessionCorners, error) {
+	var referenceID sql.NullInt32
+	err := d.queryRow(`
+		SELECT r.session_id
+		FROM sessions s
+		LEFT JOIN route_records r ON r.route_id = s.route_id AND r.vehicle_class_id = s.vehicle_class_id
+		WHERE s.id = ?
+	`, sessionID).Scan(&referenceID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No session found
+		}
+		return nil, fmt.Errorf("failed to fetch reference session: %w", err)
+	}
+
+	samples, err := d.getTelemetrySamples(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, nil
+	}
+
+	result := SessionCorners{SessionID: sessionID, ReferenceSessionID: sessionID}
+	reference := samples
+	if referenceID.Valid && int(referenceID.Int32) != sessionID {
+		referenceSamples, err := d.getTelemetrySamples(int(referenceID.Int32))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get reference telemetry: %w", err)
+		}
+		if len(referenceSamples) > 0 {
+			reference = referenceSamples
+			result.ReferenceSessionID = int(referenceID.Int32)
+		}
+	}
+
+	result.Corners = compareCorners(samples, reference)
+	return &result, nil
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// Speed of the synthetic runs outside of corners [metre/second]
+const straightSpeed = 30
+
+// syntheticCorner is a corner of a synthetic run: the driver brakes at brake,
+// reaches the minimum speed at apex, holds it and accelerates from throttle.
+type syntheticCorner struct {
+	brake, apex, throttle float64
+	minSpeed              float32
+}
+
+// syntheticRun samples a run of the given length every step metres, starting
+// from offset.
+func syntheticRun(length, offset, step float64, corners ...syntheticCorner) []telemetrySample {
+	// Corners close to each other slow the car down as much as the slower
+	// of them
+	speedAt := func(d float64) float32 {
+		speed := float32(straightSpeed)
+		for _, c := range corners {
+			switch {
+			case d >= c.brake && d < c.apex:
+				speed = min(speed, straightSpeed-(straightSpeed-c.minSpeed)*float32((d-c.brake)/(c.apex-c.brake)))
+			case d >= c.apex && d < c.throttle:
+				speed = min(speed, c.minSpeed)
+			case d >= c.throttle && d < c.throttle+cornerExitLength:
+				speed = min(speed, c.minSpeed+(straightSpeed-c.minSpeed)*float32((d-c.throttle)/cornerExitLength))
+			}
+		}
+		return speed
+	}
+
+	var samples []telemetrySample
+	var time float32
+	for d := offset; d <= length; d += step {
+		s := telemetrySample{StageCurrentDistance: d, Speed: speedAt(d), Throttle: 1}
+		for _, c := range corners {
+			if d >= c.brake && d < c.throttle {
+				s.Throttle = 0
+			}
+			if d >= c.brake && d < c.apex {
+				s.Brake = 1
+			}
+		}
+		if len(samples) > 0 {
+			previous := samples[len(samples)-1]
+			time += float32(step) / ((previous.Speed + s.Speed) / 2)
+		}
+		s.StageCurrentTime = time
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+var (
+	hairpin = syntheticCorner{brake: 300, apex: 350, throttle: 400, minSpeed: 10}
+	// Braking for the chicane starts while accelerating out of the hairpin
+	chicane = syntheticCorner{brake: 440, apex: 460, throttle: 480, minSpeed: 15}
+	kink    = syntheticCorner{brake: 600, apex: 620, throttle: 640, minSpeed: 20}
+)
+
+func TestDetectCorners(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []telemetrySample
+		want    []cornerMarks
+	}{
+		{"straight", syntheticRun(1000, 0, 1), nil},
+		{"single corner", syntheticRun(1000, 0, 1, hairpin), []cornerMarks{
+			{BrakeDistance: 300, ApexDistance: 350, ApexSpeed: 10, ThrottleDistance: 400},
+		}},
+		{"back to back corners", syntheticRun(1000, 0, 1, hairpin, chicane), []cornerMarks{
+			{BrakeDistance: 300, ApexDistance: 350, ApexSpeed: 10, ThrottleDistance: 400},
+			{BrakeDistance: 440, ApexDistance: 460, ApexSpeed: 15, ThrottleDistance: 480},
+		}},
+		{"run ends in a corner", syntheticRun(380, 0, 1, hairpin), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectCorners(tt.samples); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got corners %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateAt(t *testing.T) {
+	// Samples at 5, 15, 25 ... 95 m, 1 s apart
+	var samples []telemetrySample
+	for i := range 10 {
+		samples = append(samples, telemetrySample{
+			StageCurrentTime:     float32(i),
+			StageCurrentDistance: float64(5 + 10*i),
+			Speed:                float32(10 + i),
+		})
+	}
+
+	tests := []struct {
+		name        string
+		distance    float64
+		time, speed float32
+		ok          bool
+	}{
+		{"before the first sample", 4, 0, 0, false},
+		{"first sample", 5, 0, 10, true},
+		{"between samples", 20, 1.5, 11.5, true},
+		{"last sample", 95, 9, 19, true},
+		{"after the last sample", 96, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			time, speed, ok := interpolateAt(samples, tt.distance)
+			if ok != tt.ok || math.Abs(float64(time-tt.time)) > 1e-4 || math.Abs(float64(speed-tt.speed)) > 1e-4 {
+				t.Errorf("got %v %v %v, want %v %v %v", time, speed, ok, tt.time, tt.speed, tt.ok)
+			}
+		})
+	}
+
+	if _, _, ok := interpolateAt(samples[:1], 5); ok {
+		t.Error("interpolated from a single sample")
+	}
+}
+
+func TestCompareCorners(t *testing.T) {
+	reference := syntheticRun(1000, 0, 1, hairpin, kink)
+
+	tests := []struct {
+		name    string
+		samples []telemetrySample
+		// Time lost in every corner found in the run [second]
+		timeLost []float64
+		// The run doesn't brake for the corners
+		noBraking bool
+	}{
+		{"same run", reference, []float64{0, 0}, false},
+		{"sampled at other distances", syntheticRun(1000, 0.5, 2.5, hairpin, kink), []float64{0, 0}, false},
+		{
+			// Slower by 50/8 - 50/10 s at the apex and 50/22 ln(30/8) - 50/20 ln(30/10) s
+			// both when braking and accelerating
+			"slower hairpin",
+			syntheticRun(1000, 0, 1, syntheticCorner{brake: 300, apex: 350, throttle: 400, minSpeed: 8}, kink),
+			[]float64{1.765, 0},
+			false,
+		},
+		{"run ends before the exit of the kink", syntheticRun(650, 0, 1, hairpin, kink), []float64{0}, false},
+		// Taking the corners flat out saves the time of slowing down for them
+		{"flat out", syntheticRun(1000, 0, 1), []float64{-5.493, -0.838}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			corners := compareCorners(tt.samples, reference)
+			if len(corners) != len(tt.timeLost) {
+				t.Fatalf("got %d corners, want %d", len(corners), len(tt.timeLost))
+			}
+
+			for i, c := range corners {
+				marks := []syntheticCorner{hairpin, kink}[i]
+				if c.Number != i+1 {
+					t.Errorf("corner %d has number %d", i+1, c.Number)
+				}
+				if c.EntryDistance != marks.brake-cornerEntryMargin || c.ExitDistance != marks.throttle+cornerExitLength {
+					t.Errorf("corner %d window is %.1f-%.1f", i+1, c.EntryDistance, c.ExitDistance)
+				}
+				if c.ReferenceBrakeDistance != marks.brake || c.ReferenceApexDistance != marks.apex || c.ReferenceMinSpeed != marks.minSpeed {
+					t.Errorf("corner %d reference brake, apex and speed are %.1f, %.1f and %.1f",
+						i+1, c.ReferenceBrakeDistance, c.ReferenceApexDistance, c.ReferenceMinSpeed)
+				}
+				if (c.BrakeDistance == nil) != tt.noBraking || (c.BrakeDistance != nil && math.Abs(*c.BrakeDistance-marks.brake) > 2.5) {
+					t.Errorf("corner %d brake distance is %v, want about %.1f", i+1, c.BrakeDistance, marks.brake)
+				}
+				if math.Abs(float64(c.TimeLost)-tt.timeLost[i]) > 0.01 {
+					t.Errorf("corner %d lost %.3f s, want %.3f s", i+1, c.TimeLost, tt.timeLost[i])
+				}
+			}
+		})
+	}
+}
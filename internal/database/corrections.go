@@ -0,0 +1,267 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CorrectionReassign   = "reassign"
+	CorrectionEvent      = "event"
+	CorrectionPenalty    = "penalty"
+	CorrectionDisqualify = "disqualify"
+	CorrectionVoid       = "void"
+)
+
+// Stage result states set by the corrections, see "stage_result_states" table
+const (
+	stageResultDisqualified = 5
+	stageResultVoided       = 7
+)
+
+// ErrInvalidCorrection is wrapped by the errors caused by invalid corrections,
+// e.g. a reassignment to a user which does not exist.
+var ErrInvalidCorrection = errors.New("invalid correction")
+
+type SessionCorrection struct {
+	SessionID int        `json:"session_id"`
+	CreatedAt *time.Time `json:"created_at"`
+	Action    string     `json:"action"`
+	Reason    *string    `json:"reason"`
+	OldValue  *string    `json:"old_value"`
+	NewValue  *string    `json:"new_value"`
+}
+
+// correctedSession holds the session fields which the corrections change.
+type correctedSession struct {
+	userID         sql.NullString
+	eventID        sql.NullInt32
+	status         sql.NullInt16
+	timePenalty    sql.NullFloat64
+	routeID        sql.NullInt32
+	vehicleClassID sql.NullInt32
+}
+
+func (d *Database) getCorrectedSession(sessionID int) (*correctedSession, error) {
+	if activeSessionID != 0 && sessionID == activeSessionID {
+		return nil, fmt.Errorf("%w: session %d is still running", ErrInvalidCorrection, sessionID)
+	}
+
+	var s correctedSession
+	err := d.queryRow(`
+		SELECT user_id, race_event_id, stage_result_status, stage_result_time_penalty, route_id, vehicle_class_id
+		FROM sessions
+		WHERE id = ?
+	`, sessionID).Scan(&s.userID, &s.eventID, &s.status, &s.timePenalty, &s.routeID, &s.vehicleClassID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: session %d does not exist", ErrInvalidCorrection, sessionID)
+		}
+		return nil, fmt.Errorf("could not get session: %w", err)
+	}
+	return &s, nil
+}
+
+// correctSession sets the column of the session and logs the correction. The
+// results of the events the session belonged to before and after are
+// recalculated, as are the ratings if one of the events has ended. The
+// achievements of the session are not recomputed.
+func (d *Database) correctSession(sessionID int, action string, reason string, column string, oldValue any, newValue any, eventIDs ...sql.NullInt32) error {
+	tx, err := d.db.BeginTx(d.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	_, err = tx.ExecContext(d.ctx, fmt.Sprintf("UPDATE sessions SET %s = ? WHERE id = ?", column), newValue, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to correct session: %w", err)
+	}
+	_, err = tx.ExecContext(d.ctx, `
+		INSERT INTO session_corrections (session_id, action, reason, old_value, new_value)
+		VALUES (?, ?, NULLIF(?, ''), ?, ?)
+	`, sessionID, action, strings.TrimSpace(reason), auditValue(oldValue), auditValue(newValue))
+	if err != nil {
+		return fmt.Errorf("failed to log correction: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit correction: %w", err)
+	}
+	slog.Info("session corrected", "session_id", sessionID, "action", action, "old", auditValue(oldValue), "new", auditValue(newValue))
+
+	recalculated := map[int32]bool{}
+	ratingsChanged := false
+	for _, eventID := range eventIDs {
+		if !eventID.Valid || recalculated[eventID.Int32] {
+			continue
+		}
+		recalculated[eventID.Int32] = true
+
+		event, err := d.GetEvent(int(eventID.Int32))
+		if err != nil {
+			return err
+		}
+		if event == nil || !event.EndedAt.Valid {
+			continue
+		}
+		if err := d.RecalculateEventResults(int(eventID.Int32)); err != nil {
+			return fmt.Errorf("failed to recalculate results of event %d: %w", eventID.Int32, err)
+		}
+		ratingsChanged = true
+	}
+	if ratingsChanged {
+		return d.RecalculateRatings()
+	}
+	return nil
+}
+
+// auditValue converts the value to its text form in the log, or nil if it is
+// NULL.
+func auditValue(v any) any {
+	switch v := v.(type) {
+	case sql.NullString:
+		if v.Valid {
+			return v.String
+		}
+	case sql.NullInt32:
+		if v.Valid {
+			return strconv.Itoa(int(v.Int32))
+		}
+	case sql.NullInt16:
+		if v.Valid {
+			return strconv.Itoa(int(v.Int16))
+		}
+	case sql.NullFloat64:
+		if v.Valid {
+			return strconv.FormatFloat(v.Float64, 'f', -1, 32)
+		}
+	case nil:
+	default:
+		return fmt.Sprint(v)
+	}
+	return nil
+}
+
+// ReassignSession attributes the session to another user, e.g. when the wrong
+// driver was logged in.
+func (d *Database) ReassignSession(sessionID int, userID string, reason string) error {
+	session, err := d.getCorrectedSession(sessionID)
+	if err != nil {
+		return err
+	}
+	user, err := d.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("%w: user %s does not exist", ErrInvalidCorrection, userID)
+	}
+	return d.correctSession(sessionID, CorrectionReassign, reason, "user_id", session.userID, user.ID, session.eventID)
+}
+
+// SetSessionEvent attaches the session to the event, or detaches it from its
+// event if eventID is NULL. The event must not have ended, and its route and
+// vehicle class, if set, must be the ones of the session.
+func (d *Database) SetSessionEvent(sessionID int, eventID sql.NullInt32, reason string) error {
+	session, err := d.getCorrectedSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if eventID.Valid {
+		event, err := d.GetEvent(int(eventID.Int32))
+		if err != nil {
+			return err
+		}
+		if event == nil {
+			return fmt.Errorf("%w: event %d does not exist", ErrInvalidCorrection, eventID.Int32)
+		}
+		if event.EndedAt.Valid {
+			return fmt.Errorf("%w: event %d has ended", ErrInvalidCorrection, eventID.Int32)
+		}
+		if event.RouteID.Valid && (!session.routeID.Valid || session.routeID.Int32 != int32(event.RouteID.Int16)) {
+			return fmt.Errorf("%w: session %d is not on the route of event %d", ErrInvalidCorrection, sessionID, eventID.Int32)
+		}
+		if event.VehicleClassID.Valid && (!session.vehicleClassID.Valid || session.vehicleClassID.Int32 != int32(event.VehicleClassID.Int16)) {
+			return fmt.Errorf("%w: session %d is not in the vehicle class of event %d", ErrInvalidCorrection, sessionID, eventID.Int32)
+		}
+	}
+	return d.correctSession(sessionID, CorrectionEvent, reason, "race_event_id", session.eventID, eventID, session.eventID, eventID)
+}
+
+// AddSessionPenalty adds the time penalty to the session. A negative penalty
+// removes a penalty given earlier, but the total can't become negative.
+func (d *Database) AddSessionPenalty(sessionID int, seconds float64, reason string) error {
+	session, err := d.getCorrectedSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if seconds == 0 {
+		return fmt.Errorf("%w: penalty must not be zero", ErrInvalidCorrection)
+	}
+	total := session.timePenalty.Float64 + seconds
+	if total < 0 {
+		return fmt.Errorf("%w: total penalty would be negative", ErrInvalidCorrection)
+	}
+	newPenalty := sql.NullFloat64{Float64: total, Valid: true}
+	return d.correctSession(sessionID, CorrectionPenalty, reason, "stage_result_time_penalty", session.timePenalty, newPenalty, session.eventID)
+}
+
+// DisqualifySession marks the session disqualified, so it no longer counts in
+// the results. The reason is required.
+func (d *Database) DisqualifySession(sessionID int, reason string) error {
+	return d.setSessionStatus(sessionID, CorrectionDisqualify, stageResultDisqualified, "disqualified", reason)
+}
+
+// VoidSession removes the session from the results and leaderboards, e.g.
+// when it was a test run. The reason is required.
+func (d *Database) VoidSession(sessionID int, reason string) error {
+	return d.setSessionStatus(sessionID, CorrectionVoid, stageResultVoided, "voided", reason)
+}
+
+func (d *Database) setSessionStatus(sessionID int, action string, status int16, statusName string, reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("%w: reason is required", ErrInvalidCorrection)
+	}
+	session, err := d.getCorrectedSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if session.status.Valid && session.status.Int16 == status {
+		return fmt.Errorf("%w: session %d is already %s", ErrInvalidCorrection, sessionID, statusName)
+	}
+	return d.correctSession(sessionID, action, reason, "stage_result_status", session.status, sql.NullInt16{Int16: status, Valid: true}, session.eventID)
+}
+
+// GetSessionCorrections returns the corrections of the session, the oldest
+// first.
+func (d *Database) GetSessionCorrections(sessionID int) ([]SessionCorrection, error) {
+	rows, err := d.query(`
+		SELECT session_id, created_at, action, reason, old_value, new_value
+		FROM session_corrections
+		WHERE session_id = ?
+		ORDER BY created_at
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query corrections: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	corrections := []SessionCorrection{}
+	for rows.Next() {
+		var c SessionCorrection
+		if err := rows.Scan(&c.SessionID, &c.CreatedAt, &c.Action, &c.Reason, &c.OldValue, &c.NewValue); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		corrections = append(corrections, c)
+	}
+	return corrections, rows.Err()
+}
@@ -0,0 +1,214 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// newCorrectionsDatabase returns a database with an ended event 1 where a
+// (session 1, 100 s) beat b (session 2, 110 s), and a run of c outside of
+// events (session 3). Event 2 is open on the same route and class, events 3
+// and 4 are on another route and class, and event 5 has ended.
+func newCorrectionsDatabase(t *testing.T) *Database {
+	t.Helper()
+	d := newTestDatabase(t)
+	mustExec(t, d,
+		"INSERT INTO users (id, name) VALUES ('a', 'Alice'), ('b', 'Bob'), ('c', 'Carol')",
+		`INSERT INTO race_events (name, route_id, vehicle_class_id, active, ended_at) VALUES
+			('Ended', 7, 1, false, '2025-01-01 12:00'),
+			('Open', 7, 1, true, NULL),
+			('Other route', 8, 1, true, NULL),
+			('Other class', 7, 2, true, NULL),
+			('Also ended', NULL, NULL, false, '2025-01-02 12:00')`,
+		`INSERT INTO sessions (user_id, race_event_id, route_id, vehicle_class_id, stage_result_status, stage_result_time, stage_result_time_penalty) VALUES
+			('a', 1, 7, 1, 1, 100, 0),
+			('b', 1, 7, 1, 1, 110, 0),
+			('c', NULL, 7, 1, 1, 90, 0)`,
+	)
+	if err := d.RecalculateEventResults(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RecalculateRatings(); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// queryString returns the single text value selected by the query, or "" if
+// it is NULL.
+func queryString(t *testing.T, d *Database, query string, args ...any) string {
+	t.Helper()
+	var v sql.NullString
+	if err := d.queryRow(query, args...).Scan(&v); err != nil {
+		t.Fatalf("failed to run %q: %v", query, err)
+	}
+	return v.String
+}
+
+func TestSessionCorrections(t *testing.T) {
+	tests := []struct {
+		name    string
+		correct func(d *Database) error
+		// The logged correction of the session
+		sessionID int
+		action    string
+		old, new  string
+		// The corrected session as "user:event:status:penalty"
+		session string
+		// The results and rated positions of event 1 as "user:position"
+		results string
+	}{
+		{
+			name:      "reassign",
+			correct:   func(d *Database) error { return d.ReassignSession(1, "c", "wrong driver") },
+			sessionID: 1, action: CorrectionReassign, old: "a", new: "c",
+			session: "c:1:1:0",
+			results: "c:1,b:2",
+		},
+		{
+			name:      "move to event",
+			correct:   func(d *Database) error { return d.SetSessionEvent(3, sql.NullInt32{Int32: 2, Valid: true}, "") },
+			sessionID: 3, action: CorrectionEvent, old: "", new: "2",
+			session: "c:2:1:0",
+			results: "a:1,b:2",
+		},
+		{
+			name:      "remove from event",
+			correct:   func(d *Database) error { return d.SetSessionEvent(1, sql.NullInt32{}, "practice run") },
+			sessionID: 1, action: CorrectionEvent, old: "1", new: "",
+			session: "a::1:0",
+			results: "b:1",
+		},
+		{
+			name:      "penalty",
+			correct:   func(d *Database) error { return d.AddSessionPenalty(1, 15, "jump start") },
+			sessionID: 1, action: CorrectionPenalty, old: "0", new: "15",
+			session: "a:1:1:15",
+			results: "b:1,a:2",
+		},
+		{
+			name:      "disqualify",
+			correct:   func(d *Database) error { return d.DisqualifySession(1, "wrong car") },
+			sessionID: 1, action: CorrectionDisqualify, old: "1", new: "5",
+			session: "a:1:5:0",
+			results: "b:1",
+		},
+		{
+			name:      "void",
+			correct:   func(d *Database) error { return d.VoidSession(2, "test run") },
+			sessionID: 2, action: CorrectionVoid, old: "1", new: "7",
+			session: "b:1:7:0",
+			results: "a:1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newCorrectionsDatabase(t)
+			if err := tt.correct(d); err != nil {
+				t.Fatal(err)
+			}
+
+			corrections, err := d.GetSessionCorrections(tt.sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(corrections) != 1 {
+				t.Fatalf("got %d corrections, want 1", len(corrections))
+			}
+			c := corrections[0]
+			if c.Action != tt.action || stringValue(c.OldValue) != tt.old || stringValue(c.NewValue) != tt.new {
+				t.Errorf("logged %s %q -> %q, want %s %q -> %q", c.Action, stringValue(c.OldValue), stringValue(c.NewValue), tt.action, tt.old, tt.new)
+			}
+
+			session := queryString(t, d, `
+				SELECT concat_ws(':', user_id, COALESCE(race_event_id::TEXT, ''), stage_result_status, stage_result_time_penalty::INTEGER)
+				FROM sessions
+				WHERE id = ?
+			`, tt.sessionID)
+			if session != tt.session {
+				t.Errorf("got session %s, want %s", session, tt.session)
+			}
+
+			results := queryString(t, d, `
+				SELECT string_agg(user_id || ':' || position, ',' ORDER BY position)
+				FROM results
+				WHERE race_event_id = 1 AND hc_mode = false
+			`)
+			if results != tt.results {
+				t.Errorf("got results %s, want %s", results, tt.results)
+			}
+			ratings := queryString(t, d, `
+				SELECT string_agg(user_id || ':' || position, ',' ORDER BY position)
+				FROM user_rating_history
+				WHERE race_event_id = 1 AND vehicle_class_id IS NULL
+			`)
+			if ratings != tt.results {
+				t.Errorf("got rated positions %s, want %s", ratings, tt.results)
+			}
+		})
+	}
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func TestInvalidSessionCorrections(t *testing.T) {
+	event := func(id int32) sql.NullInt32 { return sql.NullInt32{Int32: id, Valid: true} }
+	tests := []struct {
+		name    string
+		correct func(d *Database) error
+		// Corrections applied before the invalid one
+		applied int
+		// The penalty of session 1 afterwards
+		penalty string
+	}{
+		{"missing session", func(d *Database) error { return d.AddSessionPenalty(99, 5, "") }, 0, "0"},
+		{"missing user", func(d *Database) error { return d.ReassignSession(1, "x", "") }, 0, "0"},
+		{"missing event", func(d *Database) error { return d.SetSessionEvent(3, event(99), "") }, 0, "0"},
+		{"ended event", func(d *Database) error { return d.SetSessionEvent(3, event(5), "") }, 0, "0"},
+		{"other route", func(d *Database) error { return d.SetSessionEvent(3, event(3), "") }, 0, "0"},
+		{"other class", func(d *Database) error { return d.SetSessionEvent(3, event(4), "") }, 0, "0"},
+		{"zero penalty", func(d *Database) error { return d.AddSessionPenalty(1, 0, "") }, 0, "0"},
+		{"negative total penalty", func(d *Database) error {
+			if err := d.AddSessionPenalty(1, 5, "jump start"); err != nil {
+				return err
+			}
+			return d.AddSessionPenalty(1, -10, "")
+		}, 1, "5"},
+		{"disqualify without reason", func(d *Database) error { return d.DisqualifySession(1, " ") }, 0, "0"},
+		{"void twice", func(d *Database) error {
+			if err := d.VoidSession(1, "test run"); err != nil {
+				return err
+			}
+			return d.VoidSession(1, "test run")
+		}, 1, "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newCorrectionsDatabase(t)
+			sessions := "SELECT string_agg(concat_ws(':', id, user_id, race_event_id, stage_result_status), ',' ORDER BY id) FROM sessions WHERE id != 1"
+			before := queryString(t, d, sessions)
+
+			err := tt.correct(d)
+			if !errors.Is(err, ErrInvalidCorrection) {
+				t.Fatalf("got error %v, want %v", err, ErrInvalidCorrection)
+			}
+
+			if got := queryString(t, d, "SELECT count(*) FROM session_corrections"); got != strconv.Itoa(tt.applied) {
+				t.Errorf("logged %s corrections, want %d", got, tt.applied)
+			}
+			if got := queryString(t, d, sessions); got != before {
+				t.Errorf("sessions changed from %s to %s", before, got)
+			}
+			if got := queryString(t, d, "SELECT stage_result_time_penalty::INTEGER FROM sessions WHERE id = 1"); got != tt.penalty {
+				t.Errorf("got penalty %s, want %s", got, tt.penalty)
+			}
+		})
+	}
+}
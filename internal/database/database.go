@@ -4,23 +4,42 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
-	_ "embed"
 	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/marcboeker/go-duckdb/v2"
 )
 
 type Database struct {
 	ctx      context.Context
+	path     string
 	conn     driver.Conn
 	db       *sql.DB
 	appender *duckdb.Appender
-}
 
-//go:embed schema.sql
-var dbSchema string
+	telemetryMu      sync.Mutex
+	telemetryStorage TelemetryStorage
+	telemetryMask    []bool
+	telemetryState   telemetryStorageState
+
+	backupConfig BackupConfig
+	backupMu     sync.Mutex
 
+	logoutPolicy          atomic.Pointer[LogoutPolicy]
+	stalledSessionTimeout atomic.Int64
+}
+
+// NewDatabase opens the database and applies the pending migrations.
 func NewDatabase(ctx context.Context, path string) (*Database, error) {
+	return OpenDatabase(ctx, path, true)
+}
+
+// OpenDatabase opens the database, applying the pending migrations if migrate
+// is set. Without migrating, the database can't store telemetry.
+func OpenDatabase(ctx context.Context, path string, migrate bool) (*Database, error) {
 	connector, err := duckdb.NewConnector(path, nil)
 	if err != nil {
 		return nil, err
@@ -31,24 +50,28 @@ func NewDatabase(ctx context.Context, path string) (*Database, error) {
 		return nil, err
 	}
 
-	db := sql.OpenDB(connector)
+	d := &Database{
+		ctx:  ctx,
+		path: strings.SplitN(path, "?", 2)[0],
+		conn: dbConnection,
+		db:   sql.OpenDB(connector),
+	}
+	if !migrate {
+		return d, nil
+	}
 
-	_, err = db.ExecContext(ctx, dbSchema)
-	if err != nil {
-		return nil, err
+	if _, err := d.Migrate(); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	appender, err := duckdb.NewAppenderFromConn(dbConnection, "", "telemetry")
+	d.appender, err = duckdb.NewAppenderFromConn(dbConnection, "", "telemetry")
 	if err != nil {
+		d.Close()
 		return nil, fmt.Errorf("could not create new appender for telemetry: %w", err)
 	}
 
-	return &Database{
-		ctx:      ctx,
-		conn:     dbConnection,
-		db:       db,
-		appender: appender,
-	}, nil
+	return d, nil
 }
 
 func (d *Database) Close() {
@@ -57,6 +80,12 @@ func (d *Database) Close() {
 		d.appender.Close()
 	}
 	if d.db != nil {
+		// Write the changes to the database file so that the next start
+		// doesn't need to replay them from the write-ahead log. The context
+		// of the database is usually cancelled by now.
+		if _, err := d.db.ExecContext(context.Background(), "CHECKPOINT"); err != nil {
+			slog.Error("failed to checkpoint database", "error", err)
+		}
 		//nolint:errcheck
 		d.db.Close()
 	}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestDatabase returns a migrated database in a temporary directory.
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	d, err := NewDatabase(context.Background(), filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(d.Close)
+	return d
+}
+
+// mustExec runs the statements in order and fails the test on the first error.
+func mustExec(t *testing.T, d *Database, queries ...string) {
+	t.Helper()
+	for _, query := range queries {
+		if _, err := d.exec(query); err != nil {
+			t.Fatalf("failed to run %q: %v", query, err)
+		}
+	}
+}
+
+// useTimeZone makes the zone the local time zone of both Go and DuckDB for
+// the duration of the test, as timestamps are stored in local wall clock time.
+func useTimeZone(t *testing.T, d *Database, name string) {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	local := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = local })
+	mustExec(t, d, "SET GLOBAL TimeZone = '"+name+"'")
+}
@@ -0,0 +1,432 @@
+package database
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DataPackFormatJSON = "json"
+	DataPackFormatCSV  = "csv"
+)
+
+var DataPackFormats = []string{DataPackFormatJSON, DataPackFormatCSV}
+
+var (
+	// ErrInvalidDataPack is wrapped by the errors caused by malformed packs.
+	ErrInvalidDataPack = errors.New("invalid data pack")
+	// ErrDataPackLoaded is returned when the version has already been loaded.
+	ErrDataPackLoaded = errors.New("data pack already loaded")
+)
+
+// lookupColumns maps the lookup tables of game content to the session columns
+// referring to them, in the order the tables are loaded.
+var lookupColumns = []struct {
+	table  string
+	column string
+}{
+	{"vehicle_classes", "vehicle_class_id"},
+	{"vehicle_manufacturers", "vehicle_manufacturer_id"},
+	{"locations", "location_id"},
+	{"routes", "route_id"},
+	{"vehicles", "vehicle_id"},
+}
+
+type DataPackEntry struct {
+	ID   uint16 `json:"id"`
+	Name string `json:"name"`
+}
+
+type DataPackRoute struct {
+	ID         uint16 `json:"id"`
+	LocationID uint16 `json:"location_id"`
+	Name       string `json:"name"`
+}
+
+type DataPackVehicle struct {
+	ID           uint16 `json:"id"`
+	Class        uint16 `json:"class"`
+	Manufacturer uint16 `json:"manufacturer"`
+	Name         string `json:"name"`
+	Builder      bool   `json:"builder"`
+}
+
+// DataPack has the game content of a game version. Loading it inserts new IDs
+// to the lookup tables and renames the existing ones, nothing is deleted.
+//
+// In JSON the tables are arrays of objects, e.g.
+//
+//	{"version": "1.9.0", "routes": [{"id": 24, "location_id": 5, "name": "Asco"}]}
+//
+// In CSV every row has the table and the columns used by it, and the version
+// is given as a row of the table "version":
+//
+//	table,id,name,location_id,class,manufacturer,builder
+//	version,,1.9.0,,,,
+//	routes,24,Asco,5,,,
+type DataPack struct {
+	Version              string            `json:"version"`
+	VehicleClasses       []DataPackEntry   `json:"vehicle_classes"`
+	VehicleManufacturers []DataPackEntry   `json:"vehicle_manufacturers"`
+	Locations            []DataPackEntry   `json:"locations"`
+	Routes               []DataPackRoute   `json:"routes"`
+	Vehicles             []DataPackVehicle `json:"vehicles"`
+}
+
+type DataPackLoad struct {
+	Version  string    `json:"version"`
+	LoadedAt time.Time `json:"loaded_at"`
+	RowCount int       `json:"row_count"`
+}
+
+// MissingLookup is an ID seen in sessions but missing from its lookup table.
+type MissingLookup struct {
+	Table    string    `json:"table"`
+	ID       int       `json:"id"`
+	Sessions int       `json:"sessions"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+func ParseDataPack(r io.Reader, format string) (*DataPack, error) {
+	var pack *DataPack
+	var err error
+	switch format {
+	case DataPackFormatJSON:
+		pack = &DataPack{}
+		if err := json.NewDecoder(r).Decode(pack); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDataPack, err)
+		}
+	case DataPackFormatCSV:
+		if pack, err = parseDataPackCSV(r); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown data pack format: %s", format)
+	}
+
+	if err := pack.validate(); err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+func parseDataPackCSV(r io.Reader) (*DataPack, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDataPack, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidDataPack)
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"table", "id", "name"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing column %s", ErrInvalidDataPack, name)
+		}
+	}
+
+	pack := &DataPack{}
+	for i, record := range records[1:] {
+		line := i + 2
+		field := func(name string) string {
+			if c, ok := columns[name]; ok && c < len(record) {
+				return strings.TrimSpace(record[c])
+			}
+			return ""
+		}
+		id := func(name string) (uint16, error) {
+			v, err := strconv.ParseUint(field(name), 10, 16)
+			if err != nil {
+				return 0, fmt.Errorf("%w: invalid %s on line %d", ErrInvalidDataPack, name, line)
+			}
+			return uint16(v), nil
+		}
+
+		table := field("table")
+		if table == "version" {
+			pack.Version = field("name")
+			continue
+		}
+		entryID, err := id("id")
+		if err != nil {
+			return nil, err
+		}
+		entry := DataPackEntry{ID: entryID, Name: field("name")}
+
+		switch table {
+		case "vehicle_classes":
+			pack.VehicleClasses = append(pack.VehicleClasses, entry)
+		case "vehicle_manufacturers":
+			pack.VehicleManufacturers = append(pack.VehicleManufacturers, entry)
+		case "locations":
+			pack.Locations = append(pack.Locations, entry)
+		case "routes":
+			locationID, err := id("location_id")
+			if err != nil {
+				return nil, err
+			}
+			pack.Routes = append(pack.Routes, DataPackRoute{ID: entry.ID, LocationID: locationID, Name: entry.Name})
+		case "vehicles":
+			class, err := id("class")
+			if err != nil {
+				return nil, err
+			}
+			manufacturer, err := id("manufacturer")
+			if err != nil {
+				return nil, err
+			}
+			builder := field("builder")
+			pack.Vehicles = append(pack.Vehicles, DataPackVehicle{
+				ID:           entry.ID,
+				Class:        class,
+				Manufacturer: manufacturer,
+				Name:         entry.Name,
+				Builder:      builder == "true" || builder == "1",
+			})
+		default:
+			return nil, fmt.Errorf("%w: unknown table %q on line %d", ErrInvalidDataPack, table, line)
+		}
+	}
+	return pack, nil
+}
+
+func (p *DataPack) validate() error {
+	p.Version = strings.TrimSpace(p.Version)
+	if p.Version == "" {
+		return fmt.Errorf("%w: version is required", ErrInvalidDataPack)
+	}
+
+	var names []struct{ table, name string }
+	for _, e := range p.VehicleClasses {
+		names = append(names, struct{ table, name string }{"vehicle_classes", e.Name})
+	}
+	for _, e := range p.VehicleManufacturers {
+		names = append(names, struct{ table, name string }{"vehicle_manufacturers", e.Name})
+	}
+	for _, e := range p.Locations {
+		names = append(names, struct{ table, name string }{"locations", e.Name})
+	}
+	for _, r := range p.Routes {
+		names = append(names, struct{ table, name string }{"routes", r.Name})
+	}
+	for _, v := range p.Vehicles {
+		names = append(names, struct{ table, name string }{"vehicles", v.Name})
+	}
+	for _, n := range names {
+		if strings.TrimSpace(n.name) == "" {
+			return fmt.Errorf("%w: every row of %s needs a name", ErrInvalidDataPack, n.table)
+		}
+	}
+	return nil
+}
+
+// LoadDataPack upserts the content of the pack to the lookup tables. A version
+// is loaded only once unless forced, e.g. to reload a fixed pack.
+func (d *Database) LoadDataPack(pack *DataPack, force bool) (*DataPackLoad, error) {
+	if err := pack.validate(); err != nil {
+		return nil, err
+	}
+
+	var loaded int
+	if err := d.queryRow("SELECT count(*) FROM data_packs WHERE version = ?", pack.Version).Scan(&loaded); err != nil {
+		return nil, fmt.Errorf("failed to query data packs: %w", err)
+	}
+	if loaded > 0 && !force {
+		return nil, fmt.Errorf("%w: %s", ErrDataPackLoaded, pack.Version)
+	}
+
+	tx, err := d.db.BeginTx(d.ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	rowCount := 0
+	upsert := func(table string, query string, args ...any) error {
+		if _, err := tx.ExecContext(d.ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to load %s: %w", table, err)
+		}
+		rowCount++
+		return nil
+	}
+	for _, e := range pack.VehicleClasses {
+		err := upsert("vehicle_classes", `
+			INSERT INTO vehicle_classes (id, name) VALUES (?, ?)
+			ON CONFLICT (id) DO UPDATE SET name = excluded.name
+		`, e.ID, e.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range pack.VehicleManufacturers {
+		err := upsert("vehicle_manufacturers", `
+			INSERT INTO vehicle_manufacturers (id, name) VALUES (?, ?)
+			ON CONFLICT (id) DO UPDATE SET name = excluded.name
+		`, e.ID, e.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range pack.Locations {
+		err := upsert("locations", `
+			INSERT INTO locations (id, name) VALUES (?, ?)
+			ON CONFLICT (id) DO UPDATE SET name = excluded.name
+		`, e.ID, e.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range pack.Routes {
+		err := upsert("routes", `
+			INSERT INTO routes (id, location_id, name) VALUES (?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET location_id = excluded.location_id, name = excluded.name
+		`, r.ID, r.LocationID, r.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range pack.Vehicles {
+		err := upsert("vehicles", `
+			INSERT INTO vehicles (id, class, manufacturer, name, builder) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				class = excluded.class,
+				manufacturer = excluded.manufacturer,
+				name = excluded.name,
+				builder = excluded.builder
+		`, v.ID, v.Class, v.Manufacturer, v.Name, v.Builder)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	load := DataPackLoad{Version: pack.Version, RowCount: rowCount}
+	err = tx.QueryRowContext(d.ctx, `
+		INSERT INTO data_packs (version, row_count) VALUES (?, ?)
+		ON CONFLICT (version) DO UPDATE SET loaded_at = now(), row_count = excluded.row_count
+		RETURNING loaded_at
+	`, pack.Version, rowCount).Scan(&load.LoadedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record data pack: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit data pack: %w", err)
+	}
+	slog.Info("data pack loaded", "version", pack.Version, "rows", rowCount)
+	return &load, nil
+}
+
+func (d *Database) GetDataPacks() ([]DataPackLoad, error) {
+	rows, err := d.query("SELECT version, loaded_at, row_count FROM data_packs ORDER BY loaded_at")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data packs: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	packs := []DataPackLoad{}
+	for rows.Next() {
+		var pack DataPackLoad
+		if err := rows.Scan(&pack.Version, &pack.LoadedAt, &pack.RowCount); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		packs = append(packs, pack)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return packs, nil
+}
+
+// missingLookupsSQL selects the IDs of sessions missing from the lookup
+// tables as (table, id, session_id, started_at), for the sessions matching
+// the condition. The condition is repeated for every lookup table.
+func missingLookupsSQL(condition string) string {
+	var queries []string
+	for _, l := range lookupColumns {
+		queries = append(queries, fmt.Sprintf(`
+			SELECT '%[1]s' AS lookup_table, s.%[2]s AS lookup_id, s.id AS session_id, s.started_at
+			FROM sessions s
+			WHERE %[3]s AND s.%[2]s IS NOT NULL AND s.%[2]s NOT IN (SELECT id FROM %[1]s)
+		`, l.table, l.column, condition))
+	}
+	return strings.Join(queries, "UNION ALL")
+}
+
+// GetMissingLookups returns the IDs seen in sessions which are not in the
+// lookup tables, i.e. the content missing from the loaded data packs.
+func (d *Database) GetMissingLookups() ([]MissingLookup, error) {
+	query := missingLookupsSQL("true")
+	rows, err := d.query(`
+		SELECT lookup_table, lookup_id, count(*), max(started_at)
+		FROM (` + query + `)
+		GROUP BY lookup_table, lookup_id
+		ORDER BY lookup_table, lookup_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query missing lookups: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	missing := []MissingLookup{}
+	for rows.Next() {
+		var m MissingLookup
+		if err := rows.Scan(&m.Table, &m.ID, &m.Sessions, &m.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		missing = append(missing, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return missing, nil
+}
+
+// logMissingLookups warns about the IDs of a started session which are not
+// in the lookup tables, so that a newer data pack can be loaded.
+func (d *Database) logMissingLookups(sessionID int) {
+	query := missingLookupsSQL("s.id = ?")
+	args := make([]any, len(lookupColumns))
+	for i := range args {
+		args[i] = sessionID
+	}
+	rows, err := d.query("SELECT lookup_table, lookup_id FROM ("+query+")", args...)
+	if err != nil {
+		slog.Error("failed to check lookups of session", "session_id", sessionID, "error", err)
+		return
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	for rows.Next() {
+		var table string
+		var id int
+		if err := rows.Scan(&table, &id); err != nil {
+			slog.Error("failed to check lookups of session", "session_id", sessionID, "error", err)
+			return
+		}
+		slog.Warn("unknown game content, load a newer data pack", "table", table, "id", id, "session_id", sessionID)
+	}
+}
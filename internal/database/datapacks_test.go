@@ -0,0 +1,136 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDataPack(t *testing.T) {
+	want := &DataPack{
+		Version:              "1.9.0",
+		VehicleClasses:       []DataPackEntry{{ID: 1, Name: "Rally1"}},
+		VehicleManufacturers: []DataPackEntry{{ID: 2, Name: "Ford"}},
+		Locations:            []DataPackEntry{{ID: 5, Name: "Spain"}},
+		Routes:               []DataPackRoute{{ID: 24, LocationID: 5, Name: "Asco"}},
+		Vehicles:             []DataPackVehicle{{ID: 7, Class: 1, Manufacturer: 2, Name: "Puma", Builder: true}},
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		want    *DataPack
+		wantErr error
+	}{
+		{
+			name:   "json",
+			format: DataPackFormatJSON,
+			input: `{
+				"version": " 1.9.0 ",
+				"vehicle_classes": [{"id": 1, "name": "Rally1"}],
+				"vehicle_manufacturers": [{"id": 2, "name": "Ford"}],
+				"locations": [{"id": 5, "name": "Spain"}],
+				"routes": [{"id": 24, "location_id": 5, "name": "Asco"}],
+				"vehicles": [{"id": 7, "class": 1, "manufacturer": 2, "name": "Puma", "builder": true}]
+			}`,
+			want: want,
+		},
+		{
+			name:   "csv",
+			format: DataPackFormatCSV,
+			input: "table, id, name, location_id, class, manufacturer, builder\n" +
+				"version,,1.9.0\n" +
+				"vehicle_classes,1,Rally1\n" +
+				"vehicle_manufacturers,2,Ford,,,,\n" +
+				"locations,5,Spain,,,,\n" +
+				"routes,24,Asco,5,,,\n" +
+				"vehicles,7,Puma,,1,2,true\n",
+			want: want,
+		},
+		{
+			name:   "csv columns in any order",
+			format: DataPackFormatCSV,
+			input:  "name,table,id\n1.9.0,version,\nSpain,locations,5\n",
+			want:   &DataPack{Version: "1.9.0", Locations: []DataPackEntry{{ID: 5, Name: "Spain"}}},
+		},
+		{"invalid json", DataPackFormatJSON, `{"version": 1}`, nil, ErrInvalidDataPack},
+		{"missing version", DataPackFormatJSON, `{"locations": [{"id": 5, "name": "Spain"}]}`, nil, ErrInvalidDataPack},
+		{"missing name", DataPackFormatJSON, `{"version": "1.9.0", "routes": [{"id": 24, "location_id": 5}]}`, nil, ErrInvalidDataPack},
+		{"empty csv", DataPackFormatCSV, "", nil, ErrInvalidDataPack},
+		{"missing csv column", DataPackFormatCSV, "table,id\nversion,\n", nil, ErrInvalidDataPack},
+		{"invalid csv id", DataPackFormatCSV, "table,id,name\nversion,,1.9.0\nlocations,x,Spain\n", nil, ErrInvalidDataPack},
+		{"id out of range", DataPackFormatCSV, "table,id,name\nversion,,1.9.0\nlocations,70000,Spain\n", nil, ErrInvalidDataPack},
+		{"missing route location", DataPackFormatCSV, "table,id,name\nversion,,1.9.0\nroutes,24,Asco\n", nil, ErrInvalidDataPack},
+		{"unknown table", DataPackFormatCSV, "table,id,name\nversion,,1.9.0\nstages,1,Asco\n", nil, ErrInvalidDataPack},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDataPack(strings.NewReader(tt.input), tt.format)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseDataPack(strings.NewReader("{}"), "xml"); err == nil {
+		t.Error("parsed an unknown format")
+	}
+}
+
+func TestLoadDataPack(t *testing.T) {
+	d := newTestDatabase(t)
+	pack := &DataPack{
+		Version:   "test-1",
+		Locations: []DataPackEntry{{ID: 9001, Name: "Test location"}},
+		Routes:    []DataPackRoute{{ID: 9002, LocationID: 9001, Name: "Test route"}},
+	}
+
+	load, err := d.LoadDataPack(pack, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if load.RowCount != 2 {
+		t.Errorf("loaded %d rows, want 2", load.RowCount)
+	}
+
+	pack.Routes[0].Name = "Renamed route"
+	if _, err := d.LoadDataPack(pack, false); !errors.Is(err, ErrDataPackLoaded) {
+		t.Fatalf("got error %v, want %v", err, ErrDataPackLoaded)
+	}
+	if _, err := d.LoadDataPack(pack, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	if err := d.queryRow("SELECT name FROM routes WHERE id = 9002").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "Renamed route" {
+		t.Errorf("got route %q, want the renamed route", name)
+	}
+
+	packs, err := d.GetDataPacks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := 0
+	for _, p := range packs {
+		if p.Version == pack.Version {
+			versions++
+		}
+	}
+	if versions != 1 {
+		t.Errorf("got version %s %d times, want once", pack.Version, versions)
+	}
+}
@@ -97,6 +97,8 @@ func (d *Database) StartEvent(id int) error {
 }
 
 func (d *Database) EndEvent(id int) error {
+	d.backupBefore(fmt.Sprintf("end-event-%d", id))
+
 	query := `
 		UPDATE race_events
 		SET active = FALSE, ended_at = CURRENT_TIMESTAMP
@@ -120,6 +122,11 @@ func (d *Database) EndEvent(id int) error {
 		return fmt.Errorf("failed to calculate and store event results: %w", err)
 	}
 
+	err = d.UpdateEventRatings(id)
+	if err != nil {
+		return fmt.Errorf("failed to update driver ratings: %w", err)
+	}
+
 	// TODO Calculate points when event ends
 	activeEventID = sql.NullInt32{}
 	return nil
@@ -222,3 +229,88 @@ func (d *Database) GetEvent(id int) (*RaceEvent, error) {
 
 	return &event, nil
 }
+
+type EventSummary struct {
+	ID               int        `json:"id"`
+	Name             string     `json:"name"`
+	SeriesID         *int       `json:"series_id"`
+	SeriesName       *string    `json:"series_name"`
+	LocationID       *uint16    `json:"location_id"`
+	LocationName     *string    `json:"location_name"`
+	RouteID          *uint16    `json:"route_id"`
+	RouteName        *string    `json:"route_name"`
+	VehicleClassID   *uint16    `json:"vehicle_class_id"`
+	VehicleClassName *string    `json:"vehicle_class_name"`
+	Active           bool       `json:"active"`
+	SessionCount     int        `json:"session_count"`
+	CreatedAt        *time.Time `json:"created_at"`
+	StartedAt        *time.Time `json:"started_at"`
+	EndedAt          *time.Time `json:"ended_at"`
+}
+
+// ListEvents returns the events of the series, or every event if the series
+// is not given, newest first.
+func (d *Database) ListEvents(seriesID sql.NullInt32) ([]EventSummary, error) {
+	rows, err := d.query(`
+		SELECT
+			e.id,
+			e.name,
+			e.race_series_id,
+			s.name,
+			e.location_id,
+			l.name,
+			e.route_id,
+			r.name,
+			e.vehicle_class_id,
+			vc.name,
+			e.active,
+			(SELECT COUNT(*) FROM sessions ss WHERE ss.race_event_id = e.id),
+			e.created_at,
+			e.started_at,
+			e.ended_at
+		FROM race_events e
+		LEFT JOIN race_series s ON s.id = e.race_series_id
+		LEFT JOIN locations l ON l.id = e.location_id
+		LEFT JOIN routes r ON r.id = e.route_id
+		LEFT JOIN vehicle_classes vc ON vc.id = e.vehicle_class_id
+		WHERE ? IS NULL OR e.race_series_id = ?
+		ORDER BY e.id DESC
+	`, seriesID, seriesID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	events := []EventSummary{}
+	for rows.Next() {
+		var e EventSummary
+		if err := rows.Scan(
+			&e.ID,
+			&e.Name,
+			&e.SeriesID,
+			&e.SeriesName,
+			&e.LocationID,
+			&e.LocationName,
+			&e.RouteID,
+			&e.RouteName,
+			&e.VehicleClassID,
+			&e.VehicleClassName,
+			&e.Active,
+			&e.SessionCount,
+			&e.CreatedAt,
+			&e.StartedAt,
+			&e.EndedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return events, nil
+}
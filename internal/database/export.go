@@ -0,0 +1,481 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExportFormatCSV     = "csv"
+	ExportFormatJSON    = "json"
+	ExportFormatParquet = "parquet"
+	// CSV layout of MoTeC i2, which most motorsport telemetry viewers import
+	ExportFormatMoTeC = "motec"
+)
+
+var ExportFormats = []string{ExportFormatCSV, ExportFormatJSON, ExportFormatParquet, ExportFormatMoTeC}
+
+// Units are written at the end of the column comments, e.g. "[metre]"
+var columnUnitPattern = regexp.MustCompile(`\s*\[([^\]]+)\]\s*$`)
+
+// Short forms of the units used in the schema
+var unitSymbols = map[string]string{
+	"metre":                    "m",
+	"second":                   "s",
+	"metre per second":         "m/s",
+	"metre per second squared": "m/s/s",
+	"degree Celsius":           "C",
+	"revolution per minute":    "rpm",
+}
+
+type TelemetryChannel struct {
+	Name        string `json:"name"`
+	Unit        string `json:"unit"`
+	Description string `json:"description"`
+}
+
+type SessionMetadata struct {
+	SessionID              int       `json:"session_id"`
+	StartedAt              time.Time `json:"started_at"`
+	UserID                 *string   `json:"user_id"`
+	UserName               *string   `json:"user_name"`
+	RaceEventID            *int      `json:"race_event_id"`
+	LocationID             *uint16   `json:"location_id"`
+	LocationName           *string   `json:"location_name"`
+	RouteID                *uint16   `json:"route_id"`
+	RouteName              *string   `json:"route_name"`
+	VehicleID              *uint16   `json:"vehicle_id"`
+	VehicleName            *string   `json:"vehicle_name"`
+	VehicleClassID         *uint16   `json:"vehicle_class_id"`
+	VehicleClassName       *string   `json:"vehicle_class_name"`
+	StageLength            *float64  `json:"stage_length"`
+	StageResultStatus      *uint16   `json:"stage_result_status"`
+	StageResultTime        *float32  `json:"stage_result_time"`
+	StageResultTimePenalty *float32  `json:"stage_result_time_penalty"`
+	StageShakedown         *bool     `json:"stage_shakedown"`
+}
+
+// GetSessionMetadata returns the session with the names of the driver, route
+// and vehicle. Returns nil if the session is not found.
+func (d *Database) GetSessionMetadata(sessionID int) (*SessionMetadata, error) {
+	var m SessionMetadata
+	err := d.queryRow(`
+		SELECT
+			s.id,
+			s.started_at,
+			s.user_id,
+			u.name,
+			s.race_event_id,
+			s.location_id,
+			l.name,
+			s.route_id,
+			r.name,
+			s.vehicle_id,
+			v.name,
+			s.vehicle_class_id,
+			vc.name,
+			s.stage_length,
+			s.stage_result_status,
+			s.stage_result_time,
+			s.stage_result_time_penalty,
+			s.stage_shakedown
+		FROM sessions s
+		LEFT JOIN users u ON u.id = s.user_id
+		LEFT JOIN locations l ON l.id = s.location_id
+		LEFT JOIN routes r ON r.id = s.route_id
+		LEFT JOIN vehicles v ON v.id = s.vehicle_id
+		LEFT JOIN vehicle_classes vc ON vc.id = s.vehicle_class_id
+		WHERE s.id = ?
+	`, sessionID).Scan(
+		&m.SessionID,
+		&m.StartedAt,
+		&m.UserID,
+		&m.UserName,
+		&m.RaceEventID,
+		&m.LocationID,
+		&m.LocationName,
+		&m.RouteID,
+		&m.RouteName,
+		&m.VehicleID,
+		&m.VehicleName,
+		&m.VehicleClassID,
+		&m.VehicleClassName,
+		&m.StageLength,
+		&m.StageResultStatus,
+		&m.StageResultTime,
+		&m.StageResultTimePenalty,
+		&m.StageShakedown,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No session found
+		}
+		return nil, fmt.Errorf("failed to fetch session: %w", err)
+	}
+	return &m, nil
+}
+
+// GetTelemetryChannels returns the telemetry columns with the units and
+// descriptions from the schema comments.
+func (d *Database) GetTelemetryChannels() ([]TelemetryChannel, error) {
+	rows, err := d.query(`
+		SELECT column_name, COALESCE(comment, '')
+		FROM duckdb_columns()
+		WHERE table_name = 'telemetry' AND column_name != 'session_id'
+		ORDER BY column_index ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query telemetry columns: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	var channels []TelemetryChannel
+	for rows.Next() {
+		var c TelemetryChannel
+		var comment string
+		if err := rows.Scan(&c.Name, &comment); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		c.Description = comment
+		if match := columnUnitPattern.FindStringSubmatch(comment); match != nil {
+			c.Unit = match[1]
+			c.Description = strings.TrimSpace(comment[:len(comment)-len(match[0])])
+		}
+		channels = append(channels, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return channels, nil
+}
+
+// quoteString quotes s as an SQL string literal for statements which don't
+// support parameters, such as COPY and ATTACH.
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func unitSymbol(unit string) string {
+	if symbol, ok := unitSymbols[unit]; ok {
+		return symbol
+	}
+	return unit
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// queryTelemetryRows calls fn for every telemetry row of the session with the
+// values in the order of the channels.
+func (d *Database) queryTelemetryRows(sessionID int, channels []TelemetryChannel, fn func([]any) error) error {
+	columns := make([]string, len(channels))
+	for i, c := range channels {
+		columns[i] = c.Name
+	}
+
+	rows, err := d.query(fmt.Sprintf(`
+		SELECT %s
+		FROM telemetry
+		WHERE session_id = ?
+		ORDER BY rowid ASC
+	`, strings.Join(columns, ", ")), sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to query telemetry: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	values := make([]any, len(channels))
+	pointers := make([]any, len(channels))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return nil
+}
+
+// ExportSession writes the session metadata and telemetry to w in the given
+// format.
+func (d *Database) ExportSession(session *SessionMetadata, format string, w io.Writer) error {
+	channels, err := d.GetTelemetryChannels()
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case ExportFormatCSV:
+		return d.exportCSV(session, channels, w)
+	case ExportFormatJSON:
+		return d.exportJSON(session, channels, w)
+	case ExportFormatParquet:
+		return d.exportParquet(session, channels, w)
+	case ExportFormatMoTeC:
+		return d.exportMoTeC(session, channels, w)
+	default:
+		return fmt.Errorf("unknown export format: %s", format)
+	}
+}
+
+// metadataValue formats an optional session field, nil as empty.
+func metadataValue[T any](v *T) string {
+	if v == nil {
+		return ""
+	}
+	return formatValue(*v)
+}
+
+// writeMetadataComments writes the session as "# name: value" lines, which
+// CSV readers skip with a comment character option such as comment='#' of
+// DuckDB and pandas.
+func writeMetadataComments(session *SessionMetadata, w io.Writer) error {
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"session_id", strconv.Itoa(session.SessionID)},
+		{"started_at", session.StartedAt.Format(time.RFC3339)},
+		{"user_id", metadataValue(session.UserID)},
+		{"user_name", metadataValue(session.UserName)},
+		{"race_event_id", metadataValue(session.RaceEventID)},
+		{"location_id", metadataValue(session.LocationID)},
+		{"location_name", metadataValue(session.LocationName)},
+		{"route_id", metadataValue(session.RouteID)},
+		{"route_name", metadataValue(session.RouteName)},
+		{"vehicle_id", metadataValue(session.VehicleID)},
+		{"vehicle_name", metadataValue(session.VehicleName)},
+		{"vehicle_class_id", metadataValue(session.VehicleClassID)},
+		{"vehicle_class_name", metadataValue(session.VehicleClassName)},
+		{"stage_length", metadataValue(session.StageLength)},
+		{"stage_result_status", metadataValue(session.StageResultStatus)},
+		{"stage_result_time", metadataValue(session.StageResultTime)},
+		{"stage_result_time_penalty", metadataValue(session.StageResultTimePenalty)},
+		{"stage_shakedown", metadataValue(session.StageShakedown)},
+	}
+	oneLine := strings.NewReplacer("\r", " ", "\n", " ")
+	for _, f := range fields {
+		if _, err := fmt.Fprintf(w, "# %s: %s\n", f.name, oneLine.Replace(f.value)); err != nil {
+			return fmt.Errorf("failed to write csv: %w", err)
+		}
+	}
+	return nil
+}
+
+// exportCSV writes the session as comment lines followed by one row per
+// sample with the units in the header, e.g. "vehicle_speed [m/s]".
+func (d *Database) exportCSV(session *SessionMetadata, channels []TelemetryChannel, w io.Writer) error {
+	if err := writeMetadataComments(session, w); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+
+	header := make([]string, len(channels))
+	for i, c := range channels {
+		header[i] = c.Name
+		if c.Unit != "" {
+			header[i] += " [" + unitSymbol(c.Unit) + "]"
+		}
+	}
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+
+	record := make([]string, len(channels))
+	err := d.queryTelemetryRows(session.SessionID, channels, func(values []any) error {
+		for i, v := range values {
+			record[i] = formatValue(v)
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (d *Database) exportJSON(session *SessionMetadata, channels []TelemetryChannel, w io.Writer) error {
+	samples := [][]any{}
+	err := d.queryTelemetryRows(session.SessionID, channels, func(values []any) error {
+		samples = append(samples, append([]any(nil), values...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		Session  *SessionMetadata   `json:"session"`
+		Channels []TelemetryChannel `json:"channels"`
+		Samples  [][]any            `json:"samples"`
+	}{session, channels, samples})
+}
+
+// exportParquet lets DuckDB write the Parquet file, which is then copied to
+// w. Session metadata and units are stored as key-value metadata of the file.
+func (d *Database) exportParquet(session *SessionMetadata, channels []TelemetryChannel, w io.Writer) error {
+	file, err := os.CreateTemp("", "wrc-laptimer-export-*.parquet")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	path := file.Name()
+	defer os.Remove(path) //nolint:errcheck
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	metadata, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+	units := make(map[string]string, len(channels))
+	for _, c := range channels {
+		units[c.Name] = c.Unit
+	}
+	unitMetadata, err := json.Marshal(units)
+	if err != nil {
+		return fmt.Errorf("failed to encode units: %w", err)
+	}
+
+	_, err = d.exec(fmt.Sprintf(`
+		COPY (
+			SELECT * EXCLUDE (session_id)
+			FROM telemetry
+			WHERE session_id = %d
+			ORDER BY rowid ASC
+		) TO %s (FORMAT PARQUET, KV_METADATA {session: %s, units: %s})
+	`, session.SessionID, quoteString(path), quoteString(string(metadata)), quoteString(string(unitMetadata))))
+	if err != nil {
+		return fmt.Errorf("failed to write parquet: %w", err)
+	}
+
+	// DuckDB replaces the file, so it is opened only after writing
+	file, err = os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open parquet: %w", err)
+	}
+	defer file.Close() //nolint:errcheck
+
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("failed to copy parquet: %w", err)
+	}
+	return nil
+}
+
+// exportMoTeC writes the CSV layout of MoTeC i2: a header block with the
+// session details, channel names, units and the samples. Time is the first
+// channel as the viewers expect.
+func (d *Database) exportMoTeC(session *SessionMetadata, channels []TelemetryChannel, w io.Writer) error {
+	ordered := make([]TelemetryChannel, 0, len(channels))
+	for _, c := range channels {
+		if c.Name == "stage_current_time" {
+			ordered = append([]TelemetryChannel{c}, ordered...)
+		} else {
+			ordered = append(ordered, c)
+		}
+	}
+
+	var sampleCount int
+	var duration float32
+	err := d.queryRow(`
+		SELECT COUNT(*), COALESCE(MAX(stage_current_time) - MIN(stage_current_time), 0)
+		FROM telemetry
+		WHERE session_id = ?
+	`, session.SessionID).Scan(&sampleCount, &duration)
+	if err != nil {
+		return fmt.Errorf("failed to fetch telemetry duration: %w", err)
+	}
+	var sampleRate float64
+	if duration > 0 {
+		sampleRate = float64(sampleCount-1) / float64(duration)
+	}
+
+	text := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+
+	writer := csv.NewWriter(w)
+	header := [][]string{
+		{"Format", "MoTeC CSV File"},
+		{"Venue", strings.TrimSpace(text(session.LocationName) + " " + text(session.RouteName))},
+		{"Vehicle", text(session.VehicleName)},
+		{"Driver", text(session.UserName)},
+		{"Device", "WRC Laptimer"},
+		{"Comment", fmt.Sprintf("Session %d", session.SessionID)},
+		{"Log Date", session.StartedAt.Format("02/01/2006")},
+		{"Log Time", session.StartedAt.Format("15:04:05")},
+		{"Sample Rate", strconv.FormatFloat(sampleRate, 'f', 0, 64)},
+		{"Duration", strconv.FormatFloat(float64(duration), 'f', 3, 32)},
+		{},
+	}
+	names := make([]string, len(ordered))
+	units := make([]string, len(ordered))
+	for i, c := range ordered {
+		names[i] = c.Name
+		units[i] = unitSymbol(c.Unit)
+	}
+	names[0] = "Time"
+	header = append(header, names, units, []string{})
+	if err := writer.WriteAll(header); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+
+	record := make([]string, len(ordered))
+	err = d.queryTelemetryRows(session.SessionID, ordered, func(values []any) error {
+		for i, v := range values {
+			record[i] = formatValue(v)
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
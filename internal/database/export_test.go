@@ -0,0 +1,56 @@
+package database
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportCSV(t *testing.T) {
+	d := newTestDatabase(t)
+	mustExec(t, d,
+		"INSERT INTO users (id, name) VALUES ('a', 'Alice')",
+		`INSERT INTO sessions (id, user_id, route_id, stage_result_status, stage_result_time, stage_shakedown, started_at)
+			VALUES (4, 'a', 7, 1, 123.5, false, '2025-03-01 18:30:00')`,
+		`INSERT INTO telemetry (session_id, stage_current_time, stage_current_distance, vehicle_speed)
+			VALUES (4, 0, 0, 0), (4, 0.5, 5, 20), (4, 1, 15, 25)`,
+	)
+
+	session, err := d.GetSessionMetadata(4)
+	if err != nil {
+		t.Fatalf("failed to get session: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := d.ExportSession(session, ExportFormatCSV, &buf); err != nil {
+		t.Fatalf("failed to export session: %v", err)
+	}
+
+	for _, line := range []string{
+		"# session_id: 4\n",
+		"# user_name: Alice\n",
+		"# route_id: 7\n",
+		"# vehicle_id: \n",
+		"# stage_result_time: 123.5\n",
+		"# stage_shakedown: 0\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("export has no line %q", strings.TrimSpace(line))
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "session.csv")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var rows int
+	var speed float64
+	err = d.queryRow(`SELECT count(*), max("vehicle_speed [m/s]") FROM read_csv(?, comment = '#', header = true)`, path).Scan(&rows, &speed)
+	if err != nil {
+		t.Fatalf("failed to read export: %v", err)
+	}
+	if rows != 3 || speed != 25 {
+		t.Errorf("read %d rows with top speed %v, want 3 rows with 25", rows, speed)
+	}
+}
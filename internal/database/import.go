@@ -0,0 +1,769 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Name of the attached source database during an import
+const importSource = "import_source"
+
+// ImportReport tells how many rows were merged and which rows were skipped or
+// changed on the way.
+type ImportReport struct {
+	Users         int      `json:"users"`
+	UserLogins    int      `json:"user_logins"`
+	Series        int      `json:"series"`
+	Events        int      `json:"events"`
+	Results       int      `json:"results"`
+	SeriesResults int      `json:"series_results"`
+	Sessions      int      `json:"sessions"`
+	Telemetry     int      `json:"telemetry"`
+	Achievements  int      `json:"achievements"`
+	Splits        int      `json:"splits"`
+	Incidents     int      `json:"incidents"`
+	Conflicts     []string `json:"conflicts"`
+}
+
+func (r *ImportReport) conflict(format string, args ...any) {
+	r.Conflicts = append(r.Conflicts, fmt.Sprintf(format, args...))
+}
+
+// importMap maps the IDs of a source table to the IDs in this database. Rows
+// which already exist (matched by the condition, "s" being the source row and
+// "e" the existing row) keep the existing ID and are not inserted again.
+type importMap struct {
+	name      string
+	table     string
+	sequence  string
+	condition string
+}
+
+var importMaps = []importMap{
+	{
+		name:      "import_race_series",
+		table:     "race_series",
+		sequence:  "race_series_id_sequence",
+		condition: "e.name IS NOT DISTINCT FROM s.name AND e.created_at IS NOT DISTINCT FROM s.created_at",
+	},
+	{
+		name:      "import_race_events",
+		table:     "race_events",
+		sequence:  "race_events_id_sequence",
+		condition: "e.name IS NOT DISTINCT FROM s.name AND e.created_at IS NOT DISTINCT FROM s.created_at",
+	},
+	{
+		name:     "import_results",
+		table:    "results",
+		sequence: "results_id_sequence",
+		condition: `e.user_id IS NOT DISTINCT FROM s.user_id
+			AND e.race_event_id IS NOT DISTINCT FROM (SELECT new_id FROM import_race_events WHERE old_id = s.race_event_id)
+			AND e.hc_mode IS NOT DISTINCT FROM s.hc_mode`,
+	},
+	{
+		name:     "import_series_results",
+		table:    "series_results",
+		sequence: "series_results_id_sequence",
+		condition: `e.user_id IS NOT DISTINCT FROM s.user_id
+			AND e.race_series_id IS NOT DISTINCT FROM (SELECT new_id FROM import_race_series WHERE old_id = s.race_series_id)
+			AND e.hc_mode IS NOT DISTINCT FROM s.hc_mode`,
+	},
+	{
+		name:      "import_sessions",
+		table:     "sessions",
+		sequence:  "session_id_sequence",
+		condition: "e.started_at = s.started_at AND e.user_id IS NOT DISTINCT FROM s.user_id AND e.route_id IS NOT DISTINCT FROM s.route_id",
+	},
+}
+
+// Rows of these tables are copied for the imported sessions only
+var importSessionTables = []string{"telemetry", "session_splits", "session_incidents", "session_corrections"}
+
+func createImportMap(ctx context.Context, tx *sql.Tx, m importMap) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		CREATE OR REPLACE TEMP TABLE %[1]s AS
+		WITH matched AS (
+			SELECT s.id AS old_id, (SELECT min(e.id) FROM %[2]s e WHERE %[4]s) AS existing_id
+			FROM %[5]s.%[2]s s
+			ORDER BY s.id
+		)
+		SELECT
+			old_id,
+			existing_id,
+			CASE WHEN existing_id IS NULL THEN nextval('%[3]s') ELSE existing_id END AS new_id
+		FROM matched
+	`, m.name, m.table, m.sequence, m.condition, importSource))
+	if err != nil {
+		return fmt.Errorf("failed to map %s: %w", m.table, err)
+	}
+	return nil
+}
+
+func execCount(ctx context.Context, tx *sql.Tx, query string, args ...any) (int, error) {
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func countSkipped(ctx context.Context, tx *sql.Tx, m importMap) (int, error) {
+	var n int
+	err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE existing_id IS NOT NULL", m.name)).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count existing %s: %w", m.table, err)
+	}
+	return n, nil
+}
+
+// ImportFile merges a session export (.json or .parquet) or another
+// wrc-laptimer DuckDB database into this database. With dryRun the import is
+// rolled back and only the report is returned.
+func (d *Database) ImportFile(path string, dryRun bool) (*ImportReport, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to read import file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return d.importSessionExport(path, ExportFormatJSON, dryRun)
+	case ".parquet":
+		return d.importSessionExport(path, ExportFormatParquet, dryRun)
+	default:
+		return d.importDatabase(path, dryRun)
+	}
+}
+
+// importDatabase merges every user, series, event, result and session of
+// another database. Series, events, results and sessions get new IDs from
+// the sequences of this database; users are matched by their card ID.
+func (d *Database) importDatabase(path string, dryRun bool) (*ImportReport, error) {
+	ctx := d.ctx
+	report := &ImportReport{Conflicts: []string{}}
+
+	// Temporary tables and the attached database are bound to the connection
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("ATTACH %s AS %s (READ_ONLY)", quoteString(path), importSource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach import database: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "DETACH "+importSource); err != nil {
+			fmt.Printf("failed to detach import database: %v\n", err)
+		}
+	}()
+
+	var sourceTables []string
+	rows, err := conn.QueryContext(ctx, "SELECT table_name FROM duckdb_tables() WHERE database_name = ?", importSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list import tables: %w", err)
+	}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close() //nolint:errcheck
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		sourceTables = append(sourceTables, table)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close rows: %w", err)
+	}
+	for _, table := range []string{"users", "race_series", "race_events", "results", "series_results", "sessions"} {
+		if !slices.Contains(sourceTables, table) {
+			return nil, fmt.Errorf("import database has no %s table", table)
+		}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	// Users are identified by the card ID, so the same card is the same user
+	// in both databases. The local name wins.
+	rows, err = tx.QueryContext(ctx, fmt.Sprintf(`
+		SELECT s.id, e.name, s.name
+		FROM %s.users s
+		JOIN users e ON e.id = s.id
+		WHERE e.name IS DISTINCT FROM s.name
+		ORDER BY s.id
+	`, importSource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare users: %w", err)
+	}
+	for rows.Next() {
+		var id string
+		var name, importedName sql.NullString
+		if err := rows.Scan(&id, &name, &importedName); err != nil {
+			rows.Close() //nolint:errcheck
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		report.conflict("user %s: kept name %q instead of imported %q", id, name.String, importedName.String)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	report.Users, err = execCount(ctx, tx, fmt.Sprintf(`
+		INSERT INTO users (id, name)
+		SELECT id, name
+		FROM %s.users
+		WHERE id NOT IN (SELECT id FROM users)
+	`, importSource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to import users: %w", err)
+	}
+
+	// Logout columns are copied by name if the source has them
+	if slices.Contains(sourceTables, "user_logins") {
+		report.UserLogins, err = execCount(ctx, tx, fmt.Sprintf(`
+			INSERT INTO user_logins BY NAME
+			SELECT s.* REPLACE (false AS active)
+			FROM %s.user_logins s
+			WHERE NOT EXISTS (
+				SELECT 1 FROM user_logins e WHERE e.timestamp = s.timestamp AND e.user_id = s.user_id
+			)
+		`, importSource))
+		if err != nil {
+			return nil, fmt.Errorf("failed to import user logins: %w", err)
+		}
+	}
+
+	// Databases from before cards were added have only the card of the user ID
+	if slices.Contains(sourceTables, "user_cards") {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+			INSERT INTO user_cards (card_id, user_id, created_at, revoked_at)
+			SELECT card_id, user_id, created_at, revoked_at
+			FROM %s.user_cards
+			WHERE card_id NOT IN (SELECT card_id FROM user_cards)
+		`, importSource))
+		if err != nil {
+			return nil, fmt.Errorf("failed to import user cards: %w", err)
+		}
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_cards (card_id, user_id)
+		SELECT id, id
+		FROM users
+		WHERE id NOT IN (SELECT user_id FROM user_cards)
+			AND id NOT IN (SELECT card_id FROM user_cards)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add cards of imported users: %w", err)
+	}
+
+	// Existing profiles are kept
+	if slices.Contains(sourceTables, "user_profiles") {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+			INSERT INTO user_profiles (user_id, nationality, favourite_vehicle_id, avatar, avatar_content_type, claimed_at, updated_at)
+			SELECT user_id, nationality, favourite_vehicle_id, avatar, avatar_content_type, claimed_at, updated_at
+			FROM %s.user_profiles
+			WHERE user_id NOT IN (SELECT user_id FROM user_profiles)
+		`, importSource))
+		if err != nil {
+			return nil, fmt.Errorf("failed to import user profiles: %w", err)
+		}
+	}
+
+	// Existing PINs are kept. Salts are copied by name if the source has them.
+	if slices.Contains(sourceTables, "user_pins") {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+			INSERT INTO user_pins BY NAME
+			SELECT *
+			FROM %s.user_pins
+			WHERE user_id NOT IN (SELECT user_id FROM user_pins)
+		`, importSource))
+		if err != nil {
+			return nil, fmt.Errorf("failed to import user PINs: %w", err)
+		}
+	}
+
+	for _, m := range importMaps {
+		if err := createImportMap(ctx, tx, m); err != nil {
+			return nil, err
+		}
+
+		skipped, err := countSkipped(ctx, tx, m)
+		if err != nil {
+			return nil, err
+		}
+		if skipped > 0 {
+			report.conflict("%d %s already exist and were skipped", skipped, strings.ReplaceAll(m.table, "_", " "))
+		}
+	}
+
+	var active int
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT
+			(SELECT COUNT(*) FROM %[1]s.race_series WHERE active) +
+			(SELECT COUNT(*) FROM %[1]s.race_events WHERE active)
+	`, importSource)).Scan(&active)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count active series and events: %w", err)
+	}
+	if active > 0 {
+		report.conflict("%d active series or events were imported as inactive", active)
+	}
+
+	// The parent series reference is checked against the rows inserted by
+	// earlier statements only, so parents are inserted first
+	for {
+		n, err := execCount(ctx, tx, fmt.Sprintf(`
+			INSERT INTO race_series (id, parent_series, name, vehicle_class_id, point_scale, active, created_at, started_at, ended_at)
+			SELECT m.new_id, p.new_id, s.name, s.vehicle_class_id, s.point_scale, false, s.created_at, s.started_at, s.ended_at
+			FROM %s.race_series s
+			JOIN import_race_series m ON m.old_id = s.id AND m.existing_id IS NULL
+			LEFT JOIN import_race_series p ON p.old_id = s.parent_series
+			WHERE m.new_id NOT IN (SELECT id FROM race_series)
+				AND (p.new_id IS NULL OR p.new_id IN (SELECT id FROM race_series))
+			ORDER BY s.id
+		`, importSource))
+		if err != nil {
+			return nil, fmt.Errorf("failed to import series: %w", err)
+		}
+		if n == 0 {
+			break
+		}
+		report.Series += n
+	}
+
+	report.Events, err = execCount(ctx, tx, fmt.Sprintf(`
+		INSERT INTO race_events (id, race_series_id, name, location_id, route_id, vehicle_class_id, point_scale, active, created_at, started_at, ended_at)
+		SELECT m.new_id, p.new_id, s.name, s.location_id, s.route_id, s.vehicle_class_id, s.point_scale, false, s.created_at, s.started_at, s.ended_at
+		FROM %s.race_events s
+		JOIN import_race_events m ON m.old_id = s.id AND m.existing_id IS NULL
+		LEFT JOIN import_race_series p ON p.old_id = s.race_series_id
+		ORDER BY s.id
+	`, importSource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to import events: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, fmt.Sprintf(`
+		SELECT s.user_id, m.existing_id, e.result_time, s.result_time
+		FROM %s.results s
+		JOIN import_results m ON m.old_id = s.id AND m.existing_id IS NOT NULL
+		JOIN results e ON e.id = m.existing_id
+		WHERE e.result_time IS DISTINCT FROM s.result_time
+		ORDER BY m.existing_id
+	`, importSource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare results: %w", err)
+	}
+	for rows.Next() {
+		var userID string
+		var resultID int
+		var resultTime, importedTime sql.NullFloat64
+		if err := rows.Scan(&userID, &resultID, &resultTime, &importedTime); err != nil {
+			rows.Close() //nolint:errcheck
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		report.conflict("result %d of user %s: kept time %.3f instead of imported %.3f", resultID, userID, resultTime.Float64, importedTime.Float64)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	report.Results, err = execCount(ctx, tx, fmt.Sprintf(`
+		INSERT INTO results (id, user_id, race_event_id, created_at, points, hc_mode, position, result_time)
+		SELECT m.new_id, s.user_id, e.new_id, s.created_at, s.points, s.hc_mode, s.position, s.result_time
+		FROM %s.results s
+		JOIN import_results m ON m.old_id = s.id AND m.existing_id IS NULL
+		LEFT JOIN import_race_events e ON e.old_id = s.race_event_id
+		ORDER BY s.id
+	`, importSource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to import results: %w", err)
+	}
+
+	report.SeriesResults, err = execCount(ctx, tx, fmt.Sprintf(`
+		INSERT INTO series_results (id, user_id, race_series_id, created_at, points, hc_mode, race_count, position, result_time)
+		SELECT m.new_id, s.user_id, p.new_id, s.created_at, s.points, s.hc_mode, s.race_count, s.position, s.result_time
+		FROM %s.series_results s
+		JOIN import_series_results m ON m.old_id = s.id AND m.existing_id IS NULL
+		LEFT JOIN import_race_series p ON p.old_id = s.race_series_id
+		ORDER BY s.id
+	`, importSource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to import series results: %w", err)
+	}
+
+	report.Sessions, err = execCount(ctx, tx, fmt.Sprintf(`
+		INSERT INTO sessions (
+			id, started_at, user_id, race_event_id, game_mode, location_id, route_id, stage_length,
+			stage_result_status, stage_result_time, stage_result_time_penalty, stage_shakedown,
+			vehicle_class_id, vehicle_id, vehicle_manufacturer_id
+		)
+		SELECT
+			m.new_id, s.started_at, s.user_id, e.new_id, s.game_mode, s.location_id, s.route_id, s.stage_length,
+			s.stage_result_status, s.stage_result_time, s.stage_result_time_penalty, s.stage_shakedown,
+			s.vehicle_class_id, s.vehicle_id, s.vehicle_manufacturer_id
+		FROM %s.sessions s
+		JOIN import_sessions m ON m.old_id = s.id AND m.existing_id IS NULL
+		LEFT JOIN import_race_events e ON e.old_id = s.race_event_id
+		ORDER BY s.id
+	`, importSource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to import sessions: %w", err)
+	}
+
+	for _, table := range importSessionTables {
+		if !slices.Contains(sourceTables, table) {
+			continue
+		}
+		n, err := execCount(ctx, tx, fmt.Sprintf(`
+			INSERT INTO %[1]s BY NAME
+			SELECT s.* REPLACE (m.new_id AS session_id)
+			FROM %[2]s.%[1]s s
+			JOIN import_sessions m ON m.old_id = s.session_id AND m.existing_id IS NULL
+			ORDER BY s.rowid
+		`, table, importSource))
+		if err != nil {
+			return nil, fmt.Errorf("failed to import %s: %w", table, err)
+		}
+		switch table {
+		case "telemetry":
+			report.Telemetry = n
+		case "session_splits":
+			report.Splits = n
+		case "session_incidents":
+			report.Incidents = n
+		}
+	}
+
+	if slices.Contains(sourceTables, "achievements") {
+		report.Achievements, err = execCount(ctx, tx, fmt.Sprintf(`
+			INSERT INTO achievements (session_id, user_id, route_id, vehicle_class_id, kind, result_time, previous_time, created_at)
+			SELECT m.new_id, s.user_id, s.route_id, s.vehicle_class_id, s.kind, s.result_time, s.previous_time, s.created_at
+			FROM %s.achievements s
+			JOIN import_sessions m ON m.old_id = s.session_id AND m.existing_id IS NULL
+			ORDER BY s.id
+		`, importSource))
+		if err != nil {
+			return nil, fmt.Errorf("failed to import achievements: %w", err)
+		}
+	}
+
+	// Ratings and route maps are derived data, so they are recalculated from
+	// the imported rows instead of copied
+	var eventIDs, routeIDs []int
+	eventIDs, err = queryIDs(ctx, tx, `
+		SELECT e.id
+		FROM import_race_events m
+		JOIN race_events e ON e.id = m.new_id
+		WHERE m.existing_id IS NULL AND e.ended_at IS NOT NULL
+		ORDER BY e.ended_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	routeIDs, err = queryIDs(ctx, tx, `
+		SELECT DISTINCT s.route_id
+		FROM import_sessions m
+		JOIN sessions s ON s.id = m.new_id
+		WHERE m.existing_id IS NULL AND s.stage_result_status = 1 AND s.route_id IS NOT NULL
+		ORDER BY s.route_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Imported events may have ended before the events already rated, so
+	// every rating is replayed in order
+	if len(eventIDs) > 0 {
+		if err := d.recalculateRatings(tx); err != nil {
+			return nil, fmt.Errorf("failed to recalculate ratings: %w", err)
+		}
+	}
+	for _, routeID := range routeIDs {
+		if err := d.rebuildRouteGeometry(tx, routeID); err != nil {
+			return nil, fmt.Errorf("failed to update route geometry: %w", err)
+		}
+	}
+
+	// Users which were merged in this database after the source was copied
+	// come back with their old ID, so they are merged again. A merge can't
+	// remove the user in the same transaction, so it's done after the commit.
+	merges, err := queryMergedUsers(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range merges {
+		report.conflict("user %s: merged into %s, which has the same card", m[0], m[1])
+	}
+
+	for _, m := range importMaps {
+		if _, err := tx.ExecContext(ctx, "DROP TABLE "+m.name); err != nil {
+			return nil, fmt.Errorf("failed to drop %s: %w", m.name, err)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+
+	for _, m := range merges {
+		if err := d.MergeUsers(m[0], m[1]); err != nil {
+			return report, fmt.Errorf("import committed but failed to merge user %s into %s, merge them with \"wrc-laptimer users merge %s %s\": %w", m[0], m[1], m[0], m[1], err)
+		}
+	}
+	return report, nil
+}
+
+// queryMergedUsers returns the users whose card belongs to another user, as
+// pairs of the user and the user it's merged into.
+func queryMergedUsers(ctx context.Context, tx *sql.Tx) ([][2]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT u.id, c.user_id
+		FROM users u
+		JOIN user_cards c ON c.card_id = u.id
+		WHERE c.user_id != u.id
+		ORDER BY u.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query merged users: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	var merges [][2]string
+	for rows.Next() {
+		var fromID, intoID string
+		if err := rows.Scan(&fromID, &intoID); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		merges = append(merges, [2]string{fromID, intoID})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return merges, nil
+}
+
+func queryIDs(ctx context.Context, tx *sql.Tx, query string) ([]int, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query imported IDs: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return ids, nil
+}
+
+// readExportedSession reads the session metadata and channels of a session
+// exported with ExportSession.
+func (d *Database) readExportedSession(path, format string) (*SessionMetadata, []TelemetryChannel, error) {
+	var session SessionMetadata
+	switch format {
+	case ExportFormatJSON:
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open import file: %w", err)
+		}
+		defer file.Close() //nolint:errcheck
+
+		var export struct {
+			Session  *SessionMetadata   `json:"session"`
+			Channels []TelemetryChannel `json:"channels"`
+		}
+		if err := json.NewDecoder(file).Decode(&export); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode import file: %w", err)
+		}
+		if export.Session == nil {
+			return nil, nil, fmt.Errorf("import file has no session")
+		}
+		return export.Session, export.Channels, nil
+
+	case ExportFormatParquet:
+		var metadata string
+		err := d.queryRow(fmt.Sprintf(`
+			SELECT decode(value)
+			FROM parquet_kv_metadata(%s)
+			WHERE decode(key) = 'session'
+		`, quoteString(path))).Scan(&metadata)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, nil, fmt.Errorf("import file has no session metadata")
+			}
+			return nil, nil, fmt.Errorf("failed to read parquet metadata: %w", err)
+		}
+		if err := json.Unmarshal([]byte(metadata), &session); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode session metadata: %w", err)
+		}
+		return &session, nil, nil
+	}
+	return nil, nil, fmt.Errorf("unknown import format: %s", format)
+}
+
+// importSessionExport imports a single session exported with ExportSession.
+// The session is not linked to an event, as the export doesn't contain one.
+func (d *Database) importSessionExport(path, format string, dryRun bool) (*ImportReport, error) {
+	ctx := d.ctx
+	report := &ImportReport{Conflicts: []string{}}
+
+	session, channels, err := d.readExportedSession(path, format)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var existingID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT id
+		FROM sessions
+		WHERE started_at = ? AND user_id IS NOT DISTINCT FROM ? AND route_id IS NOT DISTINCT FROM ?
+	`, session.StartedAt, session.UserID, session.RouteID).Scan(&existingID)
+	if err == nil {
+		report.conflict("session already exists as %d and was skipped", existingID)
+		return report, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to check existing session: %w", err)
+	}
+
+	if session.UserID != nil {
+		// The user may have been merged into another user
+		var cardUserID string
+		err := tx.QueryRowContext(ctx, "SELECT user_id FROM user_cards WHERE card_id = ?", *session.UserID).Scan(&cardUserID)
+		switch {
+		case err == nil && cardUserID != *session.UserID:
+			report.conflict("user %s: imported as %s, which has the same card", *session.UserID, cardUserID)
+			session.UserID = &cardUserID
+			session.UserName = nil
+		case err != nil && err != sql.ErrNoRows:
+			return nil, fmt.Errorf("failed to check card of user: %w", err)
+		}
+
+		var name sql.NullString
+		err = tx.QueryRowContext(ctx, "SELECT name FROM users WHERE id = ?", *session.UserID).Scan(&name)
+		switch {
+		case err == sql.ErrNoRows:
+			report.Users, err = execCount(ctx, tx, "INSERT INTO users (id, name) VALUES (?, ?)", *session.UserID, session.UserName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to import user: %w", err)
+			}
+			_, err = tx.ExecContext(ctx, "INSERT INTO user_cards (card_id, user_id) VALUES (?, ?)", *session.UserID, *session.UserID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to import card of user: %w", err)
+			}
+		case err != nil:
+			return nil, fmt.Errorf("failed to check existing user: %w", err)
+		case session.UserName != nil && name.String != *session.UserName:
+			report.conflict("user %s: kept name %q instead of imported %q", *session.UserID, name.String, *session.UserName)
+		}
+	}
+	if session.RaceEventID != nil {
+		report.conflict("session was part of event %d in the source, imported without an event", *session.RaceEventID)
+	}
+
+	var sessionID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO sessions (
+			started_at, user_id, location_id, route_id, stage_length, stage_result_status,
+			stage_result_time, stage_result_time_penalty, stage_shakedown,
+			vehicle_class_id, vehicle_id
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`,
+		session.StartedAt, session.UserID, session.LocationID, session.RouteID, session.StageLength, session.StageResultStatus,
+		session.StageResultTime, session.StageResultTimePenalty, session.StageShakedown,
+		session.VehicleClassID, session.VehicleID,
+	).Scan(&sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import session: %w", err)
+	}
+	report.Sessions = 1
+
+	switch format {
+	case ExportFormatJSON:
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read import file: %w", err)
+		}
+
+		// Samples are arrays in the order of the channels
+		columns := make([]string, 0, len(channels))
+		values := make([]string, 0, len(channels))
+		for i, c := range channels {
+			if !slices.Contains(telemetryColumns, c.Name) {
+				report.conflict("unknown telemetry channel %s was skipped", c.Name)
+				continue
+			}
+			columns = append(columns, c.Name)
+			values = append(values, fmt.Sprintf("sample[%d]", i+1))
+		}
+		report.Telemetry, err = execCount(ctx, tx, fmt.Sprintf(`
+			INSERT INTO telemetry (session_id, %s)
+			SELECT ?, %s
+			FROM (
+				SELECT unnest(samples) AS sample
+				FROM read_json(%s, columns = {samples: 'JSON[][]'}, maximum_object_size = %d)
+			)
+		`, strings.Join(columns, ", "), strings.Join(values, ", "), quoteString(path), info.Size()+1), sessionID)
+	case ExportFormatParquet:
+		report.Telemetry, err = execCount(ctx, tx, fmt.Sprintf(`
+			INSERT INTO telemetry BY NAME
+			SELECT ? AS session_id, *
+			FROM read_parquet(%s)
+		`, quoteString(path)), sessionID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to import telemetry: %w", err)
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+
+	if err := d.UpdateRouteGeometry(sessionID); err != nil {
+		return report, fmt.Errorf("failed to update route geometry: %w", err)
+	}
+	return report, nil
+}
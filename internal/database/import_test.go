@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestImportDatabase(t *testing.T) {
+	// The source has a copy of the event and session of this database and an
+	// event which ended earlier, whose ID is taken by another event here
+	srcPath := filepath.Join(t.TempDir(), "source.db")
+	src, err := NewDatabase(context.Background(), srcPath)
+	if err != nil {
+		t.Fatalf("failed to open source database: %v", err)
+	}
+	seed := []string{
+		"INSERT INTO users (id, name) VALUES ('a', 'Alice'), ('b', 'Bob')",
+		"INSERT INTO race_series (name, created_at) VALUES ('Cup', '2025-01-01 09:00:00')",
+		`INSERT INTO race_events (race_series_id, name, created_at, ended_at) VALUES
+			(1, 'Round 2', '2025-01-05 09:00:00', '2025-01-05 12:00:00')`,
+		`INSERT INTO results (user_id, race_event_id, hc_mode, position) VALUES
+			('a', 1, false, 1), ('b', 1, false, 2)`,
+		`INSERT INTO sessions (user_id, race_event_id, route_id, started_at, stage_result_status) VALUES
+			('a', 1, 7, '2025-01-05 10:00:00', 1)`,
+	}
+	mustExec(t, src, append(seed,
+		`INSERT INTO race_events (race_series_id, name, created_at, ended_at) VALUES
+			(1, 'Round 1', '2025-01-01 09:00:00', '2025-01-01 12:00:00')`,
+		`INSERT INTO results (user_id, race_event_id, hc_mode, position) VALUES
+			('b', 2, false, 1), ('a', 2, false, 2)`,
+		`INSERT INTO sessions (user_id, race_event_id, route_id, started_at, stage_result_status) VALUES
+			('b', 2, 7, '2025-01-01 10:00:00', 1)`,
+	)...)
+	src.Close()
+
+	d := newTestDatabase(t)
+	mustExec(t, d, append(seed,
+		"INSERT INTO race_events (race_series_id, name, created_at) VALUES (1, 'Friendly', '2025-01-02 09:00:00')",
+	)...)
+	if err := d.RecalculateRatings(); err != nil {
+		t.Fatalf("failed to calculate ratings: %v", err)
+	}
+
+	report, err := d.ImportFile(srcPath, false)
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	counts := map[string][2]int{
+		"users":    {report.Users, 0},
+		"series":   {report.Series, 0},
+		"events":   {report.Events, 1},
+		"results":  {report.Results, 2},
+		"sessions": {report.Sessions, 1},
+	}
+	for table, count := range counts {
+		if count[0] != count[1] {
+			t.Errorf("imported %d %s, want %d", count[0], table, count[1])
+		}
+	}
+
+	var eventID int
+	if err := d.queryRow("SELECT id FROM race_events WHERE name = 'Round 1'").Scan(&eventID); err != nil {
+		t.Fatalf("failed to find imported event: %v", err)
+	}
+	if eventID != 3 {
+		t.Errorf("imported event got ID %d, want 3", eventID)
+	}
+	var sessionEventID int
+	if err := d.queryRow("SELECT race_event_id FROM sessions WHERE user_id = 'b'").Scan(&sessionEventID); err != nil {
+		t.Fatalf("failed to find imported session: %v", err)
+	}
+	if sessionEventID != eventID {
+		t.Errorf("imported session is in event %d, want %d", sessionEventID, eventID)
+	}
+
+	// Ratings are replayed in the order the events ended, the imported first
+	first := calculateEloRatings([]float64{defaultRating, defaultRating}) // b, a
+	second := calculateEloRatings([]float64{first[1], first[0]})          // a, b
+	for userID, want := range map[string]float64{"a": second[0], "b": second[1]} {
+		ratings, err := d.GetUserRatings(userID)
+		if err != nil {
+			t.Fatalf("failed to get ratings: %v", err)
+		}
+		if len(ratings) != 1 || math.Abs(ratings[0].Rating-want) > 1e-9 || ratings[0].EventCount != 2 {
+			t.Errorf("ratings of %s = %+v, want %.4f over 2 events", userID, ratings, want)
+		}
+	}
+
+	report, err = d.ImportFile(srcPath, false)
+	if err != nil {
+		t.Fatalf("failed to import again: %v", err)
+	}
+	if report.Events != 0 || report.Results != 0 || report.Sessions != 0 {
+		t.Errorf("second import added %d events, %d results and %d sessions, want none", report.Events, report.Results, report.Sessions)
+	}
+}
+
+func TestImportMergedUser(t *testing.T) {
+	// User c2 was merged into c1 here after the source was copied
+	srcPath := filepath.Join(t.TempDir(), "source.db")
+	src, err := NewDatabase(context.Background(), srcPath)
+	if err != nil {
+		t.Fatalf("failed to open source database: %v", err)
+	}
+	mustExec(t, src,
+		"INSERT INTO users (id, name) VALUES ('c1', 'Alice'), ('c2', 'Alice again')",
+		"INSERT INTO user_cards (card_id, user_id) VALUES ('c1', 'c1'), ('c2', 'c2')",
+		"INSERT INTO sessions (user_id, route_id, stage_result_status) VALUES ('c2', 7, 1)",
+	)
+	src.Close()
+
+	d := newTestDatabase(t)
+	mustExec(t, d,
+		"INSERT INTO users (id, name) VALUES ('c1', 'Alice')",
+		"INSERT INTO user_cards (card_id, user_id) VALUES ('c1', 'c1'), ('c2', 'c1')",
+	)
+
+	for _, dryRun := range []bool{true, false} {
+		report, err := d.ImportFile(srcPath, dryRun)
+		if err != nil {
+			t.Fatalf("failed to import with dry run %v: %v", dryRun, err)
+		}
+		want := "user c2: merged into c1, which has the same card"
+		if !slices.Contains(report.Conflicts, want) {
+			t.Errorf("dry run %v: got conflicts %v, want %q", dryRun, report.Conflicts, want)
+		}
+	}
+
+	var users, sessions int
+	if err := d.queryRow("SELECT count(*) FROM users WHERE id = 'c2'").Scan(&users); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.queryRow("SELECT count(*) FROM sessions WHERE user_id = 'c1'").Scan(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	if users != 0 || sessions != 1 {
+		t.Errorf("got %d users c2 and %d sessions of c1, want 0 and 1", users, sessions)
+	}
+}
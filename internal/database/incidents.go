@@ -0,0 +1,177 @@
+package database
+
+import (
+	"fmt"
+)
+
+const (
+	IncidentImpact    = "impact"
+	IncidentPuncture  = "puncture"
+	IncidentSpeedDrop = "speed_drop"
+	IncidentRollover  = "rollover"
+)
+
+type SessionIncident struct {
+	SessionID            int     `db:"session_id" json:"session_id"`
+	Kind                 string  `db:"kind" json:"kind"`
+	Detail               string  `db:"detail" json:"detail"`
+	Magnitude            float32 `db:"magnitude" json:"magnitude"`
+	StageCurrentTime     float32 `db:"stage_current_time" json:"stage_current_time"`
+	StageCurrentDistance float64 `db:"stage_current_distance" json:"stage_current_distance"`
+	VehiclePositionX     float32 `db:"vehicle_position_x" json:"vehicle_position_x"`
+	VehiclePositionY     float32 `db:"vehicle_position_y" json:"vehicle_position_y"`
+	VehiclePositionZ     float32 `db:"vehicle_position_z" json:"vehicle_position_z"`
+}
+
+// DangerZone aggregates the incidents of a route within a stretch of the stage.
+type DangerZone struct {
+	DistanceStart    float64 `json:"distance_start"`
+	DistanceEnd      float64 `json:"distance_end"`
+	IncidentCount    int     `json:"incident_count"`
+	SessionCount     int     `json:"session_count"`
+	Impacts          int     `json:"impacts"`
+	Punctures        int     `json:"punctures"`
+	SpeedDrops       int     `json:"speed_drops"`
+	Rollovers        int     `json:"rollovers"`
+	VehiclePositionX float64 `json:"vehicle_position_x"`
+	VehiclePositionY float64 `json:"vehicle_position_y"`
+	VehiclePositionZ float64 `json:"vehicle_position_z"`
+}
+
+func (d *Database) StoreIncident(incident SessionIncident) error {
+	_, err := d.exec(`
+		INSERT INTO session_incidents (
+			session_id,
+			kind,
+			detail,
+			magnitude,
+			stage_current_time,
+			stage_current_distance,
+			vehicle_position_x,
+			vehicle_position_y,
+			vehicle_position_z
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		incident.SessionID,
+		incident.Kind,
+		incident.Detail,
+		incident.Magnitude,
+		incident.StageCurrentTime,
+		incident.StageCurrentDistance,
+		incident.VehiclePositionX,
+		incident.VehiclePositionY,
+		incident.VehiclePositionZ,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store %s incident: %w", incident.Kind, err)
+	}
+	return nil
+}
+
+func (d *Database) GetSessionIncidents(sessionID int) ([]SessionIncident, error) {
+	rows, err := d.query(`
+		SELECT
+			session_id,
+			kind,
+			detail,
+			magnitude,
+			stage_current_time,
+			stage_current_distance,
+			vehicle_position_x,
+			vehicle_position_y,
+			vehicle_position_z
+		FROM session_incidents
+		WHERE session_id = ?
+		ORDER BY stage_current_time ASC
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incidents: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	incidents := []SessionIncident{}
+	for rows.Next() {
+		var incident SessionIncident
+		if err := rows.Scan(
+			&incident.SessionID,
+			&incident.Kind,
+			&incident.Detail,
+			&incident.Magnitude,
+			&incident.StageCurrentTime,
+			&incident.StageCurrentDistance,
+			&incident.VehiclePositionX,
+			&incident.VehiclePositionY,
+			&incident.VehiclePositionZ,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		incidents = append(incidents, incident)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return incidents, nil
+}
+
+// GetRouteDangerZones groups all incidents on the route into stretches of
+// the given length, most dangerous first.
+func (d *Database) GetRouteDangerZones(routeID int, bucketLength float64) ([]DangerZone, error) {
+	rows, err := d.query(`
+		SELECT
+			floor(i.stage_current_distance / $2) * $2 AS distance_start,
+			COUNT(*) AS incident_count,
+			COUNT(DISTINCT i.session_id) AS session_count,
+			COUNT(*) FILTER (WHERE i.kind = 'impact'),
+			COUNT(*) FILTER (WHERE i.kind = 'puncture'),
+			COUNT(*) FILTER (WHERE i.kind = 'speed_drop'),
+			COUNT(*) FILTER (WHERE i.kind = 'rollover'),
+			AVG(i.vehicle_position_x),
+			AVG(i.vehicle_position_y),
+			AVG(i.vehicle_position_z)
+		FROM session_incidents i
+		JOIN sessions s ON s.id = i.session_id
+		WHERE s.route_id = $1
+		GROUP BY distance_start
+		ORDER BY incident_count DESC, distance_start ASC
+	`, routeID, bucketLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query danger zones: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	zones := []DangerZone{}
+	for rows.Next() {
+		var zone DangerZone
+		if err := rows.Scan(
+			&zone.DistanceStart,
+			&zone.IncidentCount,
+			&zone.SessionCount,
+			&zone.Impacts,
+			&zone.Punctures,
+			&zone.SpeedDrops,
+			&zone.Rollovers,
+			&zone.VehiclePositionX,
+			&zone.VehiclePositionY,
+			&zone.VehiclePositionZ,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		zone.DistanceEnd = zone.DistanceStart + bucketLength
+		zones = append(zones, zone)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return zones, nil
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Reasons for logging out a user, see user_logins.logout_reason
+const (
+	LogoutReasonLogin    = "login"
+	LogoutReasonSessions = "sessions"
+	LogoutReasonIdle     = "idle"
+	LogoutReasonRetap    = "retap"
+)
+
+// LogoutPolicy decides when the logged in user is logged out automatically.
+// Zero values disable the rules, so with the zero policy the user is never
+// logged out until the next driver logs in.
+type LogoutPolicy struct {
+	// Log out after this many sessions have ended, including DNFs
+	AfterSessions int
+	// Log out after this long outside of stages
+	IdleTimeout time.Duration
+	// Log out when the logged in user taps their card again
+	OnRetap bool
+}
+
+func (d *Database) SetLogoutPolicy(policy LogoutPolicy) {
+	d.logoutPolicy.Store(&policy)
+}
+
+func (d *Database) GetLogoutPolicy() LogoutPolicy {
+	if policy := d.logoutPolicy.Load(); policy != nil {
+		return *policy
+	}
+	return LogoutPolicy{}
+}
+
+// ActiveLogin is the login of the user who is logged in.
+type ActiveLogin struct {
+	UserID string
+	// How long ago the user logged in. It's measured by the database because
+	// the login timestamp is local wall clock time.
+	LoggedInFor time.Duration
+	// Sessions ended after the login
+	SessionCount int
+}
+
+// GetActiveLogin returns the login of the logged in user, or nil if nobody is
+// logged in.
+func (d *Database) GetActiveLogin() (*ActiveLogin, error) {
+	var login ActiveLogin
+	var loggedInFor int64 // [microsecond]
+	err := d.queryRow(`
+		SELECT
+			l.user_id,
+			epoch_us(current_localtimestamp() - l.timestamp),
+			(
+				SELECT count(*)
+				FROM sessions s
+				WHERE s.user_id = l.user_id
+					AND s.started_at >= l.timestamp
+					AND s.stage_result_status IS NOT NULL
+			)
+		FROM user_logins l
+		WHERE l.active IS true
+		ORDER BY l.timestamp DESC
+		LIMIT 1
+	`).Scan(&login.UserID, &loggedInFor, &login.SessionCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Nobody is logged in
+		}
+		return nil, fmt.Errorf("could not get active login: %w", err)
+	}
+	login.LoggedInFor = time.Duration(loggedInFor) * time.Microsecond
+	return &login, nil
+}
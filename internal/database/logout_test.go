@@ -0,0 +1,46 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetActiveLogin(t *testing.T) {
+	tests := []struct {
+		zone        string
+		loggedInAgo string
+		want        time.Duration
+	}{
+		{"UTC", "0 SECOND", 0},
+		{"UTC", "10 MINUTE", 10 * time.Minute},
+		{"America/New_York", "0 SECOND", 0},
+		{"America/New_York", "10 MINUTE", 10 * time.Minute},
+		{"Europe/Helsinki", "0 SECOND", 0},
+		{"Europe/Helsinki", "10 MINUTE", 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.zone+"/"+tt.loggedInAgo, func(t *testing.T) {
+			d := newTestDatabase(t)
+			useTimeZone(t, d, tt.zone)
+
+			if err := d.CreateUser("a"); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.LoginUser("a"); err != nil {
+				t.Fatal(err)
+			}
+			mustExec(t, d, "UPDATE user_logins SET timestamp = timestamp - INTERVAL "+tt.loggedInAgo)
+
+			login, err := d.GetActiveLogin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if login == nil || login.UserID != "a" {
+				t.Fatalf("got login %+v, want user a", login)
+			}
+			if login.LoggedInFor < tt.want || login.LoggedInFor > tt.want+time.Minute {
+				t.Errorf("logged in for %v, want %v", login.LoggedInFor, tt.want)
+			}
+		})
+	}
+}
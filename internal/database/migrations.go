@@ -0,0 +1,226 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations are named "<version>_<name>.sql" and applied in the order of the
+// version. Applied migrations must never be changed, add a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+	sql       string
+}
+
+func loadMigrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		version, name, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		content, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+		migrations = append(migrations, Migration{Version: v, Name: name, sql: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+func (d *Database) createSchemaVersionTable() error {
+	_, err := d.exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+	return nil
+}
+
+// GetMigrations returns every known migration with the time it was applied,
+// or nil applied time if it is pending.
+func (d *Database) GetMigrations() ([]Migration, error) {
+	if err := d.createSchemaVersionTable(); err != nil {
+		return nil, err
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.query("SELECT version, applied_at FROM schema_version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema versions: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	for i := range migrations {
+		if appliedAt, ok := applied[migrations[i].Version]; ok {
+			migrations[i].AppliedAt = &appliedAt
+		}
+	}
+	return migrations, nil
+}
+
+// hasUserTables reports whether the database has any tables besides the
+// schema version, i.e. whether there is data worth backing up.
+func (d *Database) hasUserTables() (bool, error) {
+	var count int
+	err := d.queryRow(`
+		SELECT COUNT(*)
+		FROM duckdb_tables()
+		WHERE database_name = current_database() AND NOT temporary AND table_name != 'schema_version'
+	`).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to count tables: %w", err)
+	}
+	return count > 0, nil
+}
+
+// backupFile copies the database file next to itself. The database is
+// checkpointed first so that the file contains every committed change.
+func (d *Database) backupFile(suffix string) (string, error) {
+	if d.path == "" || d.path == ":memory:" {
+		return "", nil
+	}
+
+	if _, err := d.exec("CHECKPOINT"); err != nil {
+		return "", fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+
+	source, err := os.Open(d.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open database file: %w", err)
+	}
+	defer source.Close() //nolint:errcheck
+
+	backupPath := fmt.Sprintf("%s.%s-%s", d.path, suffix, time.Now().Format("20060102-150405"))
+	target, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup file: %w", err)
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close() //nolint:errcheck
+		return "", fmt.Errorf("failed to copy database file: %w", err)
+	}
+	if err := target.Close(); err != nil {
+		return "", fmt.Errorf("failed to close backup file: %w", err)
+	}
+	return backupPath, nil
+}
+
+// Migrate applies the pending migrations, each in its own transaction. An
+// existing database is backed up before the first migration is applied.
+// Returns the applied migrations.
+func (d *Database) Migrate() ([]Migration, error) {
+	migrations, err := d.GetMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if m.AppliedAt == nil {
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	hasTables, err := d.hasUserTables()
+	if err != nil {
+		return nil, err
+	}
+	if hasTables {
+		backupPath, err := d.backupFile(fmt.Sprintf("pre-migration-%03d", pending[0].Version))
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up database before migrating: %w", err)
+		}
+		if backupPath != "" {
+			slog.Info("database backed up before migrating", "path", backupPath)
+		}
+	}
+
+	for _, m := range pending {
+		if err := d.applyMigration(m); err != nil {
+			return nil, err
+		}
+		slog.Info("migration applied", "version", m.Version, "name", m.Name)
+	}
+	return pending, nil
+}
+
+func (d *Database) applyMigration(m Migration) error {
+	tx, err := d.db.BeginTx(d.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err := tx.ExecContext(d.ctx, m.sql); err != nil {
+		return fmt.Errorf("failed to apply migration %03d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.ExecContext(d.ctx, "INSERT INTO schema_version (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+		return fmt.Errorf("failed to store schema version %d: %w", m.Version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %03d_%s: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
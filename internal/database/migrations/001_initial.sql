@@ -569,6 +569,30 @@ CREATE TABLE IF NOT EXISTS series_results (
   result_time           FLOAT,
 );
 
+CREATE TABLE IF NOT EXISTS user_ratings (
+  user_id               TEXT REFERENCES users(id),
+  vehicle_class_id      USMALLINT,
+  rating                DOUBLE,
+  event_count           INTEGER,
+  updated_at            TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+);
+
+COMMENT ON COLUMN user_ratings.vehicle_class_id IS 'Vehicle class the rating applies to. NULL for the overall rating across all classes.';
+COMMENT ON COLUMN user_ratings.rating IS 'Elo rating calculated from event finishing positions.';
+
+CREATE SEQUENCE IF NOT EXISTS user_rating_history_id_sequence START 1;
+
+CREATE TABLE IF NOT EXISTS user_rating_history (
+  id                    INTEGER PRIMARY KEY DEFAULT nextval('user_rating_history_id_sequence'),
+  user_id               TEXT REFERENCES users(id),
+  vehicle_class_id      USMALLINT,
+  race_event_id         INTEGER REFERENCES race_events(id),
+  position              INTEGER,
+  rating_before         DOUBLE,
+  rating_after          DOUBLE,
+  created_at            TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+);
+
 CREATE SEQUENCE IF NOT EXISTS session_id_sequence START 1;
 
 CREATE TABLE IF NOT EXISTS sessions (
@@ -602,6 +626,91 @@ COMMENT ON COLUMN sessions.vehicle_id IS 'Vehicle unique identifier. See "vehicl
 COMMENT ON COLUMN sessions.vehicle_manufacturer_id IS 'Vehicle manufacturer unique identifier. See "vehicle_manufacturers" table.';
 
 
+CREATE OR REPLACE VIEW personal_bests AS
+  SELECT
+    user_id,
+    route_id,
+    vehicle_class_id,
+    MIN(stage_result_time + stage_result_time_penalty) AS best_time,
+    arg_min(id, stage_result_time + stage_result_time_penalty) AS session_id,
+    COUNT(*) AS finish_count,
+  FROM sessions
+  WHERE stage_result_status = 1
+    AND stage_shakedown IS FALSE
+    AND user_id IS NOT NULL
+  GROUP BY user_id, route_id, vehicle_class_id;
+
+CREATE OR REPLACE VIEW route_records AS
+  SELECT
+    route_id,
+    vehicle_class_id,
+    MIN(best_time) AS record_time,
+    arg_min(user_id, best_time) AS user_id,
+    arg_min(session_id, best_time) AS session_id,
+  FROM personal_bests
+  GROUP BY route_id, vehicle_class_id;
+
+CREATE SEQUENCE IF NOT EXISTS achievements_id_sequence START 1;
+
+CREATE TABLE IF NOT EXISTS achievements (
+  id                    INTEGER PRIMARY KEY DEFAULT nextval('achievements_id_sequence'),
+  session_id            INTEGER,
+  user_id               TEXT REFERENCES users(id),
+  route_id              USMALLINT,
+  vehicle_class_id      USMALLINT,
+  kind                  TEXT,
+  result_time           FLOAT,
+  previous_time         FLOAT,
+  created_at            TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+);
+
+COMMENT ON COLUMN achievements.kind IS 'Type of the achievement: "personal_best" or "route_record".';
+COMMENT ON COLUMN achievements.result_time IS 'Total result time including penalties. [second]';
+COMMENT ON COLUMN achievements.previous_time IS 'Previous best time which was beaten. NULL if this was the first finish. [second]';
+
+CREATE TABLE IF NOT EXISTS session_splits (
+  session_id                INTEGER,
+  split_index               USMALLINT,
+  split_time                FLOAT,
+  stage_current_time        FLOAT,
+  stage_current_distance    DOUBLE,
+);
+
+COMMENT ON COLUMN session_splits.split_index IS 'Number of the split on the stage, starting from 1.';
+COMMENT ON COLUMN session_splits.split_time IS 'Split time as reported by the game in "stage_previous_split_time". [second]';
+COMMENT ON COLUMN session_splits.stage_current_time IS 'Time spent on the stage when the split was detected. [second]';
+COMMENT ON COLUMN session_splits.stage_current_distance IS 'Distance reached on the stage when the split was detected. [metre]';
+
+CREATE TABLE IF NOT EXISTS session_incidents (
+  session_id                INTEGER,
+  kind                      TEXT,
+  detail                    TEXT,
+  magnitude                 FLOAT,
+  stage_current_time        FLOAT,
+  stage_current_distance    DOUBLE,
+  vehicle_position_x        FLOAT,
+  vehicle_position_y        FLOAT,
+  vehicle_position_z        FLOAT,
+);
+
+COMMENT ON COLUMN session_incidents.kind IS 'Type of the incident: "impact", "puncture", "speed_drop" or "rollover".';
+COMMENT ON COLUMN session_incidents.detail IS 'Additional information, e.g. the wheel of a puncture ("fl", "fr", "bl", "br").';
+COMMENT ON COLUMN session_incidents.magnitude IS 'Severity of the incident: peak acceleration [metre per second squared] for impacts, lost speed [metre per second] for speed drops, tyre state for punctures and up vector Y component for rollovers.';
+COMMENT ON COLUMN session_incidents.stage_current_distance IS 'Distance reached on the stage when the incident happened. [metre]';
+
+CREATE TABLE IF NOT EXISTS route_geometry (
+  route_id                  USMALLINT,
+  distance                  DOUBLE,
+  vehicle_position_x        FLOAT,
+  vehicle_position_y        FLOAT,
+  vehicle_position_z        FLOAT,
+  run_count                 INTEGER,
+  updated_at                TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+);
+
+COMMENT ON COLUMN route_geometry.distance IS 'Distance from the start of the stage. Positions are averaged over every finished run within each stretch. [metre]';
+COMMENT ON COLUMN route_geometry.run_count IS 'Number of finished runs the point is averaged from.';
+
 CREATE TABLE IF NOT EXISTS telemetry (
   session_id                   INTEGER,
   stage_current_distance       DOUBLE,
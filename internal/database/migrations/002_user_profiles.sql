@@ -0,0 +1,16 @@
+-- The display name is stored in users.name, the generated name is the default
+
+CREATE TABLE IF NOT EXISTS user_profiles (
+  user_id               TEXT PRIMARY KEY REFERENCES users(id),
+  nationality           TEXT,
+  favourite_vehicle_id  USMALLINT,
+  avatar                BLOB,
+  avatar_content_type   TEXT,
+  claimed_at            TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at            TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+);
+
+COMMENT ON COLUMN user_profiles.nationality IS 'ISO 3166-1 alpha-2 country code, e.g. "FI".';
+COMMENT ON COLUMN user_profiles.favourite_vehicle_id IS 'Vehicle unique identifier. See "vehicles" table.';
+COMMENT ON COLUMN user_profiles.avatar IS 'Avatar image, at most 256 KiB.';
+COMMENT ON COLUMN user_profiles.claimed_at IS 'When the driver first set up their profile.';
@@ -0,0 +1,17 @@
+-- A user can have several cards. The ID of a user is the hash of their first
+-- card, so every existing user gets that card.
+
+CREATE TABLE IF NOT EXISTS user_cards (
+  card_id               TEXT PRIMARY KEY,
+  user_id               TEXT REFERENCES users(id),
+  created_at            TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  revoked_at            TIMESTAMP,
+);
+
+COMMENT ON COLUMN user_cards.card_id IS 'SHA-256 hash of the card UID.';
+COMMENT ON COLUMN user_cards.revoked_at IS 'When the card was revoked, e.g. after it was lost. Revoked cards can not be used to log in.';
+
+INSERT INTO user_cards (card_id, user_id)
+SELECT id, id
+FROM users
+WHERE id NOT IN (SELECT card_id FROM user_cards);
@@ -0,0 +1,18 @@
+-- Drivers can log in with a PIN from the web UI, e.g. when the NFC reader is
+-- not available.
+
+CREATE TABLE IF NOT EXISTS user_pins (
+  user_id               TEXT PRIMARY KEY REFERENCES users(id),
+  pin_hash              TEXT UNIQUE NOT NULL,
+  updated_at            TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+);
+
+COMMENT ON COLUMN user_pins.pin_hash IS 'SHA-256 hash of the PIN. PINs are unique as the driver is found by the PIN.';
+
+-- Drivers waiting for their turn. The first one is logged in when the session
+-- of the previous driver ends.
+
+CREATE TABLE IF NOT EXISTS driver_queue (
+  user_id               TEXT PRIMARY KEY REFERENCES users(id),
+  queued_at             TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+);
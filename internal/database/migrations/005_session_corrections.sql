@@ -0,0 +1,17 @@
+-- Organisers can correct sessions afterwards. The corrections are applied to
+-- the sessions and logged here.
+
+INSERT OR IGNORE INTO stage_result_states(id, name) VALUES
+  (7, 'voided');
+
+CREATE TABLE IF NOT EXISTS session_corrections (
+  session_id            INTEGER,
+  created_at            TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  action                TEXT NOT NULL,
+  reason                TEXT,
+  old_value             TEXT,
+  new_value             TEXT,
+);
+
+COMMENT ON COLUMN session_corrections.action IS 'What was corrected: "reassign", "event", "penalty", "disqualify" or "void".';
+COMMENT ON COLUMN session_corrections.old_value IS 'Value before the correction, e.g. the user ID for "reassign" or the total time penalty for "penalty".';
@@ -0,0 +1,7 @@
+-- Logouts are recorded so that the seat time of the drivers can be computed.
+-- Logins which ended before this migration have no logout time.
+
+ALTER TABLE user_logins ADD COLUMN IF NOT EXISTS logged_out_at TIMESTAMP;
+ALTER TABLE user_logins ADD COLUMN IF NOT EXISTS logout_reason TEXT;
+
+COMMENT ON COLUMN user_logins.logout_reason IS 'Why the user was logged out: "login" (another driver logged in), "sessions", "idle", or "retap".';
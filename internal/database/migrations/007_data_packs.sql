@@ -0,0 +1,10 @@
+-- The lookup tables of game content are updated with data packs. Every loaded
+-- pack is recorded here.
+
+CREATE TABLE IF NOT EXISTS data_packs (
+  version               TEXT PRIMARY KEY,
+  loaded_at             TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  row_count             INTEGER,
+);
+
+COMMENT ON COLUMN data_packs.row_count IS 'Number of lookup rows inserted or updated by the pack.';
@@ -0,0 +1,33 @@
+-- Ratings are upserted by user and vehicle class, so the pair becomes the
+-- primary key. Key columns cannot be NULL, so the overall rating is stored
+-- with vehicle class 0. Duplicate rows left by failed updates are dropped,
+-- keeping the latest.
+
+CREATE TEMP TABLE user_ratings_copy AS
+  SELECT
+    user_id,
+    COALESCE(vehicle_class_id, 0) AS vehicle_class_id,
+    arg_max(rating, updated_at) AS rating,
+    arg_max(event_count, updated_at) AS event_count,
+    max(updated_at) AS updated_at,
+  FROM user_ratings
+  WHERE user_id IS NOT NULL
+  GROUP BY user_id, COALESCE(vehicle_class_id, 0);
+
+DROP TABLE user_ratings;
+
+CREATE TABLE user_ratings (
+  user_id               TEXT REFERENCES users(id),
+  vehicle_class_id      USMALLINT,
+  rating                DOUBLE,
+  event_count           INTEGER,
+  updated_at            TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, vehicle_class_id),
+);
+
+COMMENT ON COLUMN user_ratings.vehicle_class_id IS 'Vehicle class the rating applies to. 0 for the overall rating across all classes.';
+COMMENT ON COLUMN user_ratings.rating IS 'Elo rating calculated from event finishing positions.';
+
+INSERT INTO user_ratings SELECT * FROM user_ratings_copy;
+
+DROP TABLE user_ratings_copy;
@@ -0,0 +1,25 @@
+-- Route geometry is updated point by point from each finished run, so the
+-- route and distance become the primary key.
+
+CREATE TEMP TABLE route_geometry_copy AS
+  SELECT * FROM route_geometry;
+
+DROP TABLE route_geometry;
+
+CREATE TABLE route_geometry (
+  route_id                  USMALLINT,
+  distance                  DOUBLE,
+  vehicle_position_x        FLOAT,
+  vehicle_position_y        FLOAT,
+  vehicle_position_z        FLOAT,
+  run_count                 INTEGER,
+  updated_at                TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (route_id, distance),
+);
+
+COMMENT ON COLUMN route_geometry.distance IS 'Distance from the start of the stage. Positions are averaged over every finished run within each stretch. [metre]';
+COMMENT ON COLUMN route_geometry.run_count IS 'Number of finished runs the point is averaged from.';
+
+INSERT INTO route_geometry SELECT * FROM route_geometry_copy WHERE route_id IS NOT NULL;
+
+DROP TABLE route_geometry_copy;
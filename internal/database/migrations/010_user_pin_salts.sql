@@ -0,0 +1,23 @@
+-- PINs are no longer unique, as refusing a PIN tells that another driver logs
+-- in with it, and they are hashed with a salt of their own. Existing PINs keep
+-- their unsalted hash, marked by a NULL salt, until they are changed.
+
+CREATE TEMP TABLE user_pins_copy AS
+  SELECT * FROM user_pins;
+
+DROP TABLE user_pins;
+
+CREATE TABLE user_pins (
+  user_id               TEXT PRIMARY KEY REFERENCES users(id),
+  pin_hash              TEXT NOT NULL,
+  salt                  TEXT,
+  updated_at            TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+);
+
+COMMENT ON COLUMN user_pins.pin_hash IS 'PBKDF2-SHA256 hash of the PIN and the salt, or the SHA-256 hash of the PIN if the salt is NULL.';
+COMMENT ON COLUMN user_pins.salt IS 'Random salt of the PIN hash, hex encoded.';
+
+INSERT INTO user_pins (user_id, pin_hash, updated_at)
+  SELECT user_id, pin_hash, updated_at FROM user_pins_copy;
+
+DROP TABLE user_pins_copy;
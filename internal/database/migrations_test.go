@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		if m.Name == "" || strings.TrimSpace(m.sql) == "" {
+			t.Errorf("migration %d has no name or SQL", m.Version)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	d, err := NewDatabase(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := d.GetMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if m.AppliedAt == nil {
+			t.Errorf("migration %03d_%s is pending", m.Version, m.Name)
+		}
+	}
+	applied, err := d.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("applied %d migrations again", len(applied))
+	}
+	d.Close()
+
+	// Reopening a migrated database leaves it as is
+	d, err = NewDatabase(context.Background(), path)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	d.Close()
+	backups, err := filepath.Glob(path + ".pre-migration-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 0 {
+		t.Errorf("got backups %v without pending migrations", backups)
+	}
+}
+
+func TestApplyMigration(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		wantErr bool
+	}{
+		{"valid", "CREATE TABLE migrated (id INTEGER); INSERT INTO migrated VALUES (1);", false},
+		{"invalid", "CREATE TABLE migrated (id INTEGER); INSERT INTO missing VALUES (1);", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDatabase(t)
+
+			err := d.applyMigration(Migration{Version: 999, Name: "test", sql: tt.sql})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			// A failed migration leaves neither its changes nor its version
+			var tables, versions int
+			if err := d.queryRow("SELECT count(*) FROM duckdb_tables() WHERE table_name = 'migrated'").Scan(&tables); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.queryRow("SELECT count(*) FROM schema_version WHERE version = 999").Scan(&versions); err != nil {
+				t.Fatal(err)
+			}
+			want := 1
+			if tt.wantErr {
+				want = 0
+			}
+			if tables != want || versions != want {
+				t.Errorf("got %d tables and %d versions, want %d", tables, versions, want)
+			}
+		})
+	}
+}
+
+func TestBackupFile(t *testing.T) {
+	d := newTestDatabase(t)
+	mustExec(t, d, "INSERT INTO users (id, name) VALUES ('a', 'Alice')")
+
+	backupPath, err := d.backupFile("pre-migration-999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(backupPath, d.path+".pre-migration-999-") {
+		t.Errorf("got backup path %s", backupPath)
+	}
+	if _, err := os.Stat(backupPath); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := OpenDatabase(context.Background(), backupPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	var name string
+	if err := backup.queryRow("SELECT name FROM users WHERE id = 'a'").Scan(&name); err != nil || name != "Alice" {
+		t.Errorf("got user %q (%v) from backup, want Alice", name, err)
+	}
+}
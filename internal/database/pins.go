@@ -0,0 +1,130 @@
+package database
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+)
+
+var pinPattern = regexp.MustCompile(`^[0-9]{4,8}$`)
+
+// Iterations of the PIN hash. Logging in by PIN hashes it once per user with
+// a PIN, so the count is kept moderate.
+const pinHashIterations = 10000
+
+// hashPIN returns the hash under which the PIN is stored. Without a salt it's
+// the unsalted hash of PINs set before salts were added.
+func hashPIN(pin string, salt []byte) (string, error) {
+	if salt == nil {
+		hash := sha256.Sum256([]byte("pin:" + pin))
+		return hex.EncodeToString(hash[:]), nil
+	}
+	key, err := pbkdf2.Key(sha256.New, pin, salt, pinHashIterations, sha256.Size)
+	if err != nil {
+		return "", fmt.Errorf("could not hash PIN: %w", err)
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// matchPIN reports whether the PIN matches the stored hash and salt.
+func matchPIN(pin string, pinHash string, salt sql.NullString) (bool, error) {
+	var saltBytes []byte
+	if salt.Valid {
+		var err error
+		if saltBytes, err = hex.DecodeString(salt.String); err != nil {
+			return false, fmt.Errorf("invalid PIN salt: %w", err)
+		}
+	}
+	hash, err := hashPIN(pin, saltBytes)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(pinHash)) == 1, nil
+}
+
+// SetUserPIN sets the login PIN of the user. An empty PIN removes it. PINs
+// don't need to be unique, but a PIN shared by several users doesn't log any
+// of them in.
+func (d *Database) SetUserPIN(userID string, pin string) error {
+	if pin == "" {
+		if _, err := d.exec("DELETE FROM user_pins WHERE user_id = ?", userID); err != nil {
+			return fmt.Errorf("could not remove PIN: %w", err)
+		}
+		return nil
+	}
+	if !pinPattern.MatchString(pin) {
+		return fmt.Errorf("%w: PIN must be 4-8 digits", ErrInvalidProfile)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("could not generate PIN salt: %w", err)
+	}
+	hash, err := hashPIN(pin, salt)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.exec(`
+		INSERT INTO user_pins (user_id, pin_hash, salt)
+		VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET pin_hash = excluded.pin_hash, salt = excluded.salt, updated_at = now()
+	`, userID, hash, hex.EncodeToString(salt))
+	if err != nil {
+		return fmt.Errorf("could not store PIN: %w", err)
+	}
+	return nil
+}
+
+// GetUserByPIN returns the user with the PIN, or nil if no user or more than
+// one user has it.
+func (d *Database) GetUserByPIN(pin string) (*User, error) {
+	if !pinPattern.MatchString(pin) {
+		return nil, nil
+	}
+
+	rows, err := d.query(`
+		SELECT u.id, u.name, p.pin_hash, p.salt
+		FROM user_pins p
+		JOIN users u ON u.id = p.user_id
+		ORDER BY u.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("could not get user by PIN: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	var found *User
+	for rows.Next() {
+		var user User
+		var pinHash string
+		var salt sql.NullString
+		if err := rows.Scan(&user.ID, &user.Name, &pinHash, &salt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		match, err := matchPIN(pin, pinHash, salt)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			continue
+		}
+		if found != nil {
+			return nil, nil
+		}
+		found = &user
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return found, nil
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUserPINs(t *testing.T) {
+	d := newTestDatabase(t)
+	mustExec(t, d,
+		"INSERT INTO users (id, name) VALUES ('a', 'Alice'), ('b', 'Bob'), ('c', 'Carol')",
+		// PIN 9999 of Carol was set before salts were added
+		"INSERT INTO user_pins (user_id, pin_hash) VALUES ('c', '"+mustHashPIN(t, "9999", nil)+"')",
+	)
+
+	for userID, pin := range map[string]string{"a": "1234", "b": "123456"} {
+		if err := d.SetUserPIN(userID, pin); err != nil {
+			t.Fatalf("failed to set PIN of %s: %v", userID, err)
+		}
+	}
+	if err := d.SetUserPIN("a", "12ab"); !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("SetUserPIN with letters = %v, want ErrInvalidProfile", err)
+	}
+
+	tests := []struct {
+		pin  string
+		want string
+	}{
+		{"1234", "a"},
+		{"123456", "b"},
+		{"9999", "c"},
+		{"4321", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		user, err := d.GetUserByPIN(tt.pin)
+		if err != nil {
+			t.Fatalf("failed to get user by PIN %q: %v", tt.pin, err)
+		}
+		got := ""
+		if user != nil {
+			got = user.ID
+		}
+		if got != tt.want {
+			t.Errorf("GetUserByPIN(%q) = %q, want %q", tt.pin, got, tt.want)
+		}
+	}
+
+	// A PIN shared by two users logs neither in, and setting it doesn't tell
+	// that it's taken
+	if err := d.SetUserPIN("b", "1234"); err != nil {
+		t.Fatalf("failed to set the PIN of another user: %v", err)
+	}
+	if user, err := d.GetUserByPIN("1234"); err != nil || user != nil {
+		t.Errorf("GetUserByPIN of a shared PIN = %v, %v, want no user", user, err)
+	}
+
+	var salts int
+	if err := d.queryRow("SELECT count(DISTINCT salt) FROM user_pins").Scan(&salts); err != nil {
+		t.Fatal(err)
+	}
+	if salts != 2 {
+		t.Errorf("got %d distinct salts, want 2", salts)
+	}
+}
+
+func mustHashPIN(t *testing.T, pin string, salt []byte) string {
+	t.Helper()
+	hash, err := hashPIN(pin, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
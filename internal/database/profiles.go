@@ -0,0 +1,255 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/majori/wrc-laptimer/pkg/profanity"
+	"github.com/majori/wrc-laptimer/pkg/username"
+)
+
+const (
+	minNameLength = 2
+	maxNameLength = 32
+	MaxAvatarSize = 256 * 1024
+)
+
+var avatarContentTypes = []string{"image/gif", "image/jpeg", "image/png", "image/webp"}
+
+var nationalityPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ErrInvalidProfile is wrapped by the errors caused by invalid profile
+// values, e.g. a name which is already taken.
+var ErrInvalidProfile = errors.New("invalid profile")
+
+type UserProfile struct {
+	UserID               string     `json:"user_id"`
+	Name                 string     `json:"name"`
+	DefaultName          string     `json:"default_name"`
+	Nationality          *string    `json:"nationality"`
+	FavouriteVehicleID   *uint16    `json:"favourite_vehicle_id"`
+	FavouriteVehicleName *string    `json:"favourite_vehicle_name"`
+	HasAvatar            bool       `json:"has_avatar"`
+	HasPIN               bool       `json:"has_pin"`
+	ClaimedAt            *time.Time `json:"claimed_at"`
+	UpdatedAt            *time.Time `json:"updated_at"`
+}
+
+// ProfileUpdate holds the profile fields to change. Nil fields are left as
+// they are. An empty name restores the generated name, and an empty
+// nationality, PIN or zero vehicle clears the field.
+type ProfileUpdate struct {
+	Name               *string `json:"name"`
+	Nationality        *string `json:"nationality"`
+	FavouriteVehicleID *uint16 `json:"favourite_vehicle_id"`
+	PIN                *string `json:"pin"`
+}
+
+// GetUserProfile returns the profile of the user, or nil if the user does
+// not exist. Users who haven't set up their profile have an empty profile.
+func (d *Database) GetUserProfile(userID string) (*UserProfile, error) {
+	var profile UserProfile
+	err := d.queryRow(`
+		SELECT
+			u.id,
+			u.name,
+			p.nationality,
+			p.favourite_vehicle_id,
+			v.name,
+			COALESCE(p.avatar IS NOT NULL, false),
+			pin.user_id IS NOT NULL,
+			p.claimed_at,
+			p.updated_at
+		FROM users u
+		LEFT JOIN user_profiles p ON p.user_id = u.id
+		LEFT JOIN user_pins pin ON pin.user_id = u.id
+		LEFT JOIN vehicles v ON v.id = p.favourite_vehicle_id
+		WHERE u.id = ?
+	`, userID).Scan(
+		&profile.UserID,
+		&profile.Name,
+		&profile.Nationality,
+		&profile.FavouriteVehicleID,
+		&profile.FavouriteVehicleName,
+		&profile.HasAvatar,
+		&profile.HasPIN,
+		&profile.ClaimedAt,
+		&profile.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No user found
+		}
+		return nil, fmt.Errorf("could not get user profile: %w", err)
+	}
+	profile.DefaultName = username.GenerateFromSeed(userID)
+	return &profile, nil
+}
+
+// validateName checks that the name is decent and not used by another user,
+// and returns it trimmed.
+func (d *Database) validateName(userID string, name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	length := utf8.RuneCountInString(name)
+	if length < minNameLength || length > maxNameLength {
+		return "", fmt.Errorf("%w: name must be %d-%d characters long", ErrInvalidProfile, minNameLength, maxNameLength)
+	}
+	if profanity.Contains(name) {
+		return "", fmt.Errorf("%w: name is not allowed", ErrInvalidProfile)
+	}
+
+	var taken bool
+	err := d.queryRow(`
+		SELECT EXISTS (
+			SELECT 1
+			FROM users
+			WHERE lower(name) = lower(?) AND id != ?
+		)
+	`, name, userID).Scan(&taken)
+	if err != nil {
+		return "", fmt.Errorf("could not check name: %w", err)
+	}
+	if taken {
+		return "", fmt.Errorf("%w: name %q is already taken", ErrInvalidProfile, name)
+	}
+	return name, nil
+}
+
+// ensureUserProfile creates an empty profile for the user if there is none.
+func (d *Database) ensureUserProfile(userID string) error {
+	_, err := d.exec(`
+		INSERT INTO user_profiles (user_id)
+		VALUES (?)
+		ON CONFLICT DO NOTHING
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("could not create user profile: %w", err)
+	}
+	return nil
+}
+
+// UpdateUserProfile validates and stores the changed profile fields. The user
+// must exist.
+func (d *Database) UpdateUserProfile(userID string, update ProfileUpdate) error {
+	var name, nationality sql.NullString
+	var vehicleID sql.NullInt16
+
+	if update.Name != nil {
+		if strings.TrimSpace(*update.Name) == "" {
+			name = sql.NullString{String: username.GenerateFromSeed(userID), Valid: true}
+		} else {
+			validName, err := d.validateName(userID, *update.Name)
+			if err != nil {
+				return err
+			}
+			name = sql.NullString{String: validName, Valid: true}
+		}
+	}
+
+	if update.Nationality != nil && *update.Nationality != "" {
+		code := strings.ToUpper(strings.TrimSpace(*update.Nationality))
+		if !nationalityPattern.MatchString(code) {
+			return fmt.Errorf("%w: nationality must be a two letter country code", ErrInvalidProfile)
+		}
+		nationality = sql.NullString{String: code, Valid: true}
+	}
+
+	if update.FavouriteVehicleID != nil && *update.FavouriteVehicleID != 0 {
+		var exists bool
+		err := d.queryRow("SELECT EXISTS (SELECT 1 FROM vehicles WHERE id = ?)", *update.FavouriteVehicleID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("could not check vehicle: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("%w: vehicle %d does not exist", ErrInvalidProfile, *update.FavouriteVehicleID)
+		}
+		vehicleID = sql.NullInt16{Int16: int16(*update.FavouriteVehicleID), Valid: true}
+	}
+
+	// The PIN is stored before the other fields, so an invalid PIN leaves the
+	// profile unchanged
+	if update.PIN != nil {
+		if err := d.SetUserPIN(userID, *update.PIN); err != nil {
+			return err
+		}
+	}
+
+	if name.Valid {
+		if _, err := d.exec("UPDATE users SET name = ? WHERE id = ?", name, userID); err != nil {
+			return fmt.Errorf("could not update name: %w", err)
+		}
+	}
+
+	if err := d.ensureUserProfile(userID); err != nil {
+		return err
+	}
+	if update.Nationality != nil {
+		if _, err := d.exec("UPDATE user_profiles SET nationality = ? WHERE user_id = ?", nationality, userID); err != nil {
+			return fmt.Errorf("could not update nationality: %w", err)
+		}
+	}
+	if update.FavouriteVehicleID != nil {
+		if _, err := d.exec("UPDATE user_profiles SET favourite_vehicle_id = ? WHERE user_id = ?", vehicleID, userID); err != nil {
+			return fmt.Errorf("could not update favourite vehicle: %w", err)
+		}
+	}
+	if _, err := d.exec("UPDATE user_profiles SET updated_at = CURRENT_TIMESTAMP WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("could not update profile: %w", err)
+	}
+	return nil
+}
+
+// GetUserAvatar returns the avatar image and its content type, or nil if the
+// user has no avatar.
+func (d *Database) GetUserAvatar(userID string) ([]byte, string, error) {
+	var avatar []byte
+	var contentType sql.NullString
+	err := d.queryRow(`
+		SELECT avatar, avatar_content_type
+		FROM user_profiles
+		WHERE user_id = ? AND avatar IS NOT NULL
+	`, userID).Scan(&avatar, &contentType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", nil // No avatar
+		}
+		return nil, "", fmt.Errorf("could not get avatar: %w", err)
+	}
+	return avatar, contentType.String, nil
+}
+
+// SetUserAvatar stores the avatar image of the user. Nil image removes the
+// avatar.
+func (d *Database) SetUserAvatar(userID string, avatar []byte, contentType string) error {
+	var value any
+	if avatar != nil {
+		value = avatar
+		if len(avatar) > MaxAvatarSize {
+			return fmt.Errorf("%w: avatar must be at most %d KiB", ErrInvalidProfile, MaxAvatarSize/1024)
+		}
+		if !slices.Contains(avatarContentTypes, contentType) {
+			return fmt.Errorf("%w: avatar must be one of %s", ErrInvalidProfile, strings.Join(avatarContentTypes, ", "))
+		}
+	} else {
+		contentType = ""
+	}
+
+	if err := d.ensureUserProfile(userID); err != nil {
+		return err
+	}
+	_, err := d.exec(`
+		UPDATE user_profiles
+		SET avatar = ?, avatar_content_type = NULLIF(?, ''), updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ?
+	`, value, contentType, userID)
+	if err != nil {
+		return fmt.Errorf("could not store avatar: %w", err)
+	}
+	return nil
+}
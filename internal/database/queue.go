@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type QueuedDriver struct {
+	UserID   string     `json:"user_id"`
+	Name     string     `json:"name"`
+	QueuedAt *time.Time `json:"queued_at"`
+}
+
+// GetQueue returns the drivers waiting for their turn, the next one first.
+func (d *Database) GetQueue() ([]QueuedDriver, error) {
+	rows, err := d.query(`
+		SELECT q.user_id, u.name, q.queued_at
+		FROM driver_queue q
+		JOIN users u ON u.id = q.user_id
+		ORDER BY q.queued_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queue: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	queue := []QueuedDriver{}
+	for rows.Next() {
+		var driver QueuedDriver
+		if err := rows.Scan(&driver.UserID, &driver.Name, &driver.QueuedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		queue = append(queue, driver)
+	}
+	return queue, rows.Err()
+}
+
+// QueueUser adds the user to the end of the queue. A user already in the
+// queue keeps their place.
+func (d *Database) QueueUser(userID string) error {
+	_, err := d.exec(`
+		INSERT INTO driver_queue (user_id)
+		VALUES (?)
+		ON CONFLICT DO NOTHING
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("could not queue user: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) DequeueUser(userID string) error {
+	if _, err := d.exec("DELETE FROM driver_queue WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("could not remove user from queue: %w", err)
+	}
+	return nil
+}
+
+// LoginNextQueued logs in the first driver of the queue. It returns false if
+// the queue is empty.
+func (d *Database) LoginNextQueued() (bool, error) {
+	var userID string
+	err := d.queryRow(`
+		SELECT user_id
+		FROM driver_queue
+		ORDER BY queued_at
+		LIMIT 1
+	`).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("could not get next driver: %w", err)
+	}
+
+	if err := d.LoginUser(userID); err != nil {
+		return false, err
+	}
+	slog.Info("next driver in queue logged in", "id", userID)
+	return true, nil
+}
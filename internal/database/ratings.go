@@ -0,0 +1,333 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	defaultRating = 1500.0
+	ratingKFactor = 32.0
+)
+
+type UserRating struct {
+	UserID         string    `db:"user_id" json:"user_id"`
+	VehicleClassID *int16    `db:"vehicle_class_id" json:"vehicle_class_id"`
+	Rating         float64   `db:"rating" json:"rating"`
+	EventCount     int       `db:"event_count" json:"event_count"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type UserRatingChange struct {
+	ID             int       `db:"id" json:"id"`
+	UserID         string    `db:"user_id" json:"user_id"`
+	VehicleClassID *int16    `db:"vehicle_class_id" json:"vehicle_class_id"`
+	RaceEventID    int       `db:"race_event_id" json:"race_event_id"`
+	Position       int       `db:"position" json:"position"`
+	RatingBefore   float64   `db:"rating_before" json:"rating_before"`
+	RatingAfter    float64   `db:"rating_after" json:"rating_after"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+}
+
+// calculateEloRatings treats an event as a round robin where every driver
+// beat everyone who finished behind them. Ratings must be ordered by finishing
+// position and the K-factor is split between opponents so that large events
+// don't swing ratings more than head-to-head ones.
+func calculateEloRatings(ratings []float64) []float64 {
+	updated := make([]float64, len(ratings))
+	copy(updated, ratings)
+	if len(ratings) < 2 {
+		return updated
+	}
+
+	k := ratingKFactor / float64(len(ratings)-1)
+	for i := range ratings {
+		for j := range ratings {
+			if i == j {
+				continue
+			}
+			expected := 1 / (1 + math.Pow(10, (ratings[j]-ratings[i])/400))
+			score := 0.0
+			if i < j {
+				score = 1
+			}
+			updated[i] += k * (score - expected)
+		}
+	}
+	return updated
+}
+
+// overallRatingClass is the vehicle class the overall rating is stored with.
+const overallRatingClass = 0
+
+func ratingClass(vehicleClassID sql.NullInt16) int16 {
+	if !vehicleClassID.Valid {
+		return overallRatingClass
+	}
+	return vehicleClassID.Int16
+}
+
+func (d *Database) getUserRating(tx *sql.Tx, userID string, vehicleClassID sql.NullInt16) (float64, int, error) {
+	var rating float64
+	var eventCount int
+	err := tx.QueryRowContext(d.ctx, `
+		SELECT rating, event_count
+		FROM user_ratings
+		WHERE user_id = ? AND vehicle_class_id = ?
+	`, userID, ratingClass(vehicleClassID)).Scan(&rating, &eventCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return defaultRating, 0, nil
+		}
+		return 0, 0, fmt.Errorf("failed to fetch rating: %w", err)
+	}
+	return rating, eventCount, nil
+}
+
+func (d *Database) storeUserRating(tx *sql.Tx, userID string, vehicleClassID sql.NullInt16, rating float64, eventCount int) error {
+	_, err := tx.ExecContext(d.ctx, `
+		INSERT INTO user_ratings (user_id, vehicle_class_id, rating, event_count, updated_at)
+		VALUES (?, ?, ?, ?, now())
+		ON CONFLICT (user_id, vehicle_class_id) DO UPDATE SET
+			rating = excluded.rating,
+			event_count = excluded.event_count,
+			updated_at = now()
+	`, userID, ratingClass(vehicleClassID), rating, eventCount)
+	if err != nil {
+		return fmt.Errorf("failed to store rating: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) updateRatings(tx *sql.Tx, eventID int, vehicleClassID sql.NullInt16, results []Result) error {
+	before := make([]float64, len(results))
+	eventCounts := make([]int, len(results))
+	for i, result := range results {
+		rating, eventCount, err := d.getUserRating(tx, result.UserID, vehicleClassID)
+		if err != nil {
+			return err
+		}
+		before[i] = rating
+		eventCounts[i] = eventCount
+	}
+
+	after := calculateEloRatings(before)
+
+	for i, result := range results {
+		if err := d.storeUserRating(tx, result.UserID, vehicleClassID, after[i], eventCounts[i]+1); err != nil {
+			return fmt.Errorf("failed to update rating for user %s: %w", result.UserID, err)
+		}
+
+		_, err := tx.ExecContext(d.ctx, `
+			INSERT INTO user_rating_history (user_id, vehicle_class_id, race_event_id, position, rating_before, rating_after)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, result.UserID, vehicleClassID, eventID, result.Position, before[i], after[i])
+		if err != nil {
+			return fmt.Errorf("failed to store rating history for user %s: %w", result.UserID, err)
+		}
+	}
+	return nil
+}
+
+// UpdateEventRatings updates the overall ratings and, if the event is
+// restricted to a vehicle class, the class ratings of everyone who finished
+// the event. Positions are taken from the best time results.
+func (d *Database) UpdateEventRatings(eventID int) error {
+	tx, err := d.db.BeginTx(d.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := d.updateEventRatings(tx, eventID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit ratings: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) updateEventRatings(tx *sql.Tx, eventID int) error {
+	var vehicleClassID sql.NullInt16
+	err := tx.QueryRowContext(d.ctx, "SELECT vehicle_class_id FROM race_events WHERE id = ?", eventID).Scan(&vehicleClassID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("event %d does not exist", eventID)
+		}
+		return fmt.Errorf("failed to get event: %w", err)
+	}
+
+	rows, err := tx.QueryContext(d.ctx, `
+		SELECT user_id, position
+		FROM results
+		WHERE race_event_id = ? AND hc_mode = false
+		ORDER BY position ASC
+	`, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to query results: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	var results []Result
+	for rows.Next() {
+		var result Result
+		if err := rows.Scan(&result.UserID, &result.Position); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	if err := d.updateRatings(tx, eventID, sql.NullInt16{}, results); err != nil {
+		return fmt.Errorf("failed to update overall ratings: %w", err)
+	}
+
+	if vehicleClassID.Valid {
+		if err := d.updateRatings(tx, eventID, vehicleClassID, results); err != nil {
+			return fmt.Errorf("failed to update class ratings: %w", err)
+		}
+	}
+	return nil
+}
+
+// RecalculateRatings rebuilds every rating by replaying the ended events in
+// the order they ended. Needed when past results change, e.g. after users
+// are merged.
+func (d *Database) RecalculateRatings() error {
+	tx, err := d.db.BeginTx(d.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := d.recalculateRatings(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit ratings: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) recalculateRatings(tx *sql.Tx) error {
+	rows, err := tx.QueryContext(d.ctx, `
+		SELECT id
+		FROM race_events
+		WHERE ended_at IS NOT NULL
+		ORDER BY ended_at ASC, id ASC
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query ended events: %w", err)
+	}
+	var eventIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close() //nolint:errcheck
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		eventIDs = append(eventIDs, id)
+	}
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	if _, err := tx.ExecContext(d.ctx, "DELETE FROM user_ratings"); err != nil {
+		return fmt.Errorf("failed to delete ratings: %w", err)
+	}
+	if _, err := tx.ExecContext(d.ctx, "DELETE FROM user_rating_history"); err != nil {
+		return fmt.Errorf("failed to delete rating history: %w", err)
+	}
+	for _, id := range eventIDs {
+		if err := d.updateEventRatings(tx, id); err != nil {
+			return fmt.Errorf("failed to update ratings of event %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (d *Database) GetUserRatings(userID string) ([]UserRating, error) {
+	rows, err := d.query(`
+		SELECT user_id, NULLIF(vehicle_class_id, 0), rating, event_count, updated_at
+		FROM user_ratings
+		WHERE user_id = ?
+		ORDER BY vehicle_class_id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ratings: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	ratings := []UserRating{}
+	for rows.Next() {
+		var rating UserRating
+		if err := rows.Scan(
+			&rating.UserID,
+			&rating.VehicleClassID,
+			&rating.Rating,
+			&rating.EventCount,
+			&rating.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		ratings = append(ratings, rating)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return ratings, nil
+}
+
+func (d *Database) GetUserRatingHistory(userID string) ([]UserRatingChange, error) {
+	rows, err := d.query(`
+		SELECT id, user_id, vehicle_class_id, race_event_id, position, rating_before, rating_after, created_at
+		FROM user_rating_history
+		WHERE user_id = ?
+		ORDER BY id ASC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rating history: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	history := []UserRatingChange{}
+	for rows.Next() {
+		var change UserRatingChange
+		if err := rows.Scan(
+			&change.ID,
+			&change.UserID,
+			&change.VehicleClassID,
+			&change.RaceEventID,
+			&change.Position,
+			&change.RatingBefore,
+			&change.RatingAfter,
+			&change.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		history = append(history, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return history, nil
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCalculateEloRatings(t *testing.T) {
+	tests := []struct {
+		name    string
+		ratings []float64
+		want    []float64
+	}{
+		{"single driver", []float64{1500}, []float64{1500}},
+		{"equal pair", []float64{1500, 1500}, []float64{1516, 1484}},
+		{"favourite wins", []float64{1900, 1500}, []float64{1902.9091, 1497.0909}},
+		{"underdog wins", []float64{1500, 1900}, []float64{1529.0909, 1870.9091}},
+		{"equal three", []float64{1500, 1500, 1500}, []float64{1516, 1500, 1484}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculateEloRatings(tt.ratings)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d ratings, want %d", len(got), len(tt.want))
+			}
+			sum, wantSum := 0.0, 0.0
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 1e-3 {
+					t.Errorf("rating %d = %.4f, want %.4f", i, got[i], tt.want[i])
+				}
+				sum += got[i]
+				wantSum += tt.ratings[i]
+			}
+			if math.Abs(sum-wantSum) > 1e-9 {
+				t.Errorf("ratings sum to %f, want %f", sum, wantSum)
+			}
+		})
+	}
+}
+
+func seedRatedEvents(t *testing.T, d *Database) {
+	t.Helper()
+	mustExec(t, d,
+		"INSERT INTO users (id, name) VALUES ('a', 'Alice'), ('b', 'Bob'), ('c', 'Carol')",
+		"INSERT INTO race_series (name, point_scale) VALUES ('Cup', '10-6-4')",
+		`INSERT INTO race_events (race_series_id, name, vehicle_class_id, ended_at) VALUES
+			(1, 'Round 1', NULL, '2025-01-01 12:00:00'),
+			(1, 'Round 2', 3, '2025-01-02 12:00:00')`,
+		`INSERT INTO results (user_id, race_event_id, hc_mode, position) VALUES
+			('a', 1, false, 1), ('b', 1, false, 2),
+			('b', 2, false, 1), ('a', 2, false, 2), ('c', 2, false, 3)`,
+	)
+}
+
+func ratingsByClass(t *testing.T, d *Database, userID string) map[int16]UserRating {
+	t.Helper()
+	ratings, err := d.GetUserRatings(userID)
+	if err != nil {
+		t.Fatalf("failed to get ratings: %v", err)
+	}
+	byClass := map[int16]UserRating{}
+	for _, rating := range ratings {
+		class := int16(-1)
+		if rating.VehicleClassID != nil {
+			class = *rating.VehicleClassID
+		}
+		if _, ok := byClass[class]; ok {
+			t.Fatalf("user %s has two ratings in class %d", userID, class)
+		}
+		byClass[class] = rating
+	}
+	return byClass
+}
+
+func TestUpdateEventRatings(t *testing.T) {
+	d := newTestDatabase(t)
+	seedRatedEvents(t, d)
+
+	for _, id := range []int{1, 2} {
+		if err := d.UpdateEventRatings(id); err != nil {
+			t.Fatalf("failed to update ratings of event %d: %v", id, err)
+		}
+	}
+
+	// -1 is the overall rating
+	want := map[string]map[int16]int{
+		"a": {-1: 2, 3: 1},
+		"b": {-1: 2, 3: 1},
+		"c": {-1: 1, 3: 1},
+	}
+	for userID, classes := range want {
+		ratings := ratingsByClass(t, d, userID)
+		if len(ratings) != len(classes) {
+			t.Errorf("user %s has %d ratings, want %d", userID, len(ratings), len(classes))
+		}
+		for class, eventCount := range classes {
+			if got := ratings[class].EventCount; got != eventCount {
+				t.Errorf("user %s class %d event count = %d, want %d", userID, class, got, eventCount)
+			}
+		}
+	}
+
+	overall := ratingsByClass(t, d, "b")[-1].Rating
+	if err := d.RecalculateRatings(); err != nil {
+		t.Fatalf("failed to recalculate ratings: %v", err)
+	}
+	if got := ratingsByClass(t, d, "b")[-1].Rating; math.Abs(got-overall) > 1e-9 {
+		t.Errorf("recalculated rating = %f, want %f", got, overall)
+	}
+
+	history, err := d.GetUserRatingHistory("a")
+	if err != nil {
+		t.Fatalf("failed to get rating history: %v", err)
+	}
+	if len(history) != 3 {
+		t.Errorf("got %d rating changes, want 3", len(history))
+	}
+}
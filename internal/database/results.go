@@ -193,7 +193,7 @@ func (d *Database) GetPointsByEventID(eventID int, HCMode bool) ([]Result, error
 		SELECT 
 			id, user_id, race_event_id, created_at, points, hc_mode, position, result_time
 		FROM 
-			points
+			results
 		WHERE 
 			race_event_id = ? AND hc_mode = ?
 		ORDER BY 
@@ -232,3 +232,93 @@ func (d *Database) GetPointsByEventID(eventID int, HCMode bool) ([]Result, error
 	}
 	return points, nil
 }
+
+type EventResult struct {
+	Position   int     `json:"position"`
+	UserID     string  `json:"user_id"`
+	UserName   *string `json:"user_name"`
+	ResultTime float32 `json:"result_time"`
+	Points     int     `json:"points"`
+}
+
+// GetEventResults returns the stored results of an ended event in finishing
+// order. In HC mode only the first run of each driver counts.
+func (d *Database) GetEventResults(eventID int, HCMode bool) ([]EventResult, error) {
+	rows, err := d.query(`
+		SELECT r.position, r.user_id, u.name, r.result_time, r.points
+		FROM results r
+		LEFT JOIN users u ON u.id = r.user_id
+		WHERE r.race_event_id = ? AND r.hc_mode = ?
+		ORDER BY r.position ASC
+	`, eventID, HCMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query results: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	results := []EventResult{}
+	for rows.Next() {
+		var result EventResult
+		if err := rows.Scan(
+			&result.Position,
+			&result.UserID,
+			&result.UserName,
+			&result.ResultTime,
+			&result.Points,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return results, nil
+}
+
+// RecalculateEventResults replaces the stored results of an ended event, and
+// of its series if the series has ended, with ones calculated from the
+// current sessions. Ratings are not updated, see RecalculateRatings.
+func (d *Database) RecalculateEventResults(eventID int) error {
+	event, err := d.GetEvent(eventID)
+	if err != nil {
+		return fmt.Errorf("failed to get event: %w", err)
+	}
+	if event == nil {
+		return fmt.Errorf("event %d does not exist", eventID)
+	}
+	if !event.EndedAt.Valid {
+		// Results are calculated when the event ends
+		return nil
+	}
+
+	if _, err := d.exec("DELETE FROM results WHERE race_event_id = ?", eventID); err != nil {
+		return fmt.Errorf("failed to delete event results: %w", err)
+	}
+	if err := d.CalculateAndStoreEventResults(eventID); err != nil {
+		return err
+	}
+
+	if !event.RaceSeriesID.Valid {
+		return nil
+	}
+	series, err := d.GetSeries(int(event.RaceSeriesID.Int32))
+	if err != nil {
+		return err
+	}
+	if series == nil || !series.EndedAt.Valid {
+		return nil
+	}
+	if _, err := d.exec("DELETE FROM series_results WHERE race_series_id = ?", series.ID); err != nil {
+		return fmt.Errorf("failed to delete series results: %w", err)
+	}
+	if err := d.CalculateAndStoreSerie(series.ID); err != nil {
+		return fmt.Errorf("failed to calculate series results: %w", err)
+	}
+	return nil
+}
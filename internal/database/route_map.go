@@ -0,0 +1,250 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Resolution of the reference polyline and run traces [metre]
+const routeGeometryResolution = 10.0
+
+type RoutePoint struct {
+	Distance         float64 `json:"distance"`
+	VehiclePositionX float32 `json:"vehicle_position_x"`
+	VehiclePositionY float32 `json:"vehicle_position_y"`
+	VehiclePositionZ float32 `json:"vehicle_position_z"`
+	RunCount         int     `json:"run_count"`
+}
+
+// TracePoint is a point of a single run resampled on the same distance grid
+// as the route geometry, so that runs can be overlaid and compared.
+type TracePoint struct {
+	Distance         float64 `json:"distance"`
+	VehiclePositionX float32 `json:"vehicle_position_x"`
+	VehiclePositionY float32 `json:"vehicle_position_y"`
+	VehiclePositionZ float32 `json:"vehicle_position_z"`
+	Speed            float32 `json:"speed"`
+	Time             float32 `json:"time"`
+}
+
+type SessionTrace struct {
+	SessionID       int          `json:"session_id"`
+	RouteID         uint16       `json:"route_id"`
+	VehicleClassID  uint16       `json:"vehicle_class_id"`
+	ReferenceID     *int         `json:"reference_session_id"`
+	Points          []TracePoint `json:"points"`
+	ReferenceDeltas []*float32   `json:"reference_deltas"`
+}
+
+// UpdateRouteGeometry adds the run of the session to the reference polyline
+// of its route if the session was finished. Each point is a running average
+// over the runs, so only the telemetry of this session is read. Telemetry has
+// to be flushed before calling this.
+func (d *Database) UpdateRouteGeometry(sessionID int) error {
+	var routeID uint16
+	var status sql.NullInt16
+	err := d.queryRow(`
+		SELECT route_id, stage_result_status
+		FROM sessions
+		WHERE id = ?
+	`, sessionID).Scan(&routeID, &status)
+	if err != nil {
+		return fmt.Errorf("failed to fetch session: %w", err)
+	}
+	if !status.Valid || status.Int16 != stageResultStatusFinished {
+		return nil
+	}
+
+	_, err = d.exec(`
+		INSERT INTO route_geometry (route_id, distance, vehicle_position_x, vehicle_position_y, vehicle_position_z, run_count)
+		SELECT
+			$1,
+			floor(stage_current_distance / $3) * $3 AS distance,
+			AVG(vehicle_position_x),
+			AVG(vehicle_position_y),
+			AVG(vehicle_position_z),
+			1
+		FROM telemetry
+		WHERE session_id = $2 AND stage_current_distance >= 0 AND vehicle_position_x IS NOT NULL
+		GROUP BY distance
+		ON CONFLICT (route_id, distance) DO UPDATE SET
+			vehicle_position_x = (vehicle_position_x * run_count + excluded.vehicle_position_x) / (run_count + 1),
+			vehicle_position_y = (vehicle_position_y * run_count + excluded.vehicle_position_y) / (run_count + 1),
+			vehicle_position_z = (vehicle_position_z * run_count + excluded.vehicle_position_z) / (run_count + 1),
+			run_count = run_count + 1,
+			updated_at = now()
+	`, routeID, sessionID, routeGeometryResolution)
+	if err != nil {
+		return fmt.Errorf("failed to update route geometry: %w", err)
+	}
+	return nil
+}
+
+// RebuildRouteGeometry rebuilds the reference polyline of a route from every
+// finished run, e.g. after many runs have been imported at once.
+func (d *Database) RebuildRouteGeometry(routeID int) error {
+	tx, err := d.db.BeginTx(d.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := d.rebuildRouteGeometry(tx, routeID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit route geometry: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) rebuildRouteGeometry(tx *sql.Tx, routeID int) error {
+	_, err := tx.ExecContext(d.ctx, "DELETE FROM route_geometry WHERE route_id = ?", routeID)
+	if err != nil {
+		return fmt.Errorf("failed to clear route geometry: %w", err)
+	}
+
+	_, err = tx.ExecContext(d.ctx, `
+		INSERT INTO route_geometry (route_id, distance, vehicle_position_x, vehicle_position_y, vehicle_position_z, run_count)
+		SELECT route_id, distance, AVG(x), AVG(y), AVG(z), COUNT(*)
+		FROM (
+			SELECT
+				s.route_id,
+				t.session_id,
+				floor(t.stage_current_distance / $2) * $2 AS distance,
+				AVG(t.vehicle_position_x) AS x,
+				AVG(t.vehicle_position_y) AS y,
+				AVG(t.vehicle_position_z) AS z
+			FROM telemetry t
+			JOIN sessions s ON s.id = t.session_id
+			WHERE s.route_id = $1
+				AND s.stage_result_status = 1
+				AND t.stage_current_distance >= 0
+				AND t.vehicle_position_x IS NOT NULL
+			GROUP BY s.route_id, t.session_id, distance
+		)
+		GROUP BY route_id, distance
+	`, routeID, routeGeometryResolution)
+	if err != nil {
+		return fmt.Errorf("failed to store route geometry: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) GetRouteGeometry(routeID int) ([]RoutePoint, error) {
+	rows, err := d.query(`
+		SELECT distance, vehicle_position_x, vehicle_position_y, vehicle_position_z, run_count
+		FROM route_geometry
+		WHERE route_id = ?
+		ORDER BY distance ASC
+	`, routeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query route geometry: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	points := []RoutePoint{}
+	for rows.Next() {
+		var p RoutePoint
+		if err := rows.Scan(&p.Distance, &p.VehiclePositionX, &p.VehiclePositionY, &p.VehiclePositionZ, &p.RunCount); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		points = append(points, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return points, nil
+}
+
+func (d *Database) getTracePoints(sessionID int) ([]TracePoint, error) {
+	rows, err := d.query(`
+		SELECT
+			floor(stage_current_distance / $2) * $2 AS distance,
+			AVG(vehicle_position_x),
+			AVG(vehicle_position_y),
+			AVG(vehicle_position_z),
+			COALESCE(AVG(vehicle_speed), 0),
+			MIN(stage_current_time)
+		FROM telemetry
+		WHERE session_id = $1 AND stage_current_distance >= 0 AND vehicle_position_x IS NOT NULL
+		GROUP BY distance
+		ORDER BY distance ASC
+	`, sessionID, routeGeometryResolution)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session trace: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	points := []TracePoint{}
+	for rows.Next() {
+		var p TracePoint
+		if err := rows.Scan(&p.Distance, &p.VehiclePositionX, &p.VehiclePositionY, &p.VehiclePositionZ, &p.Speed, &p.Time); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		points = append(points, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return points, nil
+}
+
+// GetSessionTrace returns the resampled run of the session together with the
+// time delta at every point to the route record of the same vehicle class.
+// Returns nil if the session does not exist.
+func (d *Database) GetSessionTrace(sessionID int) (*SessionTrace, error) {
+	trace := SessionTrace{SessionID: sessionID}
+	var referenceID sql.NullInt32
+	err := d.queryRow(`
+		SELECT s.route_id, s.vehicle_class_id, r.session_id
+		FROM sessions s
+		LEFT JOIN route_records r ON r.route_id = s.route_id AND r.vehicle_class_id = s.vehicle_class_id
+		WHERE s.id = ?
+	`, sessionID).Scan(&trace.RouteID, &trace.VehicleClassID, &referenceID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No session found
+		}
+		return nil, fmt.Errorf("failed to fetch session: %w", err)
+	}
+
+	trace.Points, err = d.getTracePoints(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	trace.ReferenceDeltas = make([]*float32, len(trace.Points))
+	if referenceID.Valid {
+		id := int(referenceID.Int32)
+		trace.ReferenceID = &id
+
+		reference, err := d.getTracePoints(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get reference trace: %w", err)
+		}
+
+		referenceTimes := make(map[float64]float32, len(reference))
+		for _, p := range reference {
+			referenceTimes[p.Distance] = p.Time
+		}
+		for i, p := range trace.Points {
+			if t, ok := referenceTimes[p.Distance]; ok {
+				delta := p.Time - t
+				trace.ReferenceDeltas[i] = &delta
+			}
+		}
+	}
+
+	return &trace, nil
+}
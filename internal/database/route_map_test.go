@@ -0,0 +1,54 @@
+package database
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRouteGeometry(t *testing.T) {
+	d := newTestDatabase(t)
+	mustExec(t, d,
+		`INSERT INTO sessions (id, route_id, stage_result_status) VALUES
+			(1, 7, 1), (2, 7, 1), (3, 7, 2)`,
+		// Session 1 drives along x = distance, session 2 along x = distance + 2
+		// with twice the samples and session 3 didn't finish
+		`INSERT INTO telemetry (session_id, stage_current_distance, vehicle_position_x, vehicle_position_y, vehicle_position_z)
+			SELECT 1, d, d, 0, 0 FROM range(0, 30, 5) r(d)
+			UNION ALL SELECT 2, d / 2, d / 2 + 2, 0, 0 FROM range(0, 60, 5) r(d)
+			UNION ALL SELECT 3, d, 100, 0, 0 FROM range(0, 30, 5) r(d)`,
+	)
+
+	want := []RoutePoint{
+		{Distance: 0, VehiclePositionX: 4.125, RunCount: 2},
+		{Distance: 10, VehiclePositionX: 14.125, RunCount: 2},
+		{Distance: 20, VehiclePositionX: 24.125, RunCount: 2},
+	}
+	check := func(name string) {
+		t.Helper()
+		points, err := d.GetRouteGeometry(7)
+		if err != nil {
+			t.Fatalf("%s: failed to get route geometry: %v", name, err)
+		}
+		if len(points) != len(want) {
+			t.Fatalf("%s: got %d points, want %d", name, len(points), len(want))
+		}
+		for i, p := range points {
+			if p.Distance != want[i].Distance || p.RunCount != want[i].RunCount ||
+				math.Abs(float64(p.VehiclePositionX-want[i].VehiclePositionX)) > 1e-4 {
+				t.Errorf("%s: point %d = %+v, want %+v", name, i, p, want[i])
+			}
+		}
+	}
+
+	for _, id := range []int{1, 2, 3} {
+		if err := d.UpdateRouteGeometry(id); err != nil {
+			t.Fatalf("failed to update route geometry from session %d: %v", id, err)
+		}
+	}
+	check("updated")
+
+	if err := d.RebuildRouteGeometry(7); err != nil {
+		t.Fatalf("failed to rebuild route geometry: %v", err)
+	}
+	check("rebuilt")
+}
@@ -0,0 +1,314 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// RouteUsage tells how much a route is driven and how often it's finished.
+// Voided sessions and sessions which never ended are not counted.
+type RouteUsage struct {
+	RouteID  int     `json:"route_id"`
+	Route    string  `json:"route"`
+	Location string  `json:"location"`
+	Sessions int     `json:"sessions"`
+	Drivers  int     `json:"drivers"`
+	Finishes int     `json:"finishes"`
+	DNFRate  float64 `json:"dnf_rate"`
+}
+
+// VehicleUsage tells how much a vehicle is driven and how often it's finished.
+type VehicleUsage struct {
+	VehicleID    int     `json:"vehicle_id"`
+	Vehicle      string  `json:"vehicle"`
+	VehicleClass string  `json:"vehicle_class"`
+	Sessions     int     `json:"sessions"`
+	Drivers      int     `json:"drivers"`
+	Finishes     int     `json:"finishes"`
+	DNFRate      float64 `json:"dnf_rate"`
+}
+
+type VehicleTime struct {
+	VehicleID int     `json:"vehicle_id"`
+	Vehicle   string  `json:"vehicle"`
+	BestTime  float64 `json:"best_time"` // [second]
+	UserID    string  `json:"user_id"`
+	Name      string  `json:"name"`
+	SessionID int     `json:"session_id"`
+	Finishes  int     `json:"finishes"`
+}
+
+// RouteClassStats has the finish times of a route in a class, counted like
+// personal bests. Spread is the difference between the 90th and 10th
+// percentile of the personal bests divided by their median; the larger it is,
+// the harder the route is to drive fast.
+type RouteClassStats struct {
+	VehicleClassID int           `json:"vehicle_class_id"`
+	VehicleClass   string        `json:"vehicle_class"`
+	Finishes       int           `json:"finishes"`
+	Drivers        int           `json:"drivers"`
+	AverageTime    float64       `json:"average_time"` // [second]
+	MedianTime     float64       `json:"median_time"`  // [second]
+	RecordTime     float64       `json:"record_time"`  // [second]
+	Spread         float64       `json:"spread"`
+	Vehicles       []VehicleTime `json:"vehicles"`
+}
+
+type RouteStats struct {
+	RouteUsage
+	Classes []RouteClassStats `json:"classes"`
+}
+
+// countedSessionsSQL is the condition of sessions counted in route and
+// vehicle usage.
+const countedSessionsSQL = "stage_result_status IS NOT NULL AND stage_result_status != ?"
+
+// finishedSessionsSQL is the condition of sessions counted in finish times,
+// the same as in the personal_bests view.
+const finishedSessionsSQL = "stage_result_status = ? AND stage_shakedown IS FALSE AND user_id IS NOT NULL"
+
+// GetRouteUsage returns the driven routes, the most driven first.
+func (d *Database) GetRouteUsage() ([]RouteUsage, error) {
+	return d.queryRouteUsage("", stageResultStatusFinished, stageResultVoided)
+}
+
+// GetRouteStats returns the usage and finish times of a route, or nil if the
+// route has never been driven.
+func (d *Database) GetRouteStats(routeID int) (*RouteStats, error) {
+	usage, err := d.queryRouteUsage("AND s.route_id = ?", stageResultStatusFinished, stageResultVoided, routeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(usage) == 0 {
+		return nil, nil
+	}
+	stats := &RouteStats{RouteUsage: usage[0]}
+
+	if stats.Classes, err = d.getRouteClassStats(routeID); err != nil {
+		return nil, err
+	}
+	for i := range stats.Classes {
+		class := &stats.Classes[i]
+		if class.Vehicles, err = d.getRouteVehicleTimes(routeID, class.VehicleClassID); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+func (d *Database) queryRouteUsage(filter string, args ...any) ([]RouteUsage, error) {
+	rows, err := d.query(`
+		SELECT
+			s.route_id,
+			COALESCE(r.name, 'Unknown'),
+			COALESCE(l.name, 'Unknown'),
+			count(*) AS sessions,
+			count(DISTINCT s.user_id),
+			count(*) FILTER (WHERE s.stage_result_status = ?)
+		FROM sessions s
+		LEFT JOIN routes r ON r.id = s.route_id
+		LEFT JOIN locations l ON l.id = r.location_id
+		WHERE s.route_id IS NOT NULL AND s.`+countedSessionsSQL+` `+filter+`
+		GROUP BY s.route_id, r.name, l.name
+		ORDER BY sessions DESC, s.route_id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query route usage: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	routes := []RouteUsage{}
+	for rows.Next() {
+		var route RouteUsage
+		if err := rows.Scan(&route.RouteID, &route.Route, &route.Location, &route.Sessions, &route.Drivers, &route.Finishes); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		route.DNFRate = float64(route.Sessions-route.Finishes) / float64(route.Sessions)
+		routes = append(routes, route)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return routes, nil
+}
+
+func (d *Database) getRouteClassStats(routeID int) ([]RouteClassStats, error) {
+	rows, err := d.query(`
+		WITH finishes AS (
+			SELECT vehicle_class_id, stage_result_time + stage_result_time_penalty AS time
+			FROM sessions
+			WHERE route_id = ? AND vehicle_class_id IS NOT NULL AND `+finishedSessionsSQL+`
+		), bests AS (
+			SELECT vehicle_class_id, best_time
+			FROM personal_bests
+			WHERE route_id = ? AND vehicle_class_id IS NOT NULL
+		)
+		SELECT
+			f.vehicle_class_id,
+			COALESCE(vc.name, 'Unknown'),
+			f.finishes,
+			b.drivers,
+			f.average_time,
+			f.median_time,
+			b.record_time,
+			b.spread
+		FROM (
+			SELECT vehicle_class_id, count(*) AS finishes, avg(time) AS average_time, median(time) AS median_time
+			FROM finishes
+			GROUP BY vehicle_class_id
+		) f
+		JOIN (
+			SELECT
+				vehicle_class_id,
+				count(*) AS drivers,
+				min(best_time) AS record_time,
+				(quantile_cont(best_time, 0.9) - quantile_cont(best_time, 0.1)) / median(best_time) AS spread
+			FROM bests
+			GROUP BY vehicle_class_id
+		) b ON b.vehicle_class_id = f.vehicle_class_id
+		LEFT JOIN vehicle_classes vc ON vc.id = f.vehicle_class_id
+		ORDER BY f.finishes DESC, f.vehicle_class_id
+	`, routeID, stageResultStatusFinished, routeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query route times: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	classes := []RouteClassStats{}
+	for rows.Next() {
+		var class RouteClassStats
+		var spread sql.NullFloat64
+		if err := rows.Scan(
+			&class.VehicleClassID,
+			&class.VehicleClass,
+			&class.Finishes,
+			&class.Drivers,
+			&class.AverageTime,
+			&class.MedianTime,
+			&class.RecordTime,
+			&spread,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		class.Spread = spread.Float64
+		classes = append(classes, class)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return classes, nil
+}
+
+// getRouteVehicleTimes returns the best time of every vehicle on a route in a
+// class, the fastest first.
+func (d *Database) getRouteVehicleTimes(routeID int, vehicleClassID int) ([]VehicleTime, error) {
+	rows, err := d.query(`
+		SELECT
+			s.vehicle_id,
+			COALESCE(v.name, 'Unknown'),
+			s.best_time,
+			s.user_id,
+			COALESCE(u.name, 'Unknown'),
+			s.session_id,
+			s.finishes
+		FROM (
+			SELECT
+				vehicle_id,
+				min(stage_result_time + stage_result_time_penalty) AS best_time,
+				arg_min(user_id, stage_result_time + stage_result_time_penalty) AS user_id,
+				arg_min(id, stage_result_time + stage_result_time_penalty) AS session_id,
+				count(*) AS finishes
+			FROM sessions
+			WHERE route_id = ? AND vehicle_class_id = ? AND vehicle_id IS NOT NULL AND `+finishedSessionsSQL+`
+			GROUP BY vehicle_id
+		) s
+		LEFT JOIN vehicles v ON v.id = s.vehicle_id
+		LEFT JOIN users u ON u.id = s.user_id
+		ORDER BY s.best_time, s.vehicle_id
+	`, routeID, vehicleClassID, stageResultStatusFinished)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vehicle times: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	vehicles := []VehicleTime{}
+	for rows.Next() {
+		var vehicle VehicleTime
+		if err := rows.Scan(
+			&vehicle.VehicleID,
+			&vehicle.Vehicle,
+			&vehicle.BestTime,
+			&vehicle.UserID,
+			&vehicle.Name,
+			&vehicle.SessionID,
+			&vehicle.Finishes,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		vehicles = append(vehicles, vehicle)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return vehicles, nil
+}
+
+// GetVehicleUsage returns the driven vehicles, the most driven first.
+func (d *Database) GetVehicleUsage() ([]VehicleUsage, error) {
+	rows, err := d.query(`
+		SELECT
+			s.vehicle_id,
+			COALESCE(v.name, 'Unknown'),
+			COALESCE(vc.name, 'Unknown'),
+			count(*) AS sessions,
+			count(DISTINCT s.user_id),
+			count(*) FILTER (WHERE s.stage_result_status = ?)
+		FROM sessions s
+		LEFT JOIN vehicles v ON v.id = s.vehicle_id
+		LEFT JOIN vehicle_classes vc ON vc.id = v.class
+		WHERE s.vehicle_id IS NOT NULL AND s.`+countedSessionsSQL+`
+		GROUP BY s.vehicle_id, v.name, vc.name
+		ORDER BY sessions DESC, s.vehicle_id
+	`, stageResultStatusFinished, stageResultVoided)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vehicle usage: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	vehicles := []VehicleUsage{}
+	for rows.Next() {
+		var vehicle VehicleUsage
+		if err := rows.Scan(
+			&vehicle.VehicleID,
+			&vehicle.Vehicle,
+			&vehicle.VehicleClass,
+			&vehicle.Sessions,
+			&vehicle.Drivers,
+			&vehicle.Finishes,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		vehicle.DNFRate = float64(vehicle.Sessions-vehicle.Finishes) / float64(vehicle.Sessions)
+		vehicles = append(vehicles, vehicle)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return vehicles, nil
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"time"
 )
 
 type RaceSerie struct {
@@ -68,6 +69,8 @@ func (d *Database) StartSeries(id int) error {
 }
 
 func (d *Database) EndSeries(id int) error {
+	d.backupBefore(fmt.Sprintf("end-series-%d", id))
+
 	_, err := d.exec(`
 		UPDATE race_series
 		SET active = false,
@@ -154,3 +157,66 @@ func (d *Database) GetAllSeries() ([]*RaceSerie, error) {
 	}
 	return series, nil
 }
+
+type SeriesSummary struct {
+	ID               int        `json:"id"`
+	Name             string     `json:"name"`
+	VehicleClassID   *uint16    `json:"vehicle_class_id"`
+	VehicleClassName *string    `json:"vehicle_class_name"`
+	Active           bool       `json:"active"`
+	EventCount       int        `json:"event_count"`
+	CreatedAt        *time.Time `json:"created_at"`
+	StartedAt        *time.Time `json:"started_at"`
+	EndedAt          *time.Time `json:"ended_at"`
+}
+
+// ListSeries returns every series with the number of events in it, newest
+// first.
+func (d *Database) ListSeries() ([]SeriesSummary, error) {
+	rows, err := d.query(`
+		SELECT
+			s.id,
+			s.name,
+			s.vehicle_class_id,
+			vc.name,
+			s.active,
+			(SELECT COUNT(*) FROM race_events e WHERE e.race_series_id = s.id),
+			s.created_at,
+			s.started_at,
+			s.ended_at
+		FROM race_series s
+		LEFT JOIN vehicle_classes vc ON vc.id = s.vehicle_class_id
+		ORDER BY s.id DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("could not list series: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	series := []SeriesSummary{}
+	for rows.Next() {
+		var s SeriesSummary
+		if err := rows.Scan(
+			&s.ID,
+			&s.Name,
+			&s.VehicleClassID,
+			&s.VehicleClassName,
+			&s.Active,
+			&s.EventCount,
+			&s.CreatedAt,
+			&s.StartedAt,
+			&s.EndedAt,
+		); err != nil {
+			return nil, fmt.Errorf("could not scan series: %w", err)
+		}
+		series = append(series, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return series, nil
+}
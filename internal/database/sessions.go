@@ -1,9 +1,13 @@
 package database
 
 import (
+	"time"
+
 	"github.com/majori/wrc-laptimer/pkg/telemetry"
 )
 
+const stageResultStatusFinished = 1
+
 var activeSessionID int
 var activeSessionVehicleClassID uint16
 
@@ -47,23 +51,31 @@ func (d *Database) StartSession(pkt *telemetry.TelemetrySessionStart) error {
 
 	d.setActiveSessionID(sessionID)
 	d.setActiveSessionVehicleClassID(pkt.VehicleClassID)
+	d.logMissingLookups(sessionID)
 
 	return nil
 }
 
-func (d *Database) EndSession(pkt *telemetry.TelemetrySessionEnd) error {
+// EndSession stores the result of the active session and returns the personal
+// bests and records set by it.
+func (d *Database) EndSession(pkt *telemetry.TelemetrySessionEnd) ([]Achievement, error) {
 	if activeSessionID == 0 {
-		return nil
+		return nil, nil
 	}
 
 	userID, err := d.GetActiveUserID()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	eventID, err := d.GetActiveEventID(int16(activeSessionVehicleClassID))
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	achievements, err := d.findAchievements(activeSessionID, userID, pkt)
+	if err != nil {
+		return nil, err
 	}
 
 	_, err = d.exec(`
@@ -76,12 +88,35 @@ func (d *Database) EndSession(pkt *telemetry.TelemetrySessionEnd) error {
 		WHERE id = ?
 	`, userID, eventID, pkt.StageResultStatus, pkt.StageResultTime, pkt.StageResultTimePenalty, activeSessionID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Reset active session
 	d.setActiveSessionID(0)
 	d.setActiveSessionVehicleClassID(0)
 
-	return nil
+	if err := d.storeAchievements(achievements); err != nil {
+		return nil, err
+	}
+
+	return achievements, nil
+}
+
+// SetStalledSessionTimeout sets how long the active session may go without
+// telemetry before it's abandoned, see AbandonSession. Zero never abandons
+// sessions.
+func (d *Database) SetStalledSessionTimeout(timeout time.Duration) {
+	d.stalledSessionTimeout.Store(int64(timeout))
+}
+
+func (d *Database) GetStalledSessionTimeout() time.Duration {
+	return time.Duration(d.stalledSessionTimeout.Load())
+}
+
+// AbandonSession forgets the active session without a result, e.g. when the
+// game has crashed in the middle of a stage. The session is kept like any
+// other session which never ended.
+func (d *Database) AbandonSession() {
+	d.setActiveSessionID(0)
+	d.setActiveSessionVehicleClassID(0)
 }
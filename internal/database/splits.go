@@ -0,0 +1,145 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+type SessionSplit struct {
+	SessionID            int     `db:"session_id" json:"session_id"`
+	SplitIndex           int     `db:"split_index" json:"split_index"`
+	SplitTime            float32 `db:"split_time" json:"split_time"`
+	StageCurrentTime     float32 `db:"stage_current_time" json:"stage_current_time"`
+	StageCurrentDistance float64 `db:"stage_current_distance" json:"stage_current_distance"`
+}
+
+// SplitComparison compares a split against the same split of the driver's
+// personal best and the route record in the same vehicle class. Deltas are
+// positive when the session is slower than the reference.
+type SplitComparison struct {
+	SessionSplit
+	PersonalBestTime  *float32 `json:"personal_best_time"`
+	PersonalBestDelta *float32 `json:"personal_best_delta"`
+	RecordTime        *float32 `json:"record_time"`
+	RecordDelta       *float32 `json:"record_delta"`
+}
+
+func (d *Database) StoreSplit(split SessionSplit) error {
+	_, err := d.exec(`
+		INSERT INTO session_splits (session_id, split_index, split_time, stage_current_time, stage_current_distance)
+		VALUES (?, ?, ?, ?, ?)
+	`, split.SessionID, split.SplitIndex, split.SplitTime, split.StageCurrentTime, split.StageCurrentDistance)
+	if err != nil {
+		return fmt.Errorf("failed to store split: %w", err)
+	}
+	return nil
+}
+
+func splitDelta(splitTime float32, reference sql.NullFloat64) (*float32, *float32) {
+	if !reference.Valid {
+		return nil, nil
+	}
+	referenceTime := float32(reference.Float64)
+	delta := splitTime - referenceTime
+	return &referenceTime, &delta
+}
+
+func (d *Database) getSplitComparison(sessionID int, userID sql.NullString) ([]SplitComparison, error) {
+	rows, err := d.query(`
+		WITH
+			s AS (
+				SELECT route_id, vehicle_class_id
+				FROM sessions
+				WHERE id = $1
+			),
+			pb AS (
+				SELECT pb.session_id
+				FROM personal_bests pb, s
+				WHERE pb.user_id = $2
+					AND pb.route_id = s.route_id
+					AND pb.vehicle_class_id = s.vehicle_class_id
+			),
+			rec AS (
+				SELECT r.session_id
+				FROM route_records r, s
+				WHERE r.route_id = s.route_id
+					AND r.vehicle_class_id = s.vehicle_class_id
+			)
+		SELECT
+			cur.session_id,
+			cur.split_index,
+			cur.split_time,
+			cur.stage_current_time,
+			cur.stage_current_distance,
+			p.split_time,
+			r.split_time
+		FROM session_splits cur
+		LEFT JOIN session_splits p ON p.session_id = (SELECT session_id FROM pb) AND p.split_index = cur.split_index
+		LEFT JOIN session_splits r ON r.session_id = (SELECT session_id FROM rec) AND r.split_index = cur.split_index
+		WHERE cur.session_id = $1
+		ORDER BY cur.split_index ASC
+	`, sessionID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query splits: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	splits := []SplitComparison{}
+	for rows.Next() {
+		var split SplitComparison
+		var personalBest, record sql.NullFloat64
+		if err := rows.Scan(
+			&split.SessionID,
+			&split.SplitIndex,
+			&split.SplitTime,
+			&split.StageCurrentTime,
+			&split.StageCurrentDistance,
+			&personalBest,
+			&record,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		split.PersonalBestTime, split.PersonalBestDelta = splitDelta(split.SplitTime, personalBest)
+		split.RecordTime, split.RecordDelta = splitDelta(split.SplitTime, record)
+		splits = append(splits, split)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return splits, nil
+}
+
+// GetSessionSplits returns the splits of a stored session compared against
+// the personal best of the session's driver.
+func (d *Database) GetSessionSplits(sessionID int) ([]SplitComparison, error) {
+	var userID sql.NullString
+	err := d.queryRow("SELECT user_id FROM sessions WHERE id = ?", sessionID).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No session found
+		}
+		return nil, fmt.Errorf("failed to fetch session: %w", err)
+	}
+	return d.getSplitComparison(sessionID, userID)
+}
+
+// GetLiveSplitComparison returns the splits of the active session. The driver
+// is attached to the session only when it ends, so the logged in user is used
+// for the personal best comparison.
+func (d *Database) GetLiveSplitComparison() ([]SplitComparison, error) {
+	sessionID := d.GetActiveSessionID()
+	if sessionID == 0 {
+		return nil, nil
+	}
+
+	userID, err := d.GetActiveUserID()
+	if err != nil {
+		return nil, err
+	}
+	return d.getSplitComparison(sessionID, userID)
+}
@@ -1,18 +1,164 @@
 package database
 
 import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"slices"
+
 	"github.com/majori/wrc-laptimer/pkg/telemetry"
 )
 
-func (d *Database) AppendTelemetry(t *telemetry.TelemetrySessionUpdate) error {
-	// Ignore telemetry if no active session
-	sessionID := d.GetActiveSessionID()
-	if sessionID == 0 {
-		return nil
+const (
+	TelemetryCompressionNone    = "none"
+	TelemetryCompressionDelta   = "delta"
+	TelemetryCompressionFloat16 = "float16"
+
+	// Relative change a channel needs before a sample is stored with delta compression
+	deltaTolerance = 0.01
+	// Samples are stored at least this often whatever the sample distance and
+	// compression, so that time based analysis doesn't see the skipped samples
+	// as gaps. Must stay well below maxSampleInterval. [second]
+	sampleHeartbeat = 0.25
+	// Lowest sample rate which stores a sample every heartbeat [hertz]
+	minSampleRate = 1 / sampleHeartbeat
+)
+
+// Columns of the telemetry table in the order of the appender, excluding
+// session_id. Session ID, stage distance and stage time are always stored.
+var telemetryColumns = []string{
+	"stage_current_distance",
+	"stage_current_time",
+	"stage_previous_split_time",
+	"stage_progress",
+	"vehicle_acceleration_x",
+	"vehicle_acceleration_y",
+	"vehicle_acceleration_z",
+	"vehicle_brake",
+	"vehicle_brake_temperature_bl",
+	"vehicle_brake_temperature_br",
+	"vehicle_brake_temperature_fl",
+	"vehicle_brake_temperature_fr",
+	"vehicle_clutch",
+	"vehicle_cluster_abs",
+	"vehicle_cp_forward_speed_bl",
+	"vehicle_cp_forward_speed_br",
+	"vehicle_cp_forward_speed_fl",
+	"vehicle_cp_forward_speed_fr",
+	"vehicle_engine_rpm_current",
+	"vehicle_engine_rpm_idle",
+	"vehicle_engine_rpm_max",
+	"vehicle_forward_direction_x",
+	"vehicle_forward_direction_y",
+	"vehicle_forward_direction_z",
+	"vehicle_gear_index",
+	"vehicle_gear_index_neutral",
+	"vehicle_gear_index_reverse",
+	"vehicle_gear_maximum",
+	"vehicle_handbrake",
+	"vehicle_hub_position_bl",
+	"vehicle_hub_position_br",
+	"vehicle_hub_position_fl",
+	"vehicle_hub_position_fr",
+	"vehicle_hub_velocity_bl",
+	"vehicle_hub_velocity_br",
+	"vehicle_hub_velocity_fl",
+	"vehicle_hub_velocity_fr",
+	"vehicle_left_direction_x",
+	"vehicle_left_direction_y",
+	"vehicle_left_direction_z",
+	"vehicle_position_x",
+	"vehicle_position_y",
+	"vehicle_position_z",
+	"vehicle_speed",
+	"vehicle_steering",
+	"vehicle_throttle",
+	"vehicle_transmission_speed",
+	"vehicle_tyre_state_bl",
+	"vehicle_tyre_state_br",
+	"vehicle_tyre_state_fl",
+	"vehicle_tyre_state_fr",
+	"vehicle_up_direction_x",
+	"vehicle_up_direction_y",
+	"vehicle_up_direction_z",
+	"vehicle_velocity_x",
+	"vehicle_velocity_y",
+	"vehicle_velocity_z",
+}
+
+var requiredTelemetryColumns = []string{"stage_current_distance", "stage_current_time"}
+
+// TelemetryStorage controls how much of the telemetry is stored.
+type TelemetryStorage struct {
+	// Target sample rate, at least minSampleRate. Zero stores every packet. [hertz]
+	SampleRate float64
+	// Minimum distance between stored samples. Zero disables. [metre]
+	SampleDistance float64
+	// Channels (telemetry column names) to store. Other channels are stored
+	// as NULL, which takes practically no space. Empty stores every channel.
+	Channels []string
+	// One of "none", "delta" (skip samples where no channel changed) or
+	// "float16" (round floating point channels to half precision so that they
+	// compress better).
+	Compression string
+}
+
+// telemetryStorageState is the decimation state of the active session.
+type telemetryStorageState struct {
+	sessionID int
+	storedAny bool
+	time      float32
+	distance  float64
+	values    []driver.Value
+}
+
+func (t TelemetryStorage) Validate() error {
+	if t.SampleRate < 0 {
+		return fmt.Errorf("invalid telemetry sample rate: %v", t.SampleRate)
+	}
+	if t.SampleRate > 0 && t.SampleRate < minSampleRate {
+		return fmt.Errorf("telemetry sample rate must be at least %v Hz, got %v", minSampleRate, t.SampleRate)
 	}
+	if t.SampleDistance < 0 {
+		return fmt.Errorf("invalid telemetry sample distance: %v", t.SampleDistance)
+	}
+	for _, channel := range t.Channels {
+		if !slices.Contains(telemetryColumns, channel) {
+			return fmt.Errorf("unknown telemetry channel: %s", channel)
+		}
+	}
+	switch t.Compression {
+	case "", TelemetryCompressionNone, TelemetryCompressionDelta, TelemetryCompressionFloat16:
+	default:
+		return fmt.Errorf("unknown telemetry compression: %s", t.Compression)
+	}
+	return nil
+}
 
-	return d.appender.AppendRow(
-		sessionID,
+func (d *Database) SetTelemetryStorage(storage TelemetryStorage) error {
+	if err := storage.Validate(); err != nil {
+		return err
+	}
+
+	var mask []bool
+	if len(storage.Channels) > 0 {
+		mask = make([]bool, len(telemetryColumns))
+		for i, column := range telemetryColumns {
+			mask[i] = slices.Contains(storage.Channels, column) || slices.Contains(requiredTelemetryColumns, column)
+		}
+	}
+
+	// Storage can be changed while telemetry is being received
+	d.telemetryMu.Lock()
+	defer d.telemetryMu.Unlock()
+	d.telemetryMask = mask
+	d.telemetryStorage = storage
+	d.telemetryState = telemetryStorageState{}
+	return nil
+}
+
+func telemetryValues(t *telemetry.TelemetrySessionUpdate) []driver.Value {
+	return []driver.Value{
 		t.StageCurrentDistance,
 		t.StageCurrentTime,
 		t.StagePreviousSplitTime,
@@ -70,17 +216,111 @@ func (d *Database) AppendTelemetry(t *telemetry.TelemetrySessionUpdate) error {
 		t.VehicleVelocityX,
 		t.VehicleVelocityY,
 		t.VehicleVelocityZ,
-	)
+	}
 }
 
-func (d *Database) FlushTelemetry() error {
-	return d.appender.Flush()
+// roundFloat16 rounds the value to the 10-bit mantissa of IEEE 754 half
+// precision while keeping the exponent range of float32.
+func roundFloat16(f float32) float32 {
+	if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+		return f
+	}
+	bits := math.Float32bits(f)
+	bits += 1 << 12
+	bits &^= 1<<13 - 1
+	return math.Float32frombits(bits)
 }
 
-func (d *Database) ClearTelemetry() error {
-	_, err := d.exec("DELETE FROM telemetry")
-	if err != nil {
-		return err
+// changed reports whether any channel has changed enough since the previous
+// stored sample to be worth storing with delta compression.
+func changed(previous, current []driver.Value) bool {
+	for i := range current {
+		if slices.Contains(requiredTelemetryColumns, telemetryColumns[i]) {
+			continue
+		}
+		switch v := current[i].(type) {
+		case float32:
+			p, ok := previous[i].(float32)
+			if !ok || math.Abs(float64(v-p)) > deltaTolerance*math.Max(math.Abs(float64(p)), 1) {
+				return true
+			}
+		default:
+			if current[i] != previous[i] {
+				return true
+			}
+		}
 	}
-	return nil
+	return false
+}
+
+// shouldStore applies the sample rate, sample distance and delta compression
+// settings to the sample. A sample is stored at least every heartbeat.
+func (d *Database) shouldStore(sessionID int, t *telemetry.TelemetrySessionUpdate, values []driver.Value) bool {
+	state := &d.telemetryState
+	storage := d.telemetryStorage
+
+	if state.sessionID != sessionID || !state.storedAny || t.StageCurrentTime < state.time {
+		return true
+	}
+
+	elapsed := float64(t.StageCurrentTime - state.time)
+	if elapsed >= sampleHeartbeat {
+		return true
+	}
+
+	timeDue := storage.SampleRate <= 0 || elapsed >= 1/storage.SampleRate
+	distanceDue := storage.SampleDistance <= 0 || t.StageCurrentDistance-state.distance >= storage.SampleDistance
+
+	// With both sample rate and distance set, either one being due is enough
+	due := timeDue && distanceDue
+	if storage.SampleRate > 0 && storage.SampleDistance > 0 {
+		due = timeDue || distanceDue
+	}
+	if !due {
+		return false
+	}
+
+	if storage.Compression == TelemetryCompressionDelta && !changed(state.values, values) {
+		return false
+	}
+	return true
+}
+
+func (d *Database) AppendTelemetry(t *telemetry.TelemetrySessionUpdate) error {
+	// Ignore telemetry if no active session
+	sessionID := d.GetActiveSessionID()
+	if sessionID == 0 {
+		return nil
+	}
+
+	d.telemetryMu.Lock()
+	defer d.telemetryMu.Unlock()
+
+	values := telemetryValues(t)
+	for i := range values {
+		if d.telemetryMask != nil && !d.telemetryMask[i] {
+			values[i] = nil
+			continue
+		}
+		if f, ok := values[i].(float32); ok && d.telemetryStorage.Compression == TelemetryCompressionFloat16 && telemetryColumns[i] != "stage_current_time" {
+			values[i] = roundFloat16(f)
+		}
+	}
+
+	if !d.shouldStore(sessionID, t, values) {
+		return nil
+	}
+	d.telemetryState = telemetryStorageState{
+		sessionID: sessionID,
+		storedAny: true,
+		time:      t.StageCurrentTime,
+		distance:  t.StageCurrentDistance,
+		values:    values,
+	}
+
+	return d.appender.AppendRow(append([]driver.Value{sessionID}, values...)...)
+}
+
+func (d *Database) FlushTelemetry() error {
+	return d.appender.Flush()
 }
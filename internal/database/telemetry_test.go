@@ -0,0 +1,97 @@
+package database
+
+import (
+	"math"
+	"testing"
+
+	"github.com/majori/wrc-laptimer/pkg/telemetry"
+)
+
+// storedSampleTimes feeds 60 Hz telemetry of a car which drives at 20 m/s,
+// stops for 5 seconds and drives on, and returns the times of the stored
+// samples.
+func storedSampleTimes(storage TelemetryStorage) []float32 {
+	d := &Database{telemetryStorage: storage}
+
+	var times []float32
+	var distance float64
+	for i := range 20 * 60 {
+		pkt := &telemetry.TelemetrySessionUpdate{
+			StageCurrentTime:     float32(i) / 60,
+			StageCurrentDistance: distance,
+			VehicleSpeed:         20,
+		}
+		if pkt.StageCurrentTime >= 5 && pkt.StageCurrentTime < 10 {
+			pkt.VehicleSpeed = 0
+		}
+		distance += float64(pkt.VehicleSpeed) / 60
+
+		values := telemetryValues(pkt)
+		if d.shouldStore(1, pkt, values) {
+			d.telemetryState = telemetryStorageState{
+				sessionID: 1,
+				storedAny: true,
+				time:      pkt.StageCurrentTime,
+				distance:  pkt.StageCurrentDistance,
+				values:    values,
+			}
+			times = append(times, pkt.StageCurrentTime)
+		}
+	}
+	return times
+}
+
+func TestShouldStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage TelemetryStorage
+		samples int
+	}{
+		{"every packet", TelemetryStorage{}, 1200},
+		{"sample rate", TelemetryStorage{SampleRate: 10}, 200},
+		{"lowest sample rate", TelemetryStorage{SampleRate: minSampleRate}, 80},
+		// The heartbeat stores more often than every 10 metres
+		{"sample distance", TelemetryStorage{SampleDistance: 10}, 80},
+		{"sample rate or distance", TelemetryStorage{SampleRate: 5, SampleDistance: 2}, 150 + 25},
+		// Only the heartbeat is stored as no channel changes
+		{"delta compression", TelemetryStorage{Compression: TelemetryCompressionDelta}, 80},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times := storedSampleTimes(tt.storage)
+			if math.Abs(float64(len(times)-tt.samples)) > float64(tt.samples)/10 {
+				t.Errorf("stored %d samples, want about %d", len(times), tt.samples)
+			}
+			for i := 1; i < len(times); i++ {
+				if gap := times[i] - times[i-1]; gap > maxSampleInterval {
+					t.Fatalf("gap of %.2f s at %.2f s would not be counted in analysis", gap, times[i-1])
+				}
+			}
+		})
+	}
+}
+
+func TestTelemetryStorageValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage TelemetryStorage
+		valid   bool
+	}{
+		{"defaults", TelemetryStorage{}, true},
+		{"sample rate", TelemetryStorage{SampleRate: 10}, true},
+		{"too low sample rate", TelemetryStorage{SampleRate: 1}, false},
+		{"negative sample rate", TelemetryStorage{SampleRate: -1}, false},
+		{"sample distance", TelemetryStorage{SampleDistance: 5}, true},
+		{"negative sample distance", TelemetryStorage{SampleDistance: -5}, false},
+		{"channels", TelemetryStorage{Channels: []string{"vehicle_speed"}}, true},
+		{"unknown channel", TelemetryStorage{Channels: []string{"speed"}}, false},
+		{"unknown compression", TelemetryStorage{Compression: "zip"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.storage.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
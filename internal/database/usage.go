@@ -0,0 +1,345 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	UsageByUser = "user"
+	UsageByDay  = "day"
+	UsageByHour = "hour"
+)
+
+var UsageGroupings = []string{UsageByUser, UsageByDay, UsageByHour}
+
+// UsageTotals sums the use of the rig. Seat time is the time a driver was
+// logged in, and a run is a session which ended, voided ones excluded.
+type UsageTotals struct {
+	SeatTime   float64 `json:"seat_time"` // [second]
+	Runs       int     `json:"runs"`
+	Finishes   int     `json:"finishes"`
+	FinishRate float64 `json:"finish_rate"`
+	Distance   float64 `json:"distance"` // [kilometre]
+}
+
+type UserUsage struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	UsageTotals
+}
+
+// DayUsage is the use of one day. The rig is open from the first login of the
+// day until the last logout, and utilisation is the share of that time
+// someone was logged in.
+type DayUsage struct {
+	Date string `json:"date"`
+	UsageTotals
+	Drivers     int     `json:"drivers"`
+	OpenTime    float64 `json:"open_time"` // [second]
+	Utilisation float64 `json:"utilisation"`
+}
+
+type HourUsage struct {
+	Hour     int     `json:"hour"`
+	Runs     int     `json:"runs"`
+	SeatTime float64 `json:"seat_time"` // [second]
+}
+
+// UsageReport summarises the use of the rig between From and To. Days and
+// hours are in the local time of the laptimer. Logins from before logout
+// times were recorded have no seat time.
+type UsageReport struct {
+	From  time.Time   `json:"from"`
+	To    time.Time   `json:"to"`
+	Total UsageTotals `json:"total"`
+	Users []UserUsage `json:"users"`
+	Days  []DayUsage  `json:"days"`
+	Hours []HourUsage `json:"hours"`
+}
+
+func (t *UsageTotals) addRun(finished bool, distance float64) {
+	t.Runs++
+	if finished {
+		t.Finishes++
+	}
+	t.FinishRate = float64(t.Finishes) / float64(t.Runs)
+	t.Distance += distance / 1000
+}
+
+// dayUsage collects the usage of a day while the report is built.
+type dayUsage struct {
+	DayUsage
+	opensAt  time.Time
+	closesAt time.Time
+	drivers  map[string]bool
+}
+
+func (d *Database) GetUsageReport(from time.Time, to time.Time) (*UsageReport, error) {
+	report := &UsageReport{From: from, To: to, Users: []UserUsage{}, Days: []DayUsage{}}
+	for hour := range 24 {
+		report.Hours = append(report.Hours, HourUsage{Hour: hour})
+	}
+
+	users := map[string]*UserUsage{}
+	user := func(id string, name string) *UserUsage {
+		if users[id] == nil {
+			users[id] = &UserUsage{UserID: id, Name: name}
+		}
+		return users[id]
+	}
+	days := map[string]*dayUsage{}
+	day := func(local time.Time) *dayUsage {
+		date := local.Format(time.DateOnly)
+		if days[date] == nil {
+			days[date] = &dayUsage{DayUsage: DayUsage{Date: date}, drivers: map[string]bool{}}
+		}
+		return days[date]
+	}
+
+	err := d.queryUsageLogins(from, to, func(userID string, name string, start time.Time, end time.Time) {
+		user(userID, name).SeatTime += end.Sub(start).Seconds()
+		report.Total.SeatTime += end.Sub(start).Seconds()
+
+		// Split the login at every full hour, so it's divided between the
+		// hours and days it spans
+		for t := start; t.Before(end); {
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.Local)
+			if next.After(end) {
+				next = end
+			}
+
+			seconds := next.Sub(t).Seconds()
+			report.Hours[t.Hour()].SeatTime += seconds
+			du := day(t)
+			du.SeatTime += seconds
+			du.drivers[userID] = true
+			if du.opensAt.IsZero() || t.Before(du.opensAt) {
+				du.opensAt = t
+			}
+			if next.After(du.closesAt) {
+				du.closesAt = next
+			}
+			t = next
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.queryUsageSessions(from, to, func(userID string, name string, startedAt time.Time, finished bool, distance float64) {
+		user(userID, name).addRun(finished, distance)
+		report.Total.addRun(finished, distance)
+		report.Hours[startedAt.Hour()].Runs++
+		du := day(startedAt)
+		du.addRun(finished, distance)
+		du.drivers[userID] = true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		report.Users = append(report.Users, *u)
+	}
+	sort.Slice(report.Users, func(i, j int) bool {
+		if report.Users[i].SeatTime != report.Users[j].SeatTime {
+			return report.Users[i].SeatTime > report.Users[j].SeatTime
+		}
+		return report.Users[i].Runs > report.Users[j].Runs
+	})
+
+	for _, du := range days {
+		du.Drivers = len(du.drivers)
+		if du.closesAt.After(du.opensAt) {
+			du.OpenTime = du.closesAt.Sub(du.opensAt).Seconds()
+			du.Utilisation = du.SeatTime / du.OpenTime
+		}
+		report.Days = append(report.Days, du.DayUsage)
+	}
+	sort.Slice(report.Days, func(i, j int) bool {
+		return report.Days[i].Date < report.Days[j].Date
+	})
+	return report, nil
+}
+
+// queryUsageLogins calls handle with every login which overlaps the range,
+// clipped to the range, in local time. The active login lasts until now.
+func (d *Database) queryUsageLogins(from time.Time, to time.Time, handle func(userID string, name string, start time.Time, end time.Time)) error {
+	rows, err := d.query(`
+		SELECT l.user_id, u.name, l.timestamp, l.logged_out_at, l.active
+		FROM user_logins l
+		JOIN users u ON u.id = l.user_id
+		WHERE l.timestamp < ? AND (l.logged_out_at > ? OR l.active IS true)
+		ORDER BY l.timestamp
+	`, wallClock(to), wallClock(from))
+	if err != nil {
+		return fmt.Errorf("failed to query logins: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	for rows.Next() {
+		var userID, name string
+		var start time.Time
+		var end sql.NullTime
+		var active bool
+		if err := rows.Scan(&userID, &name, &start, &end, &active); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		start = localTime(start)
+		if end.Valid {
+			end.Time = localTime(end.Time)
+		} else {
+			end = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.Time.After(to) {
+			end.Time = to
+		}
+		if end.Time.After(start) {
+			handle(userID, name, start, end.Time)
+		}
+	}
+	return rows.Err()
+}
+
+// runDistancesSQL selects the distance driven in every session of the "runs"
+// table. The distance of a finished run is the stage length, otherwise the
+// distance reached according to the telemetry or splits. [metre] It takes
+// the finished status as its only parameter.
+const runDistancesSQL = `
+	SELECT
+		r.id,
+		CASE
+			WHEN r.stage_result_status = ? THEN COALESCE(r.stage_length, 0)
+			ELSE COALESCE(t.distance, s.distance, 0)
+		END AS distance
+	FROM runs r
+	LEFT JOIN (
+		SELECT session_id, max(stage_current_distance) AS distance
+		FROM telemetry
+		WHERE session_id IN (SELECT id FROM runs)
+		GROUP BY session_id
+	) t ON t.session_id = r.id
+	LEFT JOIN (
+		SELECT session_id, max(stage_current_distance) AS distance
+		FROM session_splits
+		WHERE session_id IN (SELECT id FROM runs)
+		GROUP BY session_id
+	) s ON s.session_id = r.id
+`
+
+// queryUsageSessions calls handle with every run started in the range, with
+// the start in local time. Runs without a driver have an empty user ID.
+func (d *Database) queryUsageSessions(from time.Time, to time.Time, handle func(userID string, name string, startedAt time.Time, finished bool, distance float64)) error {
+	rows, err := d.query(`
+		WITH runs AS (
+			SELECT *
+			FROM sessions
+			WHERE started_at >= ? AND started_at < ?
+				AND stage_result_status IS NOT NULL
+				AND stage_result_status != ?
+		)
+		SELECT
+			COALESCE(r.user_id, ''),
+			COALESCE(u.name, 'Unknown'),
+			r.started_at,
+			r.stage_result_status = ?,
+			dist.distance
+		FROM runs r
+		LEFT JOIN users u ON u.id = r.user_id
+		JOIN (`+runDistancesSQL+`) dist ON dist.id = r.id
+		ORDER BY r.started_at
+	`, wallClock(from), wallClock(to), stageResultVoided, stageResultStatusFinished, stageResultStatusFinished)
+	if err != nil {
+		return fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	for rows.Next() {
+		var userID, name string
+		var startedAt time.Time
+		var finished bool
+		var distance float64
+		if err := rows.Scan(&userID, &name, &startedAt, &finished, &distance); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		handle(userID, name, localTime(startedAt), finished, distance)
+	}
+	return rows.Err()
+}
+
+// localTime returns the time of a TIMESTAMP column, which is stored in local
+// wall clock time but read as UTC.
+func localTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
+
+// wallClock returns the time as a parameter compared with TIMESTAMP columns,
+// the inverse of localTime.
+func wallClock(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+func formatUsage(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
+
+func totalsCSV(t UsageTotals) []string {
+	return []string{
+		formatUsage(t.SeatTime / 60),
+		strconv.Itoa(t.Runs),
+		strconv.Itoa(t.Finishes),
+		formatUsage(t.FinishRate),
+		formatUsage(t.Distance),
+	}
+}
+
+// WriteCSV writes the users, days or hours of the report as CSV, see
+// UsageByUser etc. Seat times are in minutes.
+func (r *UsageReport) WriteCSV(w io.Writer, by string) error {
+	totalsHeader := []string{"seat_time_min", "runs", "finishes", "finish_rate", "distance_km"}
+	var records [][]string
+	switch by {
+	case UsageByUser:
+		records = append(records, append([]string{"user_id", "name"}, totalsHeader...))
+		for _, u := range r.Users {
+			records = append(records, append([]string{u.UserID, u.Name}, totalsCSV(u.UsageTotals)...))
+		}
+	case UsageByDay:
+		records = append(records, append(append([]string{"date"}, totalsHeader...), "drivers", "open_time_min", "utilisation"))
+		for _, d := range r.Days {
+			record := append([]string{d.Date}, totalsCSV(d.UsageTotals)...)
+			records = append(records, append(record, strconv.Itoa(d.Drivers), formatUsage(d.OpenTime/60), formatUsage(d.Utilisation)))
+		}
+	case UsageByHour:
+		records = append(records, []string{"hour", "runs", "seat_time_min"})
+		for _, h := range r.Hours {
+			records = append(records, []string{strconv.Itoa(h.Hour), strconv.Itoa(h.Runs), formatUsage(h.SeatTime / 60)})
+		}
+	default:
+		return fmt.Errorf("unknown usage grouping: %s", by)
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	return nil
+}
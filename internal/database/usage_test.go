@@ -0,0 +1,70 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetUsageReport(t *testing.T) {
+	for _, zone := range []string{"UTC", "America/New_York", "Europe/Helsinki"} {
+		t.Run(zone, func(t *testing.T) {
+			d := newTestDatabase(t)
+			useTimeZone(t, d, zone)
+
+			// Timestamps are local wall clock time
+			mustExec(t, d,
+				`INSERT INTO users (id, name) VALUES ('a', 'Alice'), ('b', 'Bob')`,
+				`INSERT INTO user_logins (user_id, timestamp, logged_out_at, active) VALUES
+					('a', '2025-03-09 20:00', '2025-03-10 09:00', false),
+					('a', '2025-03-10 09:30', '2025-03-10 11:15', false),
+					('b', '2025-03-10 23:30', '2025-03-11 00:30', false),
+					('b', '2025-03-11 10:00', '2025-03-11 11:00', false)`,
+				`INSERT INTO sessions (user_id, started_at, stage_result_status, stage_length) VALUES
+					('a', '2025-03-10 10:05', 1, 10000),
+					('b', '2025-03-10 23:45', 2, 5000),
+					('b', '2025-03-11 10:30', 1, 10000)`,
+			)
+
+			from := time.Date(2025, 3, 10, 0, 0, 0, 0, time.Local)
+			report, err := d.GetUsageReport(from, from.AddDate(0, 0, 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := report.Total.SeatTime, (9*60+105+30)*60.0; got != want {
+				t.Errorf("seat time %v, want %v", got, want)
+			}
+			if got := report.Total.Runs; got != 2 {
+				t.Errorf("runs %v, want 2", got)
+			}
+
+			hours := map[int]HourUsage{
+				9:  {SeatTime: 1800},
+				10: {Runs: 1, SeatTime: 3600},
+				11: {SeatTime: 900},
+				23: {Runs: 1, SeatTime: 1800},
+			}
+			for hour := range 9 {
+				hours[hour] = HourUsage{SeatTime: 3600}
+			}
+			for _, hour := range report.Hours {
+				want := hours[hour.Hour]
+				want.Hour = hour.Hour
+				if hour != want {
+					t.Errorf("hour %d is %+v, want %+v", hour.Hour, hour, want)
+				}
+			}
+
+			if len(report.Days) != 1 {
+				t.Fatalf("got %d days, want 1", len(report.Days))
+			}
+			day := report.Days[0]
+			if day.Date != "2025-03-10" || day.Drivers != 2 || day.Runs != 2 {
+				t.Errorf("got day %+v, want 2025-03-10 with 2 drivers and 2 runs", day)
+			}
+			if got, want := day.OpenTime, 24*60*60.0; got != want {
+				t.Errorf("open time %v, want %v", got, want)
+			}
+		})
+	}
+}
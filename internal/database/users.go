@@ -4,56 +4,90 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/majori/wrc-laptimer/pkg/username"
 )
 
+type User struct {
+	ID   string `db:"id" json:"id"`
+	Name string `db:"name" json:"name"`
+}
+
 func (d *Database) ListenForUserLogins(cardEvents <-chan string) {
-	for id := range cardEvents {
-		// Check if the user already exists
-		var exists bool
-		err := d.queryRow(`
-			SELECT EXISTS (
-				SELECT 1
-				FROM users
-				WHERE id = ?
-			)
-		`, id).Scan(&exists)
+	for cardID := range cardEvents {
+		card, err := d.GetCard(cardID)
 		if err != nil {
-			slog.Error("error checking user existence", "error", err)
+			slog.Error("error checking card", "error", err)
 			continue
 		}
-		if !exists {
-			// Create the user
-			err = d.CreateUser(id)
+
+		var id string
+		switch {
+		case card == nil:
+			// A new card, create a new user for it. Organisers can merge the
+			// user later if the driver already has another card.
+			err = d.CreateUser(cardID)
 			if err != nil {
 				slog.Error("error creating user", "error", err)
 				continue
 			}
-			slog.Info("user created", "id", id)
+			slog.Info("user created", "id", cardID)
+			id = cardID
+		case card.RevokedAt != nil:
+			slog.Warn("login with a revoked card rejected", "card_id", cardID, "user_id", card.UserID)
+			continue
+		default:
+			id = card.UserID
 		}
 
-		// Logout previous user
-		err = d.LogoutUser()
-		if err != nil {
-			slog.Error("error when logging out user", "error", err)
-			continue
+		if d.GetLogoutPolicy().OnRetap {
+			activeUserID, err := d.GetActiveUserID()
+			if err != nil {
+				slog.Error("error checking active user", "error", err)
+				continue
+			}
+			if activeUserID.Valid && activeUserID.String == id {
+				if err := d.LogoutUser(LogoutReasonRetap); err != nil {
+					slog.Error("error logging out user", "error", err)
+				}
+				continue
+			}
 		}
 
-		// Insert the user login into the database
-		_, err = d.exec(`
-			INSERT INTO user_logins (user_id) 
-			VALUES (?)
-		`, id)
-		if err != nil {
-			slog.Error("error inserting user login", "error", err)
-			continue
+		if err := d.LoginUser(id); err != nil {
+			slog.Error("error logging in user", "error", err)
 		}
+	}
+}
+
+// LoginUser logs out the previous user and logs in the user, who is removed
+// from the queue as their turn has come.
+func (d *Database) LoginUser(id string) error {
+	err := d.LogoutUser(LogoutReasonLogin)
+	if err != nil {
+		return fmt.Errorf("could not log out previous user: %w", err)
+	}
 
-		slog.Info("user logged in", "id", id)
+	// Insert the user login into the database
+	_, err = d.exec(`
+		INSERT INTO user_logins (user_id) 
+		VALUES (?)
+	`, id)
+	if err != nil {
+		return fmt.Errorf("could not insert user login: %w", err)
+	}
+
+	if err := d.DequeueUser(id); err != nil {
+		return err
 	}
+
+	slog.Info("user logged in", "id", id)
+	return nil
 }
 
+// CreateUser creates a user for a new card. The hash of the card is used as
+// the ID of the user.
 func (d *Database) CreateUser(id string) error {
 	name := username.GenerateFromSeed(id)
 	_, err := d.exec(`
@@ -63,9 +97,32 @@ func (d *Database) CreateUser(id string) error {
 	if err != nil {
 		return fmt.Errorf("could not create user: %w", err)
 	}
+	_, err = d.exec(`
+		INSERT INTO user_cards (card_id, user_id)
+		VALUES (?, ?)
+	`, id, id)
+	if err != nil {
+		return fmt.Errorf("could not add card of user: %w", err)
+	}
 	return nil
 }
 
+func (d *Database) GetUser(id string) (*User, error) {
+	var user User
+	err := d.queryRow(`
+		SELECT id, name
+		FROM users
+		WHERE id = ?
+	`, id).Scan(&user.ID, &user.Name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No user found
+		}
+		return nil, fmt.Errorf("could not get user: %w", err)
+	}
+	return &user, nil
+}
+
 func (d *Database) GetActiveUserID() (sql.NullString, error) {
 	var id sql.NullString
 	err := d.queryRow(`
@@ -88,17 +145,194 @@ func (d *Database) GetActiveUserID() (sql.NullString, error) {
 	return id, nil
 }
 
-func (d *Database) LogoutUser() error {
+// LogoutUser logs out the active user, if any, for the reason, see
+// LogoutReasonIdle etc.
+func (d *Database) LogoutUser(reason string) error {
 	_, err := d.exec(`
 		UPDATE user_logins
-		SET active = false
+		SET active = false, logged_out_at = CURRENT_TIMESTAMP, logout_reason = ?
 		WHERE active IS true
+	`, reason)
+
+	if err != nil {
+		return err
+	}
+
+	slog.Info("user logged out (if any)", "reason", reason)
+	return nil
+}
+
+type UserSummary struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	SessionCount int        `json:"session_count"`
+	CardCount    int        `json:"card_count"`
+	LastLoginAt  *time.Time `json:"last_login_at"`
+}
+
+// ListUsers returns every user, the most recently logged in first.
+func (d *Database) ListUsers() ([]UserSummary, error) {
+	rows, err := d.query(`
+		SELECT
+			u.id,
+			u.name,
+			(SELECT COUNT(*) FROM sessions s WHERE s.user_id = u.id),
+			(SELECT COUNT(*) FROM user_cards c WHERE c.user_id = u.id AND c.revoked_at IS NULL),
+			(SELECT MAX(timestamp) FROM user_logins ul WHERE ul.user_id = u.id) AS last_login_at
+		FROM users u
+		ORDER BY last_login_at DESC NULLS LAST, u.name
 	`)
+	if err != nil {
+		return nil, fmt.Errorf("could not list users: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Printf("failed to close rows: %v\n", err)
+		}
+	}()
+
+	users := []UserSummary{}
+	for rows.Next() {
+		var user UserSummary
+		if err := rows.Scan(&user.ID, &user.Name, &user.SessionCount, &user.CardCount, &user.LastLoginAt); err != nil {
+			return nil, fmt.Errorf("could not scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return users, nil
+}
 
+func (d *Database) RenameUser(id string, name string) error {
+	name, err := d.validateName(id, name)
 	if err != nil {
 		return err
 	}
+	result, err := d.exec("UPDATE users SET name = ? WHERE id = ?", name, id)
+	if err != nil {
+		return fmt.Errorf("could not rename user: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user %s does not exist", id)
+	}
+	return nil
+}
+
+// Tables which refer to a user, in the order they are re-pointed on merge
+var userReferences = []string{
+	"user_logins",
+	"sessions",
+	"results",
+	"series_results",
+	"achievements",
+	"user_rating_history",
+	"user_profiles",
+	"user_cards",
+	"user_pins",
+	"driver_queue",
+}
+
+// Tables with at most one row per user. The row of the user merged into is
+// kept if both users have one.
+var singleUserReferences = []string{
+	"user_profiles",
+	"user_pins",
+	"driver_queue",
+}
+
+// MergeUsers moves everything of user fromID, including the cards, to user
+// intoID and removes fromID, e.g. when a driver has used two different
+// cards. The results of the affected events and every rating are
+// recalculated.
+func (d *Database) MergeUsers(fromID string, intoID string) error {
+	if fromID == intoID {
+		return fmt.Errorf("cannot merge user %s into itself", fromID)
+	}
+	for _, id := range []string{fromID, intoID} {
+		user, err := d.GetUser(id)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return fmt.Errorf("user %s does not exist", id)
+		}
+	}
+
+	rows, err := d.query(`
+		SELECT DISTINCT race_event_id
+		FROM sessions
+		WHERE user_id = ? AND race_event_id IS NOT NULL
+		ORDER BY race_event_id
+	`, fromID)
+	if err != nil {
+		return fmt.Errorf("failed to query events of user: %w", err)
+	}
+	var eventIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close() //nolint:errcheck
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		eventIDs = append(eventIDs, id)
+	}
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	d.backupBefore("merge-users")
+
+	tx, err := d.db.BeginTx(d.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	for _, table := range singleUserReferences {
+		_, err = tx.ExecContext(d.ctx, fmt.Sprintf(`
+			DELETE FROM %[1]s
+			WHERE user_id = ? AND EXISTS (SELECT 1 FROM %[1]s WHERE user_id = ?)
+		`, table), fromID, intoID)
+		if err != nil {
+			return fmt.Errorf("failed to remove %s of user: %w", table, err)
+		}
+	}
+
+	// Ratings are keyed by user and rebuilt below, so the ratings of the
+	// merged user are dropped instead of moved
+	if _, err := tx.ExecContext(d.ctx, "DELETE FROM user_ratings WHERE user_id = ?", fromID); err != nil {
+		return fmt.Errorf("failed to remove ratings of user: %w", err)
+	}
+
+	for _, table := range userReferences {
+		_, err := tx.ExecContext(d.ctx, fmt.Sprintf("UPDATE %s SET user_id = ? WHERE user_id = ?", table), intoID, fromID)
+		if err != nil {
+			return fmt.Errorf("failed to move %s of user: %w", table, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit merge: %w", err)
+	}
 
-	slog.Info("user logged out (if any)")
+	// DuckDB checks the foreign keys against the state before the
+	// transaction, so the user can only be removed after the commit
+	if _, err := d.exec("DELETE FROM users WHERE id = ?", fromID); err != nil {
+		return fmt.Errorf("failed to remove merged user: %w", err)
+	}
+
+	for _, id := range eventIDs {
+		if err := d.RecalculateEventResults(id); err != nil {
+			return fmt.Errorf("failed to recalculate results of event %d: %w", id, err)
+		}
+	}
+	if err := d.RecalculateRatings(); err != nil {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,130 @@
+package events
+
+import (
+	"math"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+	"github.com/majori/wrc-laptimer/pkg/telemetry"
+)
+
+const (
+	impactAcceleration  = 5 * 9.81 // Acceleration above 5 g is considered an impact [m/s^2]
+	contactAcceleration = 3 * 9.81 // Acceleration above 3 g can't come from braking alone [m/s^2]
+	speedDropThreshold  = 20.0     // Speed lost within speedDropWindow to count as a speed drop, about 2 g [m/s]
+	speedDropWindow     = 1.0      // [s]
+	rolloverUpY         = 0.0      // Car is considered rolled over when the up vector points down
+	rolloverResetUpY    = 0.5      // Car is back on its wheels when the up vector points this much up
+	incidentCooldown    = 2.0      // Minimum time between incidents of the same kind [s]
+
+	tyreStateUndamaged = 0
+)
+
+type speedSample struct {
+	time         float32
+	speed        float32
+	acceleration float64
+}
+
+// incidentDetector flags crashes, punctures and offs from the telemetry of
+// the active session.
+type incidentDetector struct {
+	sessionID    int
+	previous     *telemetry.TelemetrySessionUpdate
+	speedSamples []speedSample
+	rolledOver   bool
+	lastIncident map[string]float32
+}
+
+func (i *incidentDetector) reset(sessionID int) {
+	*i = incidentDetector{
+		sessionID:    sessionID,
+		lastIncident: make(map[string]float32),
+	}
+}
+
+func (i *incidentDetector) newIncident(pkt *telemetry.TelemetrySessionUpdate, kind, detail string, magnitude float32) database.SessionIncident {
+	i.lastIncident[kind] = pkt.StageCurrentTime
+	return database.SessionIncident{
+		SessionID:            i.sessionID,
+		Kind:                 kind,
+		Detail:               detail,
+		Magnitude:            magnitude,
+		StageCurrentTime:     pkt.StageCurrentTime,
+		StageCurrentDistance: pkt.StageCurrentDistance,
+		VehiclePositionX:     pkt.VehiclePositionX,
+		VehiclePositionY:     pkt.VehiclePositionY,
+		VehiclePositionZ:     pkt.VehiclePositionZ,
+	}
+}
+
+func (i *incidentDetector) coolingDown(kind string, now float32) bool {
+	last, ok := i.lastIncident[kind]
+	return ok && now-last < incidentCooldown && now >= last
+}
+
+func (i *incidentDetector) update(pkt *telemetry.TelemetrySessionUpdate) []database.SessionIncident {
+	if i.sessionID == 0 {
+		return nil
+	}
+
+	var incidents []database.SessionIncident
+	now := pkt.StageCurrentTime
+
+	acceleration := math.Sqrt(float64(
+		pkt.VehicleAccelerationX*pkt.VehicleAccelerationX +
+			pkt.VehicleAccelerationY*pkt.VehicleAccelerationY +
+			pkt.VehicleAccelerationZ*pkt.VehicleAccelerationZ,
+	))
+	if acceleration > impactAcceleration && !i.coolingDown(database.IncidentImpact, now) {
+		incidents = append(incidents, i.newIncident(pkt, database.IncidentImpact, "", float32(acceleration)))
+	}
+
+	if i.previous != nil {
+		tyres := []struct {
+			wheel    string
+			previous uint8
+			current  uint8
+		}{
+			{"fl", i.previous.VehicleTyreStateFl, pkt.VehicleTyreStateFl},
+			{"fr", i.previous.VehicleTyreStateFr, pkt.VehicleTyreStateFr},
+			{"bl", i.previous.VehicleTyreStateBl, pkt.VehicleTyreStateBl},
+			{"br", i.previous.VehicleTyreStateBr, pkt.VehicleTyreStateBr},
+		}
+		// A punctured tyre may burst later, but it's still the same puncture
+		for _, tyre := range tyres {
+			if tyre.previous == tyreStateUndamaged && tyre.current != tyreStateUndamaged {
+				incidents = append(incidents, i.newIncident(pkt, database.IncidentPuncture, tyre.wheel, float32(tyre.current)))
+			}
+		}
+	}
+
+	// Keep the speed samples of the last second to catch sudden stops which
+	// are spread over several packets. Hard braking can lose almost as much
+	// speed, so the drop must come with a jolt which braking can't cause.
+	samples := i.speedSamples[:0]
+	var maxSpeed float32
+	maxAcceleration := acceleration
+	for _, s := range i.speedSamples {
+		if now-s.time <= speedDropWindow && s.time <= now {
+			samples = append(samples, s)
+			maxSpeed = max(maxSpeed, s.speed)
+			maxAcceleration = max(maxAcceleration, s.acceleration)
+		}
+	}
+	i.speedSamples = append(samples, speedSample{time: now, speed: pkt.VehicleSpeed, acceleration: acceleration})
+	drop := maxSpeed - pkt.VehicleSpeed
+	if drop > speedDropThreshold && maxAcceleration > contactAcceleration && !i.coolingDown(database.IncidentSpeedDrop, now) {
+		incidents = append(incidents, i.newIncident(pkt, database.IncidentSpeedDrop, "", drop))
+	}
+
+	if !i.rolledOver && pkt.VehicleUpDirectionY < rolloverUpY {
+		i.rolledOver = true
+		incidents = append(incidents, i.newIncident(pkt, database.IncidentRollover, "", pkt.VehicleUpDirectionY))
+	} else if i.rolledOver && pkt.VehicleUpDirectionY > rolloverResetUpY {
+		i.rolledOver = false
+	}
+
+	previous := *pkt
+	i.previous = &previous
+	return incidents
+}
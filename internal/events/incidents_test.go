@@ -0,0 +1,135 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+	"github.com/majori/wrc-laptimer/pkg/telemetry"
+)
+
+// drive feeds the detector a packet every 1/60 s from the speed and
+// acceleration returned for each time and counts the detected incidents.
+func drive(duration float32, packet func(t float32, pkt *telemetry.TelemetrySessionUpdate)) map[string]int {
+	var detector incidentDetector
+	detector.reset(1)
+
+	counts := map[string]int{}
+	for t := float32(0); t <= duration; t += 1.0 / 60 {
+		pkt := &telemetry.TelemetrySessionUpdate{StageCurrentTime: t, VehicleUpDirectionY: 1}
+		packet(t, pkt)
+		for _, incident := range detector.update(pkt) {
+			counts[incident.Kind]++
+		}
+	}
+	return counts
+}
+
+func TestIncidentDetector(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet func(t float32, pkt *telemetry.TelemetrySessionUpdate)
+		want   map[string]int
+	}{
+		{
+			name: "steady driving",
+			packet: func(t float32, pkt *telemetry.TelemetrySessionUpdate) {
+				pkt.VehicleSpeed = 30
+			},
+			want: map[string]int{},
+		},
+		{
+			name: "hard braking",
+			packet: func(t float32, pkt *telemetry.TelemetrySessionUpdate) {
+				// 1.6 g from 45 m/s to 15 m/s
+				pkt.VehicleSpeed = max(45-16*t, 15)
+				if pkt.VehicleSpeed > 15 {
+					pkt.VehicleAccelerationX = -16
+				}
+			},
+			want: map[string]int{},
+		},
+		{
+			name: "hitting a tree",
+			packet: func(t float32, pkt *telemetry.TelemetrySessionUpdate) {
+				pkt.VehicleSpeed = 30
+				if t > 1 {
+					pkt.VehicleSpeed = 2
+				}
+				if t > 1 && t < 1.05 {
+					pkt.VehicleAccelerationX = -60
+				}
+			},
+			want: map[string]int{database.IncidentImpact: 1, database.IncidentSpeedDrop: 1},
+		},
+		{
+			name: "sliding into a ditch",
+			packet: func(t float32, pkt *telemetry.TelemetrySessionUpdate) {
+				pkt.VehicleSpeed = max(35-40*(t-1), 5)
+				if t < 1 {
+					pkt.VehicleSpeed = 35
+				} else if pkt.VehicleSpeed > 5 {
+					pkt.VehicleAccelerationX = -35
+				}
+			},
+			want: map[string]int{database.IncidentSpeedDrop: 1},
+		},
+		{
+			name: "puncture",
+			packet: func(t float32, pkt *telemetry.TelemetrySessionUpdate) {
+				pkt.VehicleSpeed = 30
+				if t > 1 {
+					pkt.VehicleTyreStateFl = 1
+				}
+			},
+			want: map[string]int{database.IncidentPuncture: 1},
+		},
+		{
+			name: "puncture and burst",
+			packet: func(t float32, pkt *telemetry.TelemetrySessionUpdate) {
+				pkt.VehicleSpeed = 30
+				switch {
+				case t > 2:
+					pkt.VehicleTyreStateFl = 2
+				case t > 1:
+					pkt.VehicleTyreStateFl = 1
+				}
+			},
+			want: map[string]int{database.IncidentPuncture: 1},
+		},
+		{
+			name: "punctures of two tyres",
+			packet: func(t float32, pkt *telemetry.TelemetrySessionUpdate) {
+				pkt.VehicleSpeed = 30
+				if t > 1 {
+					pkt.VehicleTyreStateFl = 1
+				}
+				if t > 2 {
+					pkt.VehicleTyreStateBr = 2
+				}
+			},
+			want: map[string]int{database.IncidentPuncture: 2},
+		},
+		{
+			name: "rolling over and back",
+			packet: func(t float32, pkt *telemetry.TelemetrySessionUpdate) {
+				if t > 1 && t < 2 {
+					pkt.VehicleUpDirectionY = -0.8
+				}
+			},
+			want: map[string]int{database.IncidentRollover: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := drive(3, tt.packet)
+			if len(got) != len(tt.want) {
+				t.Errorf("got incidents %v, want %v", got, tt.want)
+			}
+			for kind, count := range tt.want {
+				if got[kind] != count {
+					t.Errorf("got %d %s incidents, want %d", got[kind], kind, count)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package events
+
+import (
+	"github.com/majori/wrc-laptimer/internal/database"
+	"github.com/majori/wrc-laptimer/pkg/telemetry"
+)
+
+// splitDetector detects split crossings from "StagePreviousSplitTime", which
+// changes every time the car passes a split. The value is unspecified until
+// the first split, so the value seen at the start of the session is ignored.
+type splitDetector struct {
+	sessionID  int
+	splitIndex int
+	latest     float32
+	seen       bool
+}
+
+func (s *splitDetector) reset(sessionID int) {
+	*s = splitDetector{sessionID: sessionID}
+}
+
+func (s *splitDetector) update(pkt *telemetry.TelemetrySessionUpdate) (database.SessionSplit, bool) {
+	if s.sessionID == 0 {
+		return database.SessionSplit{}, false
+	}
+
+	if !s.seen {
+		s.seen = true
+		s.latest = pkt.StagePreviousSplitTime
+		return database.SessionSplit{}, false
+	}
+
+	if pkt.StagePreviousSplitTime == s.latest || pkt.StagePreviousSplitTime <= 0 {
+		return database.SessionSplit{}, false
+	}
+
+	s.latest = pkt.StagePreviousSplitTime
+	s.splitIndex++
+	return database.SessionSplit{
+		SessionID:            s.sessionID,
+		SplitIndex:           s.splitIndex,
+		SplitTime:            pkt.StagePreviousSplitTime,
+		StageCurrentTime:     pkt.StageCurrentTime,
+		StageCurrentDistance: pkt.StageCurrentDistance,
+	}, true
+}
@@ -0,0 +1,51 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/majori/wrc-laptimer/pkg/telemetry"
+)
+
+func TestSplitDetector(t *testing.T) {
+	tests := []struct {
+		name       string
+		sessionID  int
+		splitTimes []float32 // StagePreviousSplitTime of consecutive packets
+		want       []float32 // Detected split times
+	}{
+		{"no session", 0, []float32{0, 30, 60}, nil},
+		{"first value is ignored", 1, []float32{12.5, 12.5, 12.5}, nil},
+		{"splits", 1, []float32{0, 0, 30, 30, 30, 61.5, 61.5}, []float32{30, 61.5}},
+		{"stale split from previous session", 1, []float32{95, 95, 32, 32}, []float32{32}},
+		{"unset values", 1, []float32{0, -1, 0, 40}, []float32{40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var detector splitDetector
+			detector.reset(tt.sessionID)
+
+			var got []float32
+			for i, splitTime := range tt.splitTimes {
+				split, ok := detector.update(&telemetry.TelemetrySessionUpdate{
+					StagePreviousSplitTime: splitTime,
+					StageCurrentTime:       float32(i),
+				})
+				if !ok {
+					continue
+				}
+				if split.SessionID != tt.sessionID || split.SplitIndex != len(got)+1 || split.StageCurrentTime != float32(i) {
+					t.Errorf("got split %+v at packet %d", split, i)
+				}
+				got = append(got, split.SplitTime)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got splits %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got splits %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -6,19 +6,33 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/majori/wrc-laptimer/internal/broker"
 	"github.com/majori/wrc-laptimer/internal/database"
 	"github.com/majori/wrc-laptimer/pkg/telemetry"
 )
 
-func ProcessTelemetryEvents(ctx context.Context, db *database.Database, packetCh <-chan telemetry.TelemetryPacket) {
-	inactivityDuration := 5 * time.Minute
-	inactivityTimer := time.NewTimer(inactivityDuration)
+// How often the idle time of the logged in user is checked
+const idleCheckInterval = 10 * time.Second
+
+func ProcessTelemetryEvents(ctx context.Context, db *database.Database, b *broker.Broker, packetCh <-chan telemetry.TelemetryPacket) {
+	idleTicker := time.NewTicker(idleCheckInterval)
+	defer idleTicker.Stop()
+
+	// The idle time is measured from the end of the last stage or the login,
+	// whichever is later. Packets sent from the menus don't reset it.
+	var lastStageEnd time.Time
+
+	// A session without packets for the stalled session timeout is abandoned,
+	// as the game has crashed or been closed in the middle of the stage.
+	var lastPacket time.Time
+
+	var splits splitDetector
+	var incidents incidentDetector
 
 	for {
 		select {
 		case pkt := <-packetCh:
-			inactivityTimer.Reset(inactivityDuration)
-
+			lastPacket = time.Now()
 			switch pkt := pkt.(type) {
 			case *telemetry.TelemetrySessionStart:
 				err := db.FlushTelemetry()
@@ -32,27 +46,62 @@ func ProcessTelemetryEvents(ctx context.Context, db *database.Database, packetCh
 				}
 				slog.Info("session started")
 
+				splits.reset(db.GetActiveSessionID())
+				incidents.reset(db.GetActiveSessionID())
+
 			case *telemetry.TelemetrySessionUpdate:
 				err := db.AppendTelemetry(pkt)
 				if err != nil {
 					slog.Error("could not create new appender for telemetry", "error", err)
 				}
 
+				if split, ok := splits.update(pkt); ok {
+					processSplit(db, b, split)
+				}
+
+				for _, incident := range incidents.update(pkt) {
+					slog.Info("incident detected", "kind", incident.Kind, "distance", incident.StageCurrentDistance)
+					if err := db.StoreIncident(incident); err != nil {
+						slog.Error("could not save incident", "error", err)
+						continue
+					}
+					b.Publish("incident", incident)
+				}
+
 			case *telemetry.TelemetrySessionEnd:
 				err := db.FlushTelemetry()
 				if err != nil {
 					slog.Error("could not save telemetry", "error", err)
 				}
 
-				err = db.EndSession(pkt)
+				splits.reset(0)
+				incidents.reset(0)
+
+				sessionID := db.GetActiveSessionID()
+				achievements, err := db.EndSession(pkt)
 				if err != nil {
 					slog.Error("could not end session", "error", err)
 				}
 				slog.Info("session ended")
 
-				// Clear telemetry data after each session for now
-				//nolint:errcheck
-				db.ClearTelemetry()
+				if sessionID != 0 {
+					if err := db.UpdateRouteGeometry(sessionID); err != nil {
+						slog.Error("could not update route geometry", "error", err)
+					}
+				}
+
+				for _, achievement := range achievements {
+					slog.Info("achievement unlocked", "kind", achievement.Kind, "user", achievement.UserID, "time", achievement.ResultTime)
+					b.Publish("achievement", achievement)
+				}
+
+				lastStageEnd = time.Now()
+				logoutAfterSessions(db)
+
+				// The next driver in the queue takes the seat
+				if _, err := db.LoginNextQueued(); err != nil {
+					slog.Error("could not log in next driver", "error", err)
+				}
 
 			case *telemetry.TelemetrySessionPause:
 				continue
@@ -61,12 +110,16 @@ func ProcessTelemetryEvents(ctx context.Context, db *database.Database, packetCh
 			default:
 				slog.Warn("unknown packet type", "type", fmt.Sprintf("%T", pkt))
 			}
-		case <-inactivityTimer.C:
-			slog.Info("inactivity timer triggered")
-			err := db.LogoutUser()
-			if err != nil {
-				slog.Error("could not logout user", "error", err)
+		case <-idleTicker.C:
+			if db.GetActiveSessionID() != 0 {
+				if !abandonStalledSession(db, lastPacket) {
+					continue
+				}
+				splits.reset(0)
+				incidents.reset(0)
+				lastStageEnd = lastPacket
 			}
+			logoutIfIdle(db, lastStageEnd)
 
 		case <-ctx.Done():
 			slog.Info("exiting...")
@@ -74,3 +127,94 @@ func ProcessTelemetryEvents(ctx context.Context, db *database.Database, packetCh
 		}
 	}
 }
+
+// logoutAfterSessions logs out the user if they have driven as many sessions
+// as the logout policy allows.
+func logoutAfterSessions(db *database.Database) {
+	policy := db.GetLogoutPolicy()
+	if policy.AfterSessions <= 0 {
+		return
+	}
+
+	login, err := db.GetActiveLogin()
+	if err != nil {
+		slog.Error("could not get active login", "error", err)
+		return
+	}
+	if login == nil || login.SessionCount < policy.AfterSessions {
+		return
+	}
+
+	slog.Info("session limit reached", "user", login.UserID, "sessions", login.SessionCount)
+	if err := db.LogoutUser(database.LogoutReasonSessions); err != nil {
+		slog.Error("could not logout user", "error", err)
+	}
+}
+
+// logoutIfIdle logs out the user if they have been outside of stages for
+// longer than the logout policy allows.
+func logoutIfIdle(db *database.Database, lastStageEnd time.Time) {
+	policy := db.GetLogoutPolicy()
+	if policy.IdleTimeout <= 0 {
+		return
+	}
+
+	login, err := db.GetActiveLogin()
+	if err != nil {
+		slog.Error("could not get active login", "error", err)
+		return
+	}
+	if login == nil {
+		return
+	}
+
+	idle := login.LoggedInFor
+	if !lastStageEnd.IsZero() {
+		idle = min(idle, time.Since(lastStageEnd))
+	}
+	if idle < policy.IdleTimeout {
+		return
+	}
+
+	slog.Info("user idle", "user", login.UserID, "idle", idle)
+	if err := db.LogoutUser(database.LogoutReasonIdle); err != nil {
+		slog.Error("could not logout user", "error", err)
+	}
+}
+
+// abandonStalledSession abandons the active session if no packets have been
+// received for longer than the stalled session timeout. It reports whether
+// the session was abandoned.
+func abandonStalledSession(db *database.Database, lastPacket time.Time) bool {
+	timeout := db.GetStalledSessionTimeout()
+	if timeout <= 0 || time.Since(lastPacket) < timeout {
+		return false
+	}
+
+	if err := db.FlushTelemetry(); err != nil {
+		slog.Error("could not save telemetry", "error", err)
+	}
+	slog.Warn("session abandoned, no telemetry received", "session", db.GetActiveSessionID(), "since", lastPacket)
+	db.AbandonSession()
+	return true
+}
+
+func processSplit(db *database.Database, b *broker.Broker, split database.SessionSplit) {
+	if err := db.StoreSplit(split); err != nil {
+		slog.Error("could not save split", "error", err)
+		return
+	}
+
+	comparison, err := db.GetLiveSplitComparison()
+	if err != nil {
+		slog.Error("could not compare split", "error", err)
+		return
+	}
+
+	for _, c := range comparison {
+		if c.SplitIndex == split.SplitIndex {
+			b.Publish("split", c)
+			return
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package events
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+	"github.com/majori/wrc-laptimer/pkg/telemetry"
+)
+
+func TestAbandonStalledSession(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		idleTimeout time.Duration
+		lastPacket  time.Duration // [ago]
+		abandoned   bool
+	}{
+		{"receiving telemetry", time.Minute, time.Minute, time.Second, false},
+		{"stalled", time.Minute, time.Minute, 2 * time.Minute, true},
+		{"stalled without idle logout", time.Minute, 0, 2 * time.Minute, true},
+		{"no timeout", 0, time.Minute, time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := database.NewDatabase(context.Background(), filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			t.Cleanup(db.Close)
+			t.Cleanup(db.AbandonSession)
+
+			db.SetLogoutPolicy(database.LogoutPolicy{IdleTimeout: tt.idleTimeout})
+			db.SetStalledSessionTimeout(tt.timeout)
+			if err := db.StartSession(&telemetry.TelemetrySessionStart{RouteID: 1, VehicleID: 1}); err != nil {
+				t.Fatal(err)
+			}
+
+			got := abandonStalledSession(db, time.Now().Add(-tt.lastPacket))
+			if got != tt.abandoned {
+				t.Errorf("abandoned %v, want %v", got, tt.abandoned)
+			}
+			if active := db.GetActiveSessionID() != 0; active == tt.abandoned {
+				t.Errorf("session active %v after abandoned %v", active, tt.abandoned)
+			}
+		})
+	}
+}
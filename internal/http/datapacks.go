@@ -0,0 +1,95 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+)
+
+/*
+DataPacksHandler lists the loaded data packs on GET and loads a pack on POST.
+The pack is JSON, or CSV when the content type is text/csv. A version which
+has already been loaded is reloaded only with force=true.
+
+Example Request:
+
+	POST /api/admin/data-packs?force=true
+	{
+	    "version": "1.9.0",
+	    "routes": [{"id": 24, "location_id": 5, "name": "Asco"}]
+	}
+*/
+func DataPacksHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			packs, err := db.GetDataPacks()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get data packs: %v", err), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(packs); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+				return
+			}
+		case http.MethodPost:
+			format := database.DataPackFormatJSON
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+				format = database.DataPackFormatCSV
+			}
+			pack, err := database.ParseDataPack(r.Body, format)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			load, err := db.LoadDataPack(pack, r.URL.Query().Get("force") == "true")
+			if err != nil {
+				status := http.StatusInternalServerError
+				switch {
+				case errors.Is(err, database.ErrInvalidDataPack):
+					status = http.StatusBadRequest
+				case errors.Is(err, database.ErrDataPackLoaded):
+					status = http.StatusConflict
+				}
+				http.Error(w, fmt.Sprintf("Failed to load data pack: %v", err), status)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(load); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+				return
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// MissingLookupsHandler lists the game content seen in sessions but missing
+// from the loaded data packs.
+func MissingLookupsHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		missing, err := db.GetMissingLookups()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get missing lookups: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(missing); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
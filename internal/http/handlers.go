@@ -281,3 +281,93 @@ func EndSeriesHandler(db *database.Database) http.HandlerFunc {
 		}
 	}
 }
+
+func ListSeriesHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		series, err := db.ListSeries()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list series: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(series); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func ListEventsHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var seriesID sql.NullInt32
+		if s := r.URL.Query().Get("series"); s != "" {
+			id, err := strconv.Atoi(s)
+			if err != nil {
+				http.Error(w, "Invalid series ID", http.StatusBadRequest)
+				return
+			}
+			seriesID = sql.NullInt32{Int32: int32(id), Valid: true}
+		}
+
+		events, err := db.ListEvents(seriesID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list events: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(events); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func GetEventResultsHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		eventID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+		hcMode := r.URL.Query().Get("hc") == "true"
+
+		event, err := db.GetEvent(eventID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get event: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if event == nil {
+			http.Error(w, "Event not found", http.StatusNotFound)
+			return
+		}
+
+		results, err := db.GetEventResults(eventID, hcMode)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get results: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(results); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+	"github.com/majori/wrc-laptimer/internal/identity"
+)
+
+// Cookie which holds the device token of a phone used for QR code logins
+const deviceCookie = "wrc_device"
+
+// Wrong PINs a client may enter within pinAttemptWindow before it has to
+// wait, which limits guessing
+const (
+	maxPINAttempts   = 5
+	pinAttemptWindow = time.Minute
+)
+
+// pinAttempts counts the wrong PINs of each client.
+type pinAttempts struct {
+	mu       sync.Mutex
+	failures map[string][]time.Time
+}
+
+func newPINAttempts() *pinAttempts {
+	return &pinAttempts{failures: make(map[string][]time.Time)}
+}
+
+// recent returns the wrong PINs of the client within the window and forgets
+// the older ones.
+func (p *pinAttempts) recent(client string, now time.Time) []time.Time {
+	failures := p.failures[client][:0]
+	for _, t := range p.failures[client] {
+		if now.Sub(t) < pinAttemptWindow {
+			failures = append(failures, t)
+		}
+	}
+	if len(failures) == 0 {
+		delete(p.failures, client)
+		return nil
+	}
+	p.failures[client] = failures
+	return failures
+}
+
+// allow reports whether the client may try a PIN now.
+func (p *pinAttempts) allow(client string, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.recent(client, now)) < maxPINAttempts
+}
+
+func (p *pinAttempts) fail(client string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures[client] = append(p.recent(client, now), now)
+}
+
+// clientAddress returns the IP address of the client without the port.
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Logins holds the identity sources which receive logins through the API. Nil
+// sources are disabled.
+type Logins struct {
+	Web *identity.Web
+	QR  *identity.QR
+}
+
+// LoginRequest picks the driver by either the user ID or the PIN.
+type LoginRequest struct {
+	UserID string `json:"user_id"`
+	PIN    string `json:"pin"`
+}
+
+type LoginMethodsResponse struct {
+	Web bool `json:"web"`
+	QR  bool `json:"qr"`
+}
+
+type QRCodeResponse struct {
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// LoginHandler returns the enabled login methods on GET, and logs in the
+// picked driver or the driver with the PIN on POST. A client which enters
+// too many wrong PINs has to wait before trying again.
+func LoginHandler(db *database.Database, logins Logins) http.HandlerFunc {
+	attempts := newPINAttempts()
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			err := json.NewEncoder(w).Encode(LoginMethodsResponse{Web: logins.Web != nil, QR: logins.QR != nil})
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			}
+			return
+		case http.MethodPost:
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if logins.Web == nil {
+			http.Error(w, "Web login is disabled", http.StatusNotFound)
+			return
+		}
+
+		var req LoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		userID := req.UserID
+		if req.PIN != "" {
+			client := clientAddress(r)
+			if !attempts.allow(client, time.Now()) {
+				http.Error(w, "Too many wrong PINs, try again later", http.StatusTooManyRequests)
+				return
+			}
+			user, err := db.GetUserByPIN(req.PIN)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if user == nil {
+				attempts.fail(client, time.Now())
+				http.Error(w, "Wrong PIN", http.StatusUnauthorized)
+				return
+			}
+			userID = user.ID
+		}
+
+		card, err := db.GetActiveCard(userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get card: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if card == nil {
+			http.Error(w, "User not found or has no active card", http.StatusNotFound)
+			return
+		}
+
+		if err := logins.Web.Login(r.Context(), card.CardID); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to log in: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"status": "login accepted"}`)); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// QRCodeHandler returns the current login code for the room screen, which
+// shows it as a QR code.
+func QRCodeHandler(logins Logins) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if logins.QR == nil {
+			http.Error(w, "QR code login is disabled", http.StatusNotFound)
+			return
+		}
+
+		code, expires := logins.QR.Code()
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(QRCodeResponse{Code: code, ExpiresAt: expires}); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// QRLoginHandler is opened by the phone which scanned the QR code. It's a GET
+// request as the phone opens the link in a browser. The response is plain
+// text for the same reason.
+func QRLoginHandler(logins Logins) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if logins.QR == nil {
+			http.Error(w, "QR code login is disabled", http.StatusNotFound)
+			return
+		}
+
+		token := identity.NewToken()
+		if cookie, err := r.Cookie(deviceCookie); err == nil && cookie.Value != "" {
+			token = cookie.Value
+		}
+
+		err := logins.QR.Login(r.Context(), r.PathValue("code"), token)
+		if errors.Is(err, identity.ErrInvalidCode) {
+			http.Error(w, "The QR code has expired, scan it again", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to log in: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     deviceCookie,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   10 * 365 * 24 * 60 * 60,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := w.Write([]byte("Logged in, see the room screen for your name.\n")); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+type QueueRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// QueueHandler returns the drivers waiting for their turn on GET, and adds a
+// driver to the end of the queue on POST.
+func QueueHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req QueueRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			user, err := db.GetUser(req.UserID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if user == nil {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+
+			if err := db.QueueUser(user.ID); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to queue user: %v", err), http.StatusInternalServerError)
+				return
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		writeQueue(db, w)
+	}
+}
+
+// DequeueHandler removes the driver from the queue.
+func DequeueHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := db.DequeueUser(r.PathValue("id")); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to remove user from queue: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeQueue(db, w)
+	}
+}
+
+func writeQueue(db *database.Database, w http.ResponseWriter) {
+	queue, err := db.GetQueue()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get queue: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(queue); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
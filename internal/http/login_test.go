@@ -0,0 +1,37 @@
+package http
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPINAttempts(t *testing.T) {
+	attempts := newPINAttempts()
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := range maxPINAttempts {
+		if !attempts.allow("10.0.0.1", start) {
+			t.Fatalf("attempt %d was refused", i+1)
+		}
+		attempts.fail("10.0.0.1", start.Add(time.Duration(i)*time.Second))
+	}
+
+	tests := []struct {
+		name   string
+		client string
+		at     time.Duration
+		want   bool
+	}{
+		{"after too many wrong PINs", "10.0.0.1", 10 * time.Second, false},
+		{"another client", "10.0.0.2", 10 * time.Second, true},
+		{"before the window has passed", "10.0.0.1", pinAttemptWindow - time.Second, false},
+		{"after the first wrong PIN expires", "10.0.0.1", pinAttemptWindow, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attempts.allow(tt.client, start.Add(tt.at)); got != tt.want {
+				t.Errorf("allow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
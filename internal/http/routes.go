@@ -0,0 +1,187 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+)
+
+// GetRouteDangerMapHandler returns where on the route people crash. The
+// length of the grouped stretches can be set with the "bucket" parameter.
+func GetRouteDangerMapHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		routeID, err := parseIDFromPath(r, "/api/routes/", "/incidents")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		bucketLength := 100.0
+		if b := r.URL.Query().Get("bucket"); b != "" {
+			bucketLength, err = strconv.ParseFloat(b, 64)
+			if err != nil || bucketLength <= 0 {
+				http.Error(w, "Invalid bucket length", http.StatusBadRequest)
+				return
+			}
+		}
+
+		zones, err := db.GetRouteDangerZones(routeID, bucketLength)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get danger zones: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(zones); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Route maps are served as GeoJSON-like feature collections. Coordinates are
+// game world positions in metres as [x, z, y], i.e. the ground plane first and
+// the height last like in GeoJSON.
+type GeometryJSON struct {
+	Type        string       `json:"type"`
+	Coordinates [][3]float32 `json:"coordinates"`
+}
+
+type FeatureJSON struct {
+	Type       string         `json:"type"`
+	Geometry   GeometryJSON   `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type FeatureCollectionJSON struct {
+	Type     string        `json:"type"`
+	Features []FeatureJSON `json:"features"`
+}
+
+func lineString(coordinates [][3]float32) GeometryJSON {
+	return GeometryJSON{Type: "LineString", Coordinates: coordinates}
+}
+
+// GetRouteMapHandler returns the reference polyline of the route. Individual
+// runs can be overlaid with "sessions=1,2,3" and coloured by "color=speed"
+// (default) or "color=delta" (time delta to the route record).
+func GetRouteMapHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		routeID, err := parseIDFromPath(r, "/api/routes/", "/map")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		colorBy := r.URL.Query().Get("color")
+		if colorBy == "" {
+			colorBy = "speed"
+		}
+		if colorBy != "speed" && colorBy != "delta" {
+			http.Error(w, "Invalid color, expected speed or delta", http.StatusBadRequest)
+			return
+		}
+
+		var sessionIDs []int
+		if s := r.URL.Query().Get("sessions"); s != "" {
+			for _, part := range strings.Split(s, ",") {
+				id, err := strconv.Atoi(strings.TrimSpace(part))
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Invalid session ID: %v", err), http.StatusBadRequest)
+					return
+				}
+				sessionIDs = append(sessionIDs, id)
+			}
+		}
+
+		geometry, err := db.GetRouteGeometry(routeID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get route geometry: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		coordinates := make([][3]float32, len(geometry))
+		distances := make([]float64, len(geometry))
+		runCounts := make([]int, len(geometry))
+		for i, p := range geometry {
+			coordinates[i] = [3]float32{p.VehiclePositionX, p.VehiclePositionZ, p.VehiclePositionY}
+			distances[i] = p.Distance
+			runCounts[i] = p.RunCount
+		}
+
+		response := FeatureCollectionJSON{
+			Type: "FeatureCollection",
+			Features: []FeatureJSON{{
+				Type:     "Feature",
+				Geometry: lineString(coordinates),
+				Properties: map[string]any{
+					"kind":       "reference",
+					"route_id":   routeID,
+					"distances":  distances,
+					"run_counts": runCounts,
+				},
+			}},
+		}
+
+		for _, sessionID := range sessionIDs {
+			trace, err := db.GetSessionTrace(sessionID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get session trace: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if trace == nil || int(trace.RouteID) != routeID {
+				http.Error(w, fmt.Sprintf("Session %d not found on route %d", sessionID, routeID), http.StatusNotFound)
+				return
+			}
+
+			coordinates := make([][3]float32, len(trace.Points))
+			distances := make([]float64, len(trace.Points))
+			values := make([]*float32, len(trace.Points))
+			for i, p := range trace.Points {
+				coordinates[i] = [3]float32{p.VehiclePositionX, p.VehiclePositionZ, p.VehiclePositionY}
+				distances[i] = p.Distance
+				if colorBy == "speed" {
+					speed := p.Speed
+					values[i] = &speed
+				}
+			}
+			if colorBy == "delta" {
+				values = trace.ReferenceDeltas
+			}
+
+			response.Features = append(response.Features, FeatureJSON{
+				Type:     "Feature",
+				Geometry: lineString(coordinates),
+				Properties: map[string]any{
+					"kind":                 "run",
+					"session_id":           trace.SessionID,
+					"vehicle_class_id":     trace.VehicleClassID,
+					"reference_session_id": trace.ReferenceID,
+					"distances":            distances,
+					"color_by":             colorBy,
+					"values":               values,
+				},
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
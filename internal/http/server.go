@@ -5,11 +5,12 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/majori/wrc-laptimer/internal/broker"
 	"github.com/majori/wrc-laptimer/internal/database"
 	"github.com/majori/wrc-laptimer/web"
 )
 
-func StartHTTPServer(db *database.Database, addr string) {
+func StartHTTPServer(db *database.Database, b *broker.Broker, logins Logins, addr string) {
 	mux := http.NewServeMux()
 
 	// Add query endpoint
@@ -53,6 +54,64 @@ func StartHTTPServer(db *database.Database, addr string) {
 	mux.HandleFunc("/api/admin/events/{id}/start", StartEventHandler(db))
 	mux.HandleFunc("/api/admin/events/{id}/end", EndEventHandler(db))
 
+	mux.HandleFunc("/api/admin/users/{id}/rename", RenameUserHandler(db))
+	mux.HandleFunc("/api/admin/users/{id}/merge", MergeUserHandler(db))
+	mux.HandleFunc("/api/admin/users/{id}/cards", GetUserCardsHandler(db))
+	mux.HandleFunc("/api/admin/cards/{id}/revoke", SetCardRevokedHandler(db, true))
+	mux.HandleFunc("/api/admin/cards/{id}/restore", SetCardRevokedHandler(db, false))
+
+	mux.HandleFunc("/api/admin/sessions/{id}/corrections", GetSessionCorrectionsHandler(db))
+	for _, action := range []string{
+		database.CorrectionReassign,
+		database.CorrectionEvent,
+		database.CorrectionPenalty,
+		database.CorrectionDisqualify,
+		database.CorrectionVoid,
+	} {
+		mux.HandleFunc("/api/admin/sessions/{id}/"+action, CorrectSessionHandler(db, action))
+	}
+
+	mux.HandleFunc("/api/admin/data-packs", DataPacksHandler(db))
+	mux.HandleFunc("/api/admin/data-packs/missing", MissingLookupsHandler(db))
+
+	mux.HandleFunc("/api/series", ListSeriesHandler(db))
+	mux.HandleFunc("/api/events", ListEventsHandler(db))
+	mux.HandleFunc("/api/events/{id}/results", GetEventResultsHandler(db))
+
+	mux.HandleFunc("/api/login", LoginHandler(db, logins))
+	mux.HandleFunc("/api/login/qr", QRCodeHandler(logins))
+	mux.HandleFunc("/api/login/qr/{code}", QRLoginHandler(logins))
+	mux.HandleFunc("/api/queue", QueueHandler(db))
+	mux.HandleFunc("/api/queue/{id}", DequeueHandler(db))
+
+	mux.HandleFunc("/api/users", ListUsersHandler(db))
+	mux.HandleFunc("/api/users/active", ActiveUserHandler(db))
+	mux.HandleFunc("/api/users/{id}/profile", UserProfileHandler(db))
+	mux.HandleFunc("/api/users/{id}/avatar", UserAvatarHandler(db))
+
+	mux.HandleFunc("/api/users/{id}/rating", GetUserRatingHandler(db))
+	mux.HandleFunc("/api/users/{id}/stats", GetUserStatsHandler(db))
+	mux.HandleFunc("/api/achievements", GetAchievementsHandler(db))
+
+	mux.HandleFunc("/api/sessions/live/splits", GetLiveSplitsHandler(db))
+	mux.HandleFunc("/api/sessions/{id}/splits", GetSessionSplitsHandler(db))
+	mux.HandleFunc("/api/sessions/{id}/incidents", GetSessionIncidentsHandler(db))
+	mux.HandleFunc("/api/sessions/{id}/analysis", GetSessionAnalysisHandler(db))
+	mux.HandleFunc("/api/sessions/{id}/corners", GetSessionCornersHandler(db))
+	mux.HandleFunc("/api/sessions/{id}/export", GetSessionExportHandler(db))
+
+	mux.HandleFunc("/api/routes/{id}/incidents", GetRouteDangerMapHandler(db))
+	mux.HandleFunc("/api/routes/{id}/map", GetRouteMapHandler(db))
+
+	mux.HandleFunc("/api/stats/usage", UsageStatsHandler(db))
+	mux.HandleFunc("/api/stats/routes", RouteUsageHandler(db))
+	mux.HandleFunc("/api/stats/routes/{id}", RouteStatsHandler(db))
+	mux.HandleFunc("/api/stats/vehicles", VehicleUsageHandler(db))
+	mux.HandleFunc("/api/compare", CompareHandler(db))
+
+	// Server-sent events for the room screen
+	mux.HandleFunc("/api/live", LiveStreamHandler(b))
+
 	// Serve static files
 	staticHandler := http.FileServer(http.FS(web.GetWebFS()))
 	mux.Handle("/", staticHandler)
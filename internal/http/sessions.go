@@ -0,0 +1,310 @@
+package http
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+)
+
+func GetSessionSplitsHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sessionID, err := parseIDFromPath(r, "/api/sessions/", "/splits")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		splits, err := db.GetSessionSplits(sessionID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get splits: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if splits == nil {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(splits); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func GetLiveSplitsHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		splits, err := db.GetLiveSplitComparison()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get splits: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if splits == nil {
+			splits = []database.SplitComparison{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(splits); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func GetSessionIncidentsHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sessionID, err := parseIDFromPath(r, "/api/sessions/", "/incidents")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		incidents, err := db.GetSessionIncidents(sessionID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get incidents: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(incidents); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func GetSessionAnalysisHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sessionID, err := parseIDFromPath(r, "/api/sessions/", "/analysis")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		analysis, err := db.AnalyzeSession(sessionID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to analyze session: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if analysis == nil {
+			http.Error(w, "No telemetry found for session", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(analysis); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func GetSessionCornersHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sessionID, err := parseIDFromPath(r, "/api/sessions/", "/corners")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		corners, err := db.GetSessionCorners(sessionID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get corners: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if corners == nil {
+			http.Error(w, "No telemetry found for session", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(corners); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+var exportContentTypes = map[string]string{
+	database.ExportFormatCSV:     "text/csv",
+	database.ExportFormatJSON:    "application/json",
+	database.ExportFormatParquet: "application/vnd.apache.parquet",
+	database.ExportFormatMoTeC:   "text/csv",
+}
+
+func GetSessionExportHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sessionID, err := parseIDFromPath(r, "/api/sessions/", "/export")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = database.ExportFormatCSV
+		}
+		contentType, ok := exportContentTypes[format]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Invalid format, expected one of %s", strings.Join(database.ExportFormats, ", ")), http.StatusBadRequest)
+			return
+		}
+
+		session, err := db.GetSessionMetadata(sessionID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get session: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if session == nil {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+
+		extension := format
+		if format == database.ExportFormatMoTeC {
+			extension = "csv"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"session-%d.%s\"", sessionID, extension))
+		if err := db.ExportSession(session, format, w); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to export session: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// SessionCorrectionRequest holds the fields of a correction. Which fields are
+// used depends on the correction, e.g. Seconds for a penalty. A null event
+// detaches the session from its event.
+type SessionCorrectionRequest struct {
+	UserID  string  `json:"user_id"`
+	EventID *int    `json:"event_id"`
+	Seconds float64 `json:"seconds"`
+	Reason  string  `json:"reason"`
+}
+
+// CorrectSessionHandler applies the correction, see database.CorrectionVoid
+// etc., and responds with every correction of the session. Results and
+// ratings are recalculated, but achievements are not: they tell what was
+// achieved when the run ended and stay as they were.
+func CorrectSessionHandler(db *database.Database, action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sessionID, err := parseIDFromPath(r, "/api/admin/sessions/", "/"+action)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var req SessionCorrectionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		err = CorrectSession(db, sessionID, action, req)
+		if errors.Is(err, database.ErrInvalidCorrection) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to correct session: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeSessionCorrections(db, w, sessionID)
+	}
+}
+
+// CorrectSession applies the correction to the session. It's shared with the
+// organiser commands which open the database directly.
+func CorrectSession(db *database.Database, sessionID int, action string, req SessionCorrectionRequest) error {
+	switch action {
+	case database.CorrectionReassign:
+		return db.ReassignSession(sessionID, req.UserID, req.Reason)
+	case database.CorrectionEvent:
+		var eventID sql.NullInt32
+		if req.EventID != nil {
+			eventID = sql.NullInt32{Int32: int32(*req.EventID), Valid: true}
+		}
+		return db.SetSessionEvent(sessionID, eventID, req.Reason)
+	case database.CorrectionPenalty:
+		return db.AddSessionPenalty(sessionID, req.Seconds, req.Reason)
+	case database.CorrectionDisqualify:
+		return db.DisqualifySession(sessionID, req.Reason)
+	case database.CorrectionVoid:
+		return db.VoidSession(sessionID, req.Reason)
+	default:
+		return fmt.Errorf("%w: unknown correction %s", database.ErrInvalidCorrection, action)
+	}
+}
+
+func GetSessionCorrectionsHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sessionID, err := parseIDFromPath(r, "/api/admin/sessions/", "/corrections")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		writeSessionCorrections(db, w, sessionID)
+	}
+}
+
+func writeSessionCorrections(db *database.Database, w http.ResponseWriter, sessionID int) {
+	corrections, err := db.GetSessionCorrections(sessionID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get corrections: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(corrections); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
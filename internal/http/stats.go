@@ -0,0 +1,235 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+)
+
+// defaultUsageDays is the length of the usage report when no range is given.
+const defaultUsageDays = 30
+
+/*
+Example Request:
+
+	GET /api/stats/usage?from=2025-01-01&to=2025-01-31
+	GET /api/stats/usage?from=2025-01-01&to=2025-01-31&format=csv&by=day
+
+The dates are in local time and both ends are inclusive. Without a range the
+report covers the last 30 days.
+*/
+func UsageStatsHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		from, to, err := parseDateRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "csv" {
+			http.Error(w, "Invalid format, expected one of json, csv", http.StatusBadRequest)
+			return
+		}
+		by := r.URL.Query().Get("by")
+		if by == "" {
+			by = database.UsageByUser
+		}
+		if !slices.Contains(database.UsageGroupings, by) {
+			http.Error(w, fmt.Sprintf("Invalid grouping, expected one of %s", strings.Join(database.UsageGroupings, ", ")), http.StatusBadRequest)
+			return
+		}
+
+		report, err := db.GetUsageReport(from, to)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get usage: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"usage-%s-%s-by-%s.csv\"",
+				from.Format(time.DateOnly), to.AddDate(0, 0, -1).Format(time.DateOnly), by))
+			if err := report.WriteCSV(w, by); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to export usage: %v", err), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// parseDateRange reads the "from" and "to" dates of the request and returns
+// them as a half-open range from the start of "from" to the end of "to".
+func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if s := r.URL.Query().Get("to"); s != "" {
+		t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to date, expected YYYY-MM-DD")
+		}
+		to = t
+	}
+	to = to.AddDate(0, 0, 1)
+
+	from := to.AddDate(0, 0, -defaultUsageDays)
+	if s := r.URL.Query().Get("from"); s != "" {
+		t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from date, expected YYYY-MM-DD")
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from date must not be after to date")
+	}
+	return from, to, nil
+}
+
+/*
+Example Request:
+
+	GET /api/compare?users=alice,bob
+	GET /api/compare?users=alice,bob&hc=true
+
+Gaps are the time of the first user minus the second.
+*/
+func CompareHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userIDs := strings.Split(r.URL.Query().Get("users"), ",")
+		if len(userIDs) != 2 || userIDs[0] == "" || userIDs[1] == "" {
+			http.Error(w, "Expected two users, e.g. users=a,b", http.StatusBadRequest)
+			return
+		}
+		if userIDs[0] == userIDs[1] {
+			http.Error(w, "Cannot compare a user with themselves", http.StatusBadRequest)
+			return
+		}
+		hcMode := r.URL.Query().Get("hc") == "true"
+
+		var users [2]*database.User
+		for i, id := range userIDs {
+			user, err := db.GetUser(id)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if user == nil {
+				http.Error(w, fmt.Sprintf("User %s not found", id), http.StatusNotFound)
+				return
+			}
+			users[i] = user
+		}
+
+		comparison, err := db.CompareUsers(users[0], users[1], hcMode)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to compare users: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(comparison); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// RouteUsageHandler lists the driven routes, the most driven first.
+func RouteUsageHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		routes, err := db.GetRouteUsage()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get routes: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(routes); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// RouteStatsHandler returns the finish times of a route per class, with the
+// fastest vehicles and the time spread of the drivers.
+func RouteStatsHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		routeID, err := parseIDFromPath(r, "/api/stats/routes/", "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		stats, err := db.GetRouteStats(routeID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get route stats: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if stats == nil {
+			http.Error(w, "Route has not been driven", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(stats); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// VehicleUsageHandler lists the driven vehicles, the most driven first.
+func VehicleUsageHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		vehicles, err := db.GetVehicleUsage()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get vehicles: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(vehicles); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
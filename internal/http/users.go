@@ -0,0 +1,385 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/majori/wrc-laptimer/internal/database"
+)
+
+type UserRatingResponse struct {
+	UserID  string                      `json:"user_id"`
+	Ratings []database.UserRating       `json:"ratings"`
+	History []database.UserRatingChange `json:"history"`
+}
+
+func GetUserRatingHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID := r.PathValue("id")
+		user, err := db.GetUser(userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		ratings, err := db.GetUserRatings(user.ID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get ratings: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		history, err := db.GetUserRatingHistory(user.ID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get rating history: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := UserRatingResponse{UserID: user.ID, Ratings: ratings, History: history}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// GetUserStatsHandler returns the career statistics of a driver.
+func GetUserStatsHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID := r.PathValue("id")
+		user, err := db.GetUser(userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		stats, err := db.GetCareerStats(user.ID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get stats: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(stats); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func ListUsersHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		users, err := db.ListUsers()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list users: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(users); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+type RenameUserRequest struct {
+	Name string `json:"name"`
+}
+
+func RenameUserHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req RenameUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := db.RenameUser(r.PathValue("id"), req.Name); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to rename user: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"status": "user renamed successfully"}`)); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+type MergeUserRequest struct {
+	Into string `json:"into"`
+}
+
+// MergeUserHandler merges the user in the path into the user in the body.
+func MergeUserHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req MergeUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := db.MergeUsers(r.PathValue("id"), req.Into); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to merge users: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"status": "users merged successfully"}`)); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// requireActiveUser allows changing a profile only by the driver who is
+// logged in, i.e. has tapped their card. Organisers use the admin endpoints.
+func requireActiveUser(db *database.Database, w http.ResponseWriter, userID string) bool {
+	activeUserID, err := db.GetActiveUserID()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get active user: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	if !activeUserID.Valid || activeUserID.String != userID {
+		http.Error(w, "Only the logged in driver can change their profile", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func writeProfile(db *database.Database, w http.ResponseWriter, userID string) {
+	profile, err := db.GetUserProfile(userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(profile); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ActiveUserHandler returns the profile of the logged in driver, or null if
+// nobody is logged in.
+func ActiveUserHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := db.GetActiveUserID()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get active user: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeProfile(db, w, userID.String)
+	}
+}
+
+/*
+Example Request:
+
+	{
+	    "name": "Flying Finn",
+	    "nationality": "FI",
+	    "favourite_vehicle_id": 23
+	}
+
+Omitted fields are not changed. Empty name restores the generated name.
+*/
+func UserProfileHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID := r.PathValue("id")
+		user, err := db.GetUser(userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			if !requireActiveUser(db, w, userID) {
+				return
+			}
+
+			var req database.ProfileUpdate
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			if err := db.UpdateUserProfile(userID, req); err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, database.ErrInvalidProfile) {
+					status = http.StatusBadRequest
+				}
+				http.Error(w, fmt.Sprintf("Failed to update profile: %v", err), status)
+				return
+			}
+		}
+
+		writeProfile(db, w, userID)
+	}
+}
+
+// UserAvatarHandler serves the avatar image. The logged in driver can upload
+// a new one with PUT, with the image as the body, or remove it with DELETE.
+func UserAvatarHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.PathValue("id")
+
+		switch r.Method {
+		case http.MethodGet:
+			avatar, contentType, err := db.GetUserAvatar(userID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get avatar: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if avatar == nil {
+				http.Error(w, "Avatar not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", contentType)
+			if _, err := w.Write(avatar); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to write response: %v", err), http.StatusInternalServerError)
+				return
+			}
+
+		case http.MethodPut, http.MethodDelete:
+			if !requireActiveUser(db, w, userID) {
+				return
+			}
+
+			var avatar []byte
+			var contentType string
+			if r.Method == http.MethodPut {
+				var err error
+				avatar, err = io.ReadAll(http.MaxBytesReader(w, r.Body, database.MaxAvatarSize))
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Avatar must be at most %d KiB", database.MaxAvatarSize/1024), http.StatusRequestEntityTooLarge)
+					return
+				}
+				contentType = http.DetectContentType(avatar)
+			}
+
+			if err := db.SetUserAvatar(userID, avatar, contentType); err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, database.ErrInvalidProfile) {
+					status = http.StatusBadRequest
+				}
+				http.Error(w, fmt.Sprintf("Failed to store avatar: %v", err), status)
+				return
+			}
+			writeProfile(db, w, userID)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func GetUserCardsHandler(db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, err := db.GetUser(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		cards, err := db.GetUserCards(user.ID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get cards: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(cards); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// SetCardRevokedHandler revokes the card in the path, or restores it if
+// revoked is false.
+func SetCardRevokedHandler(db *database.Database, revoked bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := db.SetCardRevoked(r.PathValue("id"), revoked); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to update card: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		status := `{"status": "card restored successfully"}`
+		if revoked {
+			status = `{"status": "card revoked successfully"}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(status)); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
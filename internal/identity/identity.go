@@ -0,0 +1,68 @@
+// Package identity provides the sources through which drivers identify
+// themselves, e.g. by tapping an NFC card. Every source sends the hash of the
+// identity to a channel, which is handled as a card by the login.
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	SourceACR122U  = "acr122u"
+	SourceKeyboard = "keyboard"
+	SourceWeb      = "web"
+	SourceQR       = "qr"
+)
+
+// Sources lists the names of the available sources.
+var Sources = []string{SourceACR122U, SourceKeyboard, SourceWeb, SourceQR}
+
+// Source reads identities and sends their hashes to the events channel until
+// the context is cancelled.
+type Source interface {
+	Name() string
+	Listen(ctx context.Context, events chan<- string) error
+}
+
+// Hash returns the ID under which the identity is stored. Only the hash is
+// stored so that the raw card UIDs and tokens can't be read from the database.
+func Hash(identity []byte) string {
+	hasher := sha256.New()
+	hasher.Write(identity)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// inbox is a source for identities received from other goroutines, e.g. HTTP
+// handlers.
+type inbox struct {
+	ids chan string
+}
+
+func newInbox() inbox {
+	return inbox{ids: make(chan string)}
+}
+
+func (i inbox) Listen(ctx context.Context, events chan<- string) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case id := <-i.ids:
+			events <- id
+		}
+	}
+}
+
+// send passes the ID to the listener. It fails if the source is not listened
+// to before the context is done.
+func (i inbox) send(ctx context.Context, id string) error {
+	select {
+	case i.ids <- id:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("could not send login: %w", ctx.Err())
+	}
+}
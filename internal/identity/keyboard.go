@@ -0,0 +1,134 @@
+package identity
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Keyboard reads identities from a keyboard wedge, i.e. a barcode, QR code or
+// RFID reader which types the scanned value followed by Enter. The reader is
+// read from stdin if Device is empty or "-", otherwise from the Linux evdev
+// device, e.g. /dev/input/by-id/usb-reader-event-kbd.
+//
+// The typed value is hashed, so a card read with both an NFC reader and a
+// keyboard wedge reader results in two different users, which can be merged.
+type Keyboard struct {
+	Device string
+}
+
+func (k Keyboard) Name() string {
+	return SourceKeyboard
+}
+
+func (k Keyboard) Listen(ctx context.Context, events chan<- string) error {
+	handle := func(line string) {
+		if line = strings.TrimSpace(line); line != "" {
+			events <- Hash([]byte(line))
+		}
+	}
+
+	var err error
+	if k.Device == "" || k.Device == "-" {
+		slog.Info("listening for keyboard input", "source", SourceKeyboard, "device", "stdin")
+		err = readLines(os.Stdin, handle)
+	} else {
+		device, openErr := os.Open(k.Device)
+		if openErr != nil {
+			return fmt.Errorf("could not open keyboard device: %w", openErr)
+		}
+		// Closing the device stops the blocking read when the context is done
+		go func() {
+			<-ctx.Done()
+			device.Close() //nolint:errcheck
+		}()
+
+		slog.Info("listening for keyboard input", "source", SourceKeyboard, "device", k.Device)
+		err = readKeyEvents(device, handle)
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err == nil {
+		err = io.EOF
+	}
+	return fmt.Errorf("could not read keyboard input: %w", err)
+}
+
+func readLines(r io.Reader, handle func(string)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		handle(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// inputEvent is struct input_event of the Linux input subsystem on 64-bit
+// platforms.
+type inputEvent struct {
+	Sec   int64
+	Usec  int64
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+const (
+	evKey      = 0x01
+	keyPressed = 1
+
+	keyEnter      = 28
+	keyLeftShift  = 42
+	keyRightShift = 54
+	keyKPEnter    = 96
+)
+
+// Characters of the key codes which the readers type. The index is the key
+// code, see linux/input-event-codes.h.
+var keyChars = map[uint16]string{
+	2: "1", 3: "2", 4: "3", 5: "4", 6: "5", 7: "6", 8: "7", 9: "8", 10: "9", 11: "0",
+	12: "-",
+	16: "q", 17: "w", 18: "e", 19: "r", 20: "t", 21: "y", 22: "u", 23: "i", 24: "o", 25: "p",
+	30: "a", 31: "s", 32: "d", 33: "f", 34: "g", 35: "h", 36: "j", 37: "k", 38: "l",
+	44: "z", 45: "x", 46: "c", 47: "v", 48: "b", 49: "n", 50: "m",
+	71: "7", 72: "8", 73: "9", 75: "4", 76: "5", 77: "6", 79: "1", 80: "2", 81: "3", 82: "0",
+}
+
+// readKeyEvents translates the key presses of an evdev device to lines.
+func readKeyEvents(r io.Reader, handle func(string)) error {
+	var line strings.Builder
+	shift := false
+	for {
+		var event inputEvent
+		if err := binary.Read(r, binary.NativeEndian, &event); err != nil {
+			return err
+		}
+		if event.Type != evKey {
+			continue
+		}
+
+		switch event.Code {
+		case keyLeftShift, keyRightShift:
+			// Value is 0 on release, 1 on press and 2 on repeat
+			shift = event.Value != 0
+		case keyEnter, keyKPEnter:
+			if event.Value == keyPressed {
+				handle(line.String())
+				line.Reset()
+			}
+		default:
+			if char, ok := keyChars[event.Code]; ok && event.Value == keyPressed {
+				if shift {
+					char = strings.ToUpper(char)
+				}
+				line.WriteString(char)
+			}
+		}
+	}
+}
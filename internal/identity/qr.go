@@ -0,0 +1,76 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrInvalidCode is returned when a QR code is used after it has expired or
+// another driver has already used it.
+var ErrInvalidCode = errors.New("invalid or expired login code")
+
+// QR logs in drivers who scan the QR code shown on the room screen with their
+// phone. The code changes after every login and when it expires, so that it
+// can't be used outside of the room. The phone is identified by a device token
+// stored in the browser, which acts as the card of the driver.
+type QR struct {
+	inbox
+
+	ttl     time.Duration
+	mu      sync.Mutex
+	code    string
+	expires time.Time
+}
+
+func NewQR(ttl time.Duration) *QR {
+	return &QR{inbox: newInbox(), ttl: ttl}
+}
+
+func (q *QR) Name() string {
+	return SourceQR
+}
+
+// NewToken returns a random device token for a phone which has none yet.
+func NewToken() string {
+	return hex.EncodeToString(randomBytes(32))
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	// Read never returns an error
+	rand.Read(b) //nolint:errcheck
+	return b
+}
+
+// Code returns the current login code and the time it expires. A new code is
+// generated if the previous one has expired.
+func (q *QR) Code() (string, time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.code == "" || time.Now().After(q.expires) {
+		q.rotate()
+	}
+	return q.code, q.expires
+}
+
+func (q *QR) rotate() {
+	q.code = hex.EncodeToString(randomBytes(8))
+	q.expires = time.Now().Add(q.ttl)
+}
+
+// Login logs in the phone with the device token if the code is valid.
+func (q *QR) Login(ctx context.Context, code string, token string) error {
+	q.mu.Lock()
+	if q.code == "" || code != q.code || time.Now().After(q.expires) {
+		q.mu.Unlock()
+		return ErrInvalidCode
+	}
+	q.rotate()
+	q.mu.Unlock()
+
+	return q.send(ctx, Hash([]byte(token)))
+}
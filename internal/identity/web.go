@@ -0,0 +1,24 @@
+package identity
+
+import (
+	"context"
+)
+
+// Web lets a driver to be picked from the web UI. The login is sent with one
+// of the cards of the picked user.
+type Web struct {
+	inbox
+}
+
+func NewWeb() *Web {
+	return &Web{inbox: newInbox()}
+}
+
+func (w *Web) Name() string {
+	return SourceWeb
+}
+
+// Login logs in the owner of the card.
+func (w *Web) Login(ctx context.Context, cardID string) error {
+	return w.send(ctx, cardID)
+}
@@ -0,0 +1,22 @@
+package nfc
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/majori/wrc-laptimer/internal/identity"
+)
+
+// Source is the identity source of an ACR122U reader. It lives here rather
+// than in the identity package so that only builds which use the reader link
+// against PC/SC.
+type Source struct{}
+
+func (Source) Name() string {
+	return identity.SourceACR122U
+}
+
+func (Source) Listen(ctx context.Context, events chan<- string) error {
+	slog.Info("listening for NFC cards", "source", identity.SourceACR122U)
+	return ListenForCardEvents(ctx, events)
+}
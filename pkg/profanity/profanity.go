@@ -0,0 +1,77 @@
+package profanity
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var (
+	// Matched against whole words only, as they are common inside other words
+	words = []string{
+		"ass", "cock", "cum", "dick", "fag", "homo", "nazi", "paska", "rape", "tit",
+	}
+	// Matched anywhere inside a word
+	stems = []string{
+		"asshole", "bastard", "bitch", "cunt", "faggot", "fuck", "hitler",
+		"huora", "kyrpa", "lutka", "mulkku", "neekeri", "nigga", "nigger",
+		"pussy", "retard", "runkkari", "shit", "slut", "twat",
+		"vittu", "wanker", "whore",
+	}
+	// Names and words which contain a stem but are fine
+	allowed = []string{
+		"kinoshita", "kishita", "lutkainen", "matsushita", "morishita",
+		"scunthorpe", "takeshita", "twatson", "yamashita", "yoshitaka",
+		"yoshito", "yoshitomo",
+	}
+	// Common ways to disguise letters
+	replacements = strings.NewReplacer(
+		"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t",
+		"@", "a", "$", "s", "!", "i", "ä", "a", "ö", "o", "å", "a",
+	)
+)
+
+func normalize(text string) string {
+	return replacements.Replace(strings.ToLower(text))
+}
+
+// splitWords splits the text into words of letters. Runs of single letters,
+// e.g. "f u c k" or "s.h.i.t", are joined into one word.
+func splitWords(text string) []string {
+	var result []string
+	var letters strings.Builder
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		if len([]rune(word)) == 1 {
+			letters.WriteString(word)
+			continue
+		}
+		if letters.Len() > 0 {
+			result = append(result, letters.String())
+			letters.Reset()
+		}
+		result = append(result, word)
+	}
+	if letters.Len() > 0 {
+		result = append(result, letters.String())
+	}
+	return result
+}
+
+// Contains reports whether the text contains a profanity or slur, in English
+// or Finnish.
+func Contains(text string) bool {
+	for _, word := range splitWords(normalize(text)) {
+		if slices.Contains(words, word) || slices.Contains(words, strings.TrimSuffix(word, "s")) {
+			return true
+		}
+		if slices.Contains(allowed, word) {
+			continue
+		}
+		for _, stem := range stems {
+			if strings.Contains(word, stem) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package profanity
+
+import "testing"
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		// Real names which contain a stem or word across or inside words
+		{"Kenshi Takahashi", false},
+		{"Yoshitaka Ito", false},
+		{"Dan Igga", false},
+		{"Emma Twatson", false},
+		{"Ana Lutkainen", false},
+		{"Hiro Matsushita", false},
+		{"Dickens", false},
+		{"Titta Cocktail", false},
+		{"Assi Kuusela", false},
+		{"Matti Meikäläinen", false},
+		{"Åsa Öberg", false},
+
+		{"fuck", true},
+		{"Motherfucker", true},
+		{"bullshit driver", true},
+		{"F U C K", true},
+		{"s.h.i.t", true},
+		{"5h1t", true},
+		{"Vittu", true},
+		{"ass", true},
+		{"Big Tits", true},
+		{"Perkele Paska", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := Contains(tt.text); got != tt.want {
+				t.Errorf("Contains(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -64,7 +64,8 @@ export async function getSessionsByDay(date) {
             JOIN users ON sessions.user_id = users.id 
             JOIN vehicles ON sessions.vehicle_id = vehicles.id
             WHERE sessions.started_at BETWEEN '${startOfDay}' AND '${endOfDay}'
-            AND stage_shakedown IS FALSE`;
+            AND stage_shakedown IS FALSE
+            AND stage_result_status IS DISTINCT FROM 7`; // Voided by organisers
 
     const data = await postQuery(queryPayload);
     return data;
@@ -74,20 +75,107 @@ export async function getSessionsByDay(date) {
   }
 }
 
-// Fetch the current driver
+// Fetch the profile of the current driver, null if nobody is logged in
 export async function getCurrentDriver() {
+  const response = await fetch("/api/users/active");
+  if (!response.ok) {
+    throw new Error("Failed to fetch current driver");
+  }
+  return response.json();
+}
+
+// Throws the error message of the API if the request failed
+async function checkResponse(response) {
+  if (!response.ok) {
+    throw new Error((await response.text()).trim());
+  }
+  return response.json();
+}
+
+export async function updateProfile(userId, profile) {
+  const response = await fetch(`/api/users/${encodeURIComponent(userId)}/profile`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify(profile),
+  });
+  return checkResponse(response);
+}
+
+export async function uploadAvatar(userId, file) {
+  const response = await fetch(`/api/users/${encodeURIComponent(userId)}/avatar`, {
+    method: "PUT",
+    body: file,
+  });
+  return checkResponse(response);
+}
+
+export async function removeAvatar(userId) {
+  const response = await fetch(`/api/users/${encodeURIComponent(userId)}/avatar`, {
+    method: "DELETE",
+  });
+  return checkResponse(response);
+}
+
+// Returns which of the web login methods are enabled
+export async function getLoginMethods() {
   try {
-    const queryPayload = `SELECT users.name AS user_name
-              FROM user_logins
-              JOIN users ON user_logins.user_id = users.id
-              WHERE user_logins.active IS true
-              ORDER BY user_logins.timestamp DESC
-              LIMIT 1;`;
-    const data = await postQuery(queryPayload);
-    return data[0]?.user_name ?? "N/A";
+    return await checkResponse(await fetch("/api/login"));
   } catch (error) {
-    console.error("Error fetching current driver:", error);
-    return "N/A";
+    console.error("Error fetching login methods:", error);
+    return { web: false, qr: false };
+  }
+}
+
+export async function getUsers() {
+  return checkResponse(await fetch("/api/users"));
+}
+
+// Logs in the driver picked by { user_id } or { pin }
+export async function login(driver) {
+  const response = await fetch("/api/login", {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify(driver),
+  });
+  return checkResponse(response);
+}
+
+export async function getQueue() {
+  return checkResponse(await fetch("/api/queue"));
+}
+
+export async function queueDriver(userId) {
+  const response = await fetch("/api/queue", {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify({ user_id: userId }),
+  });
+  return checkResponse(response);
+}
+
+export async function dequeueDriver(userId) {
+  const response = await fetch(`/api/queue/${encodeURIComponent(userId)}`, {
+    method: "DELETE",
+  });
+  return checkResponse(response);
+}
+
+export async function getLoginCode() {
+  return checkResponse(await fetch("/api/login/qr"));
+}
+
+export async function getVehicles() {
+  try {
+    return await postQuery("SELECT id, name FROM vehicles ORDER BY name");
+  } catch (error) {
+    console.error("Error fetching vehicles:", error);
+    return [];
   }
 }
 
@@ -102,3 +190,16 @@ export async function getChampionshipStandings(id) {
     return [];
   }
 }
+
+// Subscribe to live messages (e.g. new personal bests and records)
+export function subscribeLive(type, handler) {
+  const source = new EventSource("/api/live");
+  source.addEventListener(type, (event) => {
+    try {
+      handler(JSON.parse(event.data));
+    } catch (error) {
+      console.error(`Error handling live ${type} message:`, error);
+    }
+  });
+  return source;
+}
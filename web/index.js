@@ -6,7 +6,20 @@ import {
   getClassName,
   getSessionsByDay,
   getCurrentDriver,
+  updateProfile,
+  uploadAvatar,
+  removeAvatar,
+  getVehicles,
+  getLoginMethods,
+  getUsers,
+  login,
+  getLoginCode,
+  getQueue,
+  queueDriver,
+  dequeueDriver,
   getChampionshipStandings,
+  subscribeLive,
+  postQuery,
 } from "./api.js";
 
 document.addEventListener("alpine:init", () => {
@@ -36,7 +49,49 @@ document.addEventListener("alpine:init", () => {
   });
 
   Alpine.store("currentDriver", {
+    id: null,
     name: "N/A",
+    flag: "",
+    avatarUrl: "",
+  });
+
+  Alpine.store("profile", {
+    visible: false,
+    name: "",
+    defaultName: "",
+    nationality: "",
+    favouriteVehicleId: 0,
+    pin: "",
+    hasPin: false,
+    vehicles: [],
+    error: "",
+  });
+
+  Alpine.store("login", {
+    web: false,
+    qr: false,
+    visible: false,
+    users: [],
+    pin: "",
+    error: "",
+    qrSvg: "",
+  });
+
+  Alpine.store("queue", {
+    drivers: [],
+  });
+
+  Alpine.store("liveSplit", {
+    text: "",
+    slower: false,
+  });
+
+  Alpine.store("celebration", {
+    visible: false,
+    title: "",
+    driver: "",
+    time: "",
+    improvement: "",
   });
 
   Alpine.store("driverAttempts", {
@@ -76,6 +131,136 @@ document.addEventListener("alpine:init", () => {
       document.querySelector(".modal").style.display = "block";
     },
 
+    async openProfile() {
+      const driver = await getCurrentDriver().catch(() => null);
+      if (!driver) {
+        return;
+      }
+      const profile = Alpine.store("profile");
+      profile.name = driver.name === driver.default_name ? "" : driver.name;
+      profile.defaultName = driver.default_name;
+      profile.nationality = driver.nationality ?? "";
+      profile.favouriteVehicleId = driver.favourite_vehicle_id ?? 0;
+      profile.pin = "";
+      profile.hasPin = driver.has_pin;
+      profile.error = "";
+      profile.visible = true;
+      if (profile.vehicles.length === 0) {
+        profile.vehicles = await getVehicles();
+      }
+    },
+
+    async saveProfile() {
+      const profile = Alpine.store("profile");
+      try {
+        const driver = await updateProfile(Alpine.store("currentDriver").id, {
+          name: profile.name,
+          nationality: profile.nationality,
+          favourite_vehicle_id: profile.favouriteVehicleId,
+          // An empty PIN would remove it, so it's only sent when changed
+          ...(profile.pin ? { pin: profile.pin } : {}),
+        });
+        showCurrentDriver(driver);
+        profile.visible = false;
+      } catch (error) {
+        profile.error = error.message;
+      }
+    },
+
+    async removePin() {
+      const profile = Alpine.store("profile");
+      try {
+        await updateProfile(Alpine.store("currentDriver").id, { pin: "" });
+        profile.pin = "";
+        profile.hasPin = false;
+        profile.error = "";
+      } catch (error) {
+        profile.error = error.message;
+      }
+    },
+
+    async uploadAvatar(file) {
+      if (!file) {
+        return;
+      }
+      try {
+        showCurrentDriver(
+          await uploadAvatar(Alpine.store("currentDriver").id, file)
+        );
+        Alpine.store("profile").error = "";
+      } catch (error) {
+        Alpine.store("profile").error = error.message;
+      }
+    },
+
+    async removeAvatar() {
+      try {
+        showCurrentDriver(await removeAvatar(Alpine.store("currentDriver").id));
+      } catch (error) {
+        Alpine.store("profile").error = error.message;
+      }
+    },
+
+    async openLogin() {
+      const store = Alpine.store("login");
+      store.error = "";
+      store.pin = "";
+      store.visible = true;
+      try {
+        store.users = (await getUsers()).sort((a, b) => a.name.localeCompare(b.name));
+      } catch (error) {
+        store.error = error.message;
+      }
+    },
+
+    async login(userId) {
+      await this.loginDriver({ user_id: userId });
+    },
+
+    async loginWithPin() {
+      await this.loginDriver({ pin: Alpine.store("login").pin });
+      Alpine.store("login").pin = "";
+    },
+
+    async loginDriver(driver) {
+      try {
+        await login(driver);
+        Alpine.store("login").visible = false;
+        // The login is handled in the background, give it a moment
+        setTimeout(() => {
+          fetchCurrentDriver();
+          fetchQueue();
+        }, 500);
+      } catch (error) {
+        Alpine.store("login").error = error.message;
+      }
+    },
+
+    async queue(userId) {
+      try {
+        Alpine.store("queue").drivers = await queueDriver(userId);
+        Alpine.store("login").visible = false;
+      } catch (error) {
+        Alpine.store("login").error = error.message;
+      }
+    },
+
+    async dequeue(userId) {
+      try {
+        Alpine.store("queue").drivers = await dequeueDriver(userId);
+      } catch (error) {
+        console.error("Error removing driver from queue:", error);
+      }
+    },
+
+    closeLogin() {
+      Alpine.store("login").visible = false;
+    },
+
+    closeProfile() {
+      Alpine.store("profile").visible = false;
+    },
+
     closeModal() {
       Alpine.store("driverAttempts").selectedDriver = null;
       Alpine.store("driverAttempts").driverAttempts = [];
@@ -115,14 +300,68 @@ document.addEventListener("alpine:init", () => {
     },
   }));
 
+  function showCurrentDriver(driver) {
+    if (!driver) {
+      Alpine.store("currentDriver", { id: null, name: "N/A", flag: "", avatarUrl: "" });
+      return;
+    }
+    Alpine.store("currentDriver", {
+      id: driver.user_id,
+      name: driver.name,
+      flag: driver.nationality ? countryFlag(driver.nationality) : "",
+      // The update time busts the browser cache when the avatar changes
+      avatarUrl: driver.has_avatar
+        ? `/api/users/${encodeURIComponent(driver.user_id)}/avatar?v=${encodeURIComponent(driver.updated_at)}`
+        : "",
+    });
+  }
+
   async function fetchCurrentDriver() {
     try {
-      const currentDriverName = await getCurrentDriver();
-      Alpine.store("currentDriver").name = currentDriverName;
+      showCurrentDriver(await getCurrentDriver());
     } catch (error) {
       console.error("Error fetching current driver:", error);
     }
   }
+
+  async function fetchQueue() {
+    try {
+      Alpine.store("queue").drivers = await getQueue();
+    } catch (error) {
+      console.error("Error fetching queue:", error);
+    }
+  }
+
+  async function fetchLoginMethods() {
+    const methods = await getLoginMethods();
+    Alpine.store("login").web = methods.web;
+    Alpine.store("login").qr = methods.qr;
+    if (methods.qr) {
+      refreshLoginCode();
+    }
+  }
+
+  // Shows the current login code as a QR code. The code changes after every
+  // login and when it expires.
+  async function refreshLoginCode() {
+    try {
+      const { code } = await getLoginCode();
+      const qr = qrcode(0, "M");
+      qr.addData(`${window.location.origin}/api/login/qr/${code}`);
+      qr.make();
+      Alpine.store("login").qrSvg = qr.createSvgTag(3, 0);
+    } catch (error) {
+      console.error("Error fetching login code:", error);
+      Alpine.store("login").qrSvg = "";
+    }
+  }
+
+  // Converts a country code, e.g. "FI", to its flag emoji
+  function countryFlag(code) {
+    return String.fromCodePoint(
+      ...code.toUpperCase().split("").map((c) => 0x1f1e6 + c.charCodeAt(0) - 65)
+    );
+  }
   async function fetchSessionsForDay(date) {
     try {
       const data = await getSessionsByDay(date);
@@ -277,6 +516,49 @@ document.addEventListener("alpine:init", () => {
     }
   }
 
+  let celebrationTimeout;
+  async function celebrateAchievement(achievement) {
+    const driver = await postQuery(
+      `SELECT name FROM users WHERE id = '${achievement.user_id}'`
+    ).catch(() => []);
+
+    Alpine.store("celebration", {
+      visible: true,
+      title:
+        achievement.kind === "route_record"
+          ? "New Stage Record!"
+          : "New Personal Best!",
+      driver: driver[0]?.name ?? "",
+      time: formatTime(achievement.result_time),
+      improvement:
+        achievement.previous_time !== null
+          ? `-${formatTime(achievement.previous_time - achievement.result_time)}`
+          : "",
+    });
+
+    clearTimeout(celebrationTimeout);
+    celebrationTimeout = setTimeout(() => {
+      Alpine.store("celebration").visible = false;
+    }, 10000);
+
+    fetchSessionsForDay(Alpine.store("state").currentDate);
+  }
+
+  function showSplitDelta(split) {
+    const delta = split.personal_best_delta ?? split.record_delta;
+    if (delta === null || delta === undefined) {
+      Alpine.store("liveSplit", { text: `Split ${split.split_index}`, slower: false });
+      return;
+    }
+
+    const reference = split.personal_best_delta !== null ? "PB" : "record";
+    const sign = delta > 0 ? "+" : "-";
+    Alpine.store("liveSplit", {
+      text: `${sign}${Math.abs(delta).toFixed(1)}s to ${reference} at split ${split.split_index}`,
+      slower: delta > 0,
+    });
+  }
+
   function formatTime(seconds) {
     const mins = Math.floor(seconds / 60);
     const secs = Math.floor(seconds % 60);
@@ -300,8 +582,17 @@ document.addEventListener("alpine:init", () => {
   const today = new Date().toISOString().split("T")[0];
   Alpine.store("state").currentDate = today;
   fetchCurrentDriver();
+  fetchQueue();
+  fetchLoginMethods();
   fetchSessionsForDay(today);
 
+  // Celebrate new personal bests and stage records on the room screen
+  subscribeLive("achievement", (achievement) => {
+    Alpine.store("liveSplit").text = "";
+    celebrateAchievement(achievement);
+  });
+  subscribeLive("split", showSplitDelta);
+
   // Fetch championship standings if the "championship" parameter exists
   if (championshipId) {
     fetchChampionshipStandings(championshipId);
@@ -310,7 +601,11 @@ document.addEventListener("alpine:init", () => {
   // Set up periodic updates
   setInterval(() => {
     fetchCurrentDriver();
+    fetchQueue();
     fetchSessionsForDay(Alpine.store("state").currentDate);
+    if (Alpine.store("login").qr) {
+      refreshLoginCode();
+    }
 
     // Fetch championship standings only if the "championship" parameter exists
     if (championshipId) {